@@ -0,0 +1,98 @@
+package dify
+
+import (
+	"strings"
+	"sync"
+)
+
+// Accumulator 汇总流式事件，得到与阻塞模式相同结构的 ChatMessageResp
+//
+// 处理 message、agent_message 片段的拼接，message_replace 的内容替换，
+// 并从首个事件中取得任务、消息和会话 ID，从 message_end 中取得用量和引用资源。
+//
+//	acc := dify.NewAccumulator()
+//	_, err := client.ChatMessage(ctx, dify.ChatMessageOption{
+//		OnEvent: acc.Wrap(func(ev dify.ChatMessageRespSSEData) { fmt.Print(ev.Answer) }),
+//		...
+//	})
+//	resp := acc.Result()
+type Accumulator struct {
+	mu     sync.Mutex
+	resp   ChatMessageResp
+	answer strings.Builder
+	done   bool
+}
+
+func NewAccumulator() *Accumulator {
+	return &Accumulator{}
+}
+
+// Add 处理一个流式事件，可以直接作为 ChatMessageOption.OnEvent
+func (a *Accumulator) Add(ev ChatMessageRespSSEData) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.resp.TaskId == "" {
+		a.resp.TaskId = ev.TaskId
+	}
+	if a.resp.ConversationId == "" {
+		a.resp.ConversationId = ev.ConversationId
+	}
+	if a.resp.MessageId == "" {
+		a.resp.MessageId = ev.MessageId
+	}
+	if a.resp.CreatedAt == 0 {
+		a.resp.CreatedAt = ev.CreatedAt
+	}
+
+	switch ev.Event {
+	case "workflow_started":
+		a.resp.Mode = "advanced-chat"
+	case "agent_thought":
+		a.resp.Mode = "agent-chat"
+	case "message", "agent_message":
+		if ev.Event == "agent_message" {
+			a.resp.Mode = "agent-chat"
+		}
+		a.answer.WriteString(ev.Answer)
+	case "message_replace":
+		// 内容审查命中时，用替换内容覆盖已输出的回答
+		a.answer.Reset()
+		a.answer.WriteString(ev.Answer)
+	case "message_end":
+		a.resp.Metadata = ev.Metadata
+		a.done = true
+	}
+}
+
+// Wrap 返回一个 OnEvent 回调，先汇总事件再调用 next，next 可以为 nil
+func (a *Accumulator) Wrap(next func(ev ChatMessageRespSSEData)) func(ev ChatMessageRespSSEData) {
+	return func(ev ChatMessageRespSSEData) {
+		a.Add(ev)
+		if next != nil {
+			next(ev)
+		}
+	}
+}
+
+// Done 是否已收到 message_end 事件
+func (a *Accumulator) Done() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.done
+}
+
+// Result 返回当前的汇总结果，未收到 message_end 时为已收到部分的结果
+func (a *Accumulator) Result() *ChatMessageResp {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	resp := a.resp
+	resp.Event = "message"
+	resp.Id = resp.MessageId
+	resp.Answer = a.answer.String()
+	if resp.Mode == "" {
+		resp.Mode = "chat"
+	}
+	return &resp
+}
@@ -0,0 +1,111 @@
+package dify_test
+
+import (
+	"context"
+	"testing"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+func TestAccumulator(t *testing.T) {
+	usage := dify.Usage{TotalTokens: 9}
+	tests := []struct {
+		name     string
+		events   []dify.ChatMessageRespSSEData
+		answer   string
+		mode     string
+		done     bool
+		wantUsed int
+	}{
+		{
+			name: "chat",
+			events: []dify.ChatMessageRespSSEData{
+				{Event: "message", TaskId: "t1", MessageId: "m1", ConversationId: "c1", Answer: "你"},
+				{Event: "message", TaskId: "t1", MessageId: "m1", ConversationId: "c1", Answer: "好"},
+				{Event: "message_end", TaskId: "t1", MessageId: "m1", ConversationId: "c1", Metadata: dify.ChatMessageMetadata{Usage: usage}},
+			},
+			answer:   "你好",
+			mode:     "chat",
+			done:     true,
+			wantUsed: 9,
+		},
+		{
+			name: "moderated answer is replaced",
+			events: []dify.ChatMessageRespSSEData{
+				{Event: "message", MessageId: "m1", Answer: "敏感"},
+				{Event: "message_replace", MessageId: "m1", Answer: "内容已屏蔽"},
+				{Event: "message_end", MessageId: "m1"},
+			},
+			answer: "内容已屏蔽",
+			mode:   "chat",
+			done:   true,
+		},
+		{
+			name: "agent",
+			events: []dify.ChatMessageRespSSEData{
+				{Event: "agent_thought", MessageId: "m1"},
+				{Event: "agent_message", MessageId: "m1", Answer: "查到了"},
+			},
+			answer: "查到了",
+			mode:   "agent-chat",
+		},
+		{
+			name: "advanced chat",
+			events: []dify.ChatMessageRespSSEData{
+				{Event: "workflow_started", MessageId: "m1"},
+				{Event: "message", MessageId: "m1", Answer: "ok"},
+				{Event: "workflow_finished", MessageId: "m1"},
+			},
+			answer: "ok",
+			mode:   "advanced-chat",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc := dify.NewAccumulator()
+			for _, ev := range tt.events {
+				acc.Add(ev)
+			}
+			resp := acc.Result()
+			if resp.Answer != tt.answer || resp.Mode != tt.mode || acc.Done() != tt.done {
+				t.Errorf("Result() = %q %s done=%v, want %q %s done=%v", resp.Answer, resp.Mode, acc.Done(), tt.answer, tt.mode, tt.done)
+			}
+			if resp.Id != "m1" || resp.MessageId != "m1" || resp.Event != "message" {
+				t.Errorf("Result() ids = %s %s %s", resp.Event, resp.Id, resp.MessageId)
+			}
+			if resp.Metadata.Usage.TotalTokens != tt.wantUsed {
+				t.Errorf("Usage = %+v", resp.Metadata.Usage)
+			}
+		})
+	}
+}
+
+func TestAccumulatorMatchesBlocking(t *testing.T) {
+	server, client := newTestClient(t)
+	usage := dify.Usage{PromptTokens: 2, CompletionTokens: 3, TotalTokens: 5}
+	server.Enqueue(difytest.Reply{Chunks: []string{"一", "二", "三"}, Usage: usage})
+
+	var chunks int
+	acc := dify.NewAccumulator()
+	_, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		ApiKey:      "app-test",
+		OnEvent:     acc.Wrap(func(dify.ChatMessageRespSSEData) { chunks++ }),
+		RequestBody: dify.ChatMessageReq{Query: "hi", ResponseMode: dify.ResponseModeStreaming, User: "user-1"},
+	})
+	if err != nil {
+		t.Fatalf("ChatMessage() error = %v", err)
+	}
+
+	resp := acc.Result()
+	if resp.Answer != "一二三" || resp.Metadata.Usage != usage || resp.ConversationId == "" || resp.TaskId == "" {
+		t.Errorf("Result() = %+v", resp)
+	}
+	if chunks != 4 {
+		t.Errorf("next called %d times, want 4", chunks)
+	}
+	messages := server.Messages(resp.ConversationId)
+	if len(messages) != 1 || messages[0].Id != resp.MessageId {
+		t.Errorf("MessageId = %s, server messages = %+v", resp.MessageId, messages)
+	}
+}
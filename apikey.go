@@ -0,0 +1,139 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ApiKeyProvider 为每次请求提供实际使用的 API 密钥
+//
+// Client.request 在发起请求前调用 Acquire，请求结束后调用 Report 回报结果，
+// 实现方可以据此在多个密钥之间轮换或剔除被限流的密钥。
+type ApiKeyProvider interface {
+	// Acquire 返回本次请求使用的密钥，apiKey 为调用方在 Option 中传入的密钥
+	Acquire(ctx context.Context, apiKey string) (string, error)
+	// Report 回报使用 apiKey 的请求结果，成功时 err 为 nil，接口报错时为 *APIError
+	Report(apiKey string, err error)
+}
+
+var ErrNoApiKey = errors.New("no api key available")
+
+// NewStaticApiKeyProvider 固定使用同一个密钥，忽略调用方传入的密钥
+func NewStaticApiKeyProvider(apiKey string) ApiKeyProvider {
+	return &staticApiKeyProvider{apiKey: apiKey}
+}
+
+type staticApiKeyProvider struct {
+	apiKey string
+}
+
+func (p *staticApiKeyProvider) Acquire(_ context.Context, _ string) (string, error) {
+	if p.apiKey == "" {
+		return "", ErrNoApiKey
+	}
+	return p.apiKey, nil
+}
+
+func (p *staticApiKeyProvider) Report(_ string, _ error) {}
+
+// NewRoundRobinApiKeyPool 在同一应用的多个密钥之间轮询
+//
+// 调用方传入的密钥属于该池时才会被替换，否则原样使用，
+// 因此同一个客户端仍可以访问其他应用。
+func NewRoundRobinApiKeyPool(apiKeys ...string) ApiKeyProvider {
+	return &roundRobinApiKeyPool{
+		apiKeys: apiKeys,
+		members: toKeySet(apiKeys),
+	}
+}
+
+type roundRobinApiKeyPool struct {
+	apiKeys []string
+	members map[string]struct{}
+	next    atomic.Uint64
+}
+
+func (p *roundRobinApiKeyPool) Acquire(_ context.Context, apiKey string) (string, error) {
+	if len(p.apiKeys) == 0 {
+		return "", ErrNoApiKey
+	}
+	if _, ok := p.members[apiKey]; !ok && apiKey != "" {
+		return apiKey, nil
+	}
+	n := p.next.Add(1) - 1
+	return p.apiKeys[n%uint64(len(p.apiKeys))], nil
+}
+
+func (p *roundRobinApiKeyPool) Report(_ string, _ error) {}
+
+// NewLeastRecentlyThrottledApiKeyPool 优先使用最久未被限流的密钥
+//
+// 密钥收到 429 或额度不足（错误码包含 quota）的响应后，在 cooldown 时间内被剔除；
+// 所有密钥都被剔除时，返回最早恢复的密钥。
+func NewLeastRecentlyThrottledApiKeyPool(cooldown time.Duration, apiKeys ...string) ApiKeyProvider {
+	return &leastRecentlyThrottledApiKeyPool{
+		apiKeys:     apiKeys,
+		members:     toKeySet(apiKeys),
+		cooldown:    cooldown,
+		throttledAt: make(map[string]time.Time),
+	}
+}
+
+type leastRecentlyThrottledApiKeyPool struct {
+	apiKeys     []string
+	members     map[string]struct{}
+	cooldown    time.Duration
+	mu          sync.Mutex
+	throttledAt map[string]time.Time
+	next        int
+}
+
+func (p *leastRecentlyThrottledApiKeyPool) Acquire(_ context.Context, apiKey string) (string, error) {
+	if len(p.apiKeys) == 0 {
+		return "", ErrNoApiKey
+	}
+	if _, ok := p.members[apiKey]; !ok && apiKey != "" {
+		return apiKey, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	best := -1
+	var bestAt time.Time
+	for i := range p.apiKeys {
+		// 从 next 开始遍历，可用密钥之间保持轮询
+		idx := (p.next + i) % len(p.apiKeys)
+		throttledAt := p.throttledAt[p.apiKeys[idx]]
+		if now.Sub(throttledAt) >= p.cooldown {
+			// 已过剔除期，视为可用
+			throttledAt = time.Time{}
+		}
+		if best == -1 || throttledAt.Before(bestAt) {
+			best, bestAt = idx, throttledAt
+		}
+	}
+	p.next = (best + 1) % len(p.apiKeys)
+	return p.apiKeys[best], nil
+}
+
+func (p *leastRecentlyThrottledApiKeyPool) Report(apiKey string, err error) {
+	if _, ok := p.members[apiKey]; !ok || !isThrottleError(err) {
+		return
+	}
+	p.mu.Lock()
+	p.throttledAt[apiKey] = time.Now()
+	p.mu.Unlock()
+}
+
+func toKeySet(apiKeys []string) map[string]struct{} {
+	members := make(map[string]struct{}, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		members[apiKey] = struct{}{}
+	}
+	return members
+}
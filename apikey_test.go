@@ -0,0 +1,117 @@
+package dify_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+// acquire 依次取 n 个密钥
+func acquire(t *testing.T, provider dify.ApiKeyProvider, apiKey string, n int) string {
+	t.Helper()
+	var keys []string
+	for i := 0; i < n; i++ {
+		key, err := provider.Acquire(context.Background(), apiKey)
+		if err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestStaticApiKeyProvider(t *testing.T) {
+	if got := acquire(t, dify.NewStaticApiKeyProvider("app-a"), "app-other", 2); got != "app-a,app-a" {
+		t.Errorf("keys = %s, want app-a,app-a", got)
+	}
+	if _, err := dify.NewStaticApiKeyProvider("").Acquire(context.Background(), "app-a"); !errors.Is(err, dify.ErrNoApiKey) {
+		t.Errorf("empty key error = %v, want ErrNoApiKey", err)
+	}
+}
+
+func TestRoundRobinApiKeyPool(t *testing.T) {
+	pool := dify.NewRoundRobinApiKeyPool("app-a", "app-b", "app-c")
+	tests := []struct {
+		name   string
+		apiKey string
+		n      int
+		want   string
+	}{
+		{name: "member key rotates", apiKey: "app-a", n: 4, want: "app-a,app-b,app-c,app-a"},
+		{name: "empty key uses pool", apiKey: "", n: 2, want: "app-b,app-c"},
+		{name: "other app passes through", apiKey: "app-other", n: 2, want: "app-other,app-other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acquire(t, pool, tt.apiKey, tt.n); got != tt.want {
+				t.Errorf("keys = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeastRecentlyThrottledApiKeyPool(t *testing.T) {
+	throttled := &dify.APIError{StatusCode: http.StatusTooManyRequests, Code: "too_many_requests"}
+	quota := &dify.APIError{StatusCode: http.StatusBadRequest, Code: "provider_quota_exceeded"}
+
+	pool := dify.NewLeastRecentlyThrottledApiKeyPool(time.Hour, "app-a", "app-b", "app-c")
+	if got := acquire(t, pool, "app-a", 3); got != "app-a,app-b,app-c" {
+		t.Fatalf("keys = %s, want round robin", got)
+	}
+
+	// 被限流或额度不足的密钥在冷却期内被跳过，其他错误不影响
+	pool.Report("app-a", throttled)
+	pool.Report("app-b", &dify.APIError{StatusCode: http.StatusBadRequest, Code: "invalid_param"})
+	if got := acquire(t, pool, "app-a", 3); got != "app-b,app-c,app-b" {
+		t.Errorf("keys after throttling app-a = %s, want app-b,app-c,app-b", got)
+	}
+
+	// 全部被剔除时返回最早被限流的密钥
+	pool.Report("app-b", quota)
+	pool.Report("app-c", throttled)
+	if got := acquire(t, pool, "app-a", 1); got != "app-a" {
+		t.Errorf("all throttled = %s, want app-a", got)
+	}
+}
+
+func TestLeastRecentlyThrottledApiKeyPoolCooldown(t *testing.T) {
+	pool := dify.NewLeastRecentlyThrottledApiKeyPool(20*time.Millisecond, "app-a", "app-b")
+	pool.Report("app-a", &dify.APIError{StatusCode: http.StatusTooManyRequests})
+	if got := acquire(t, pool, "", 2); got != "app-b,app-b" {
+		t.Fatalf("keys = %s, want app-b,app-b", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := acquire(t, pool, "", 2); got != "app-a,app-b" {
+		t.Errorf("keys after cooldown = %s, want app-a,app-b", got)
+	}
+}
+
+func TestClientReportsThrottledApiKey(t *testing.T) {
+	server := difytest.NewServer()
+	defer server.Close()
+	server.Fail(http.MethodGet, "/conversations", difytest.Error{Status: http.StatusTooManyRequests, Code: "too_many_requests"})
+	client := dify.NewClient(server.URL, dify.WithApiKeyProvider(
+		dify.NewLeastRecentlyThrottledApiKeyPool(time.Hour, "app-a", "app-b"),
+	))
+
+	for i := 0; i < 3; i++ {
+		_, _ = client.GetConversations(context.Background(), dify.GetConversationsOption{
+			ApiKey:        "app-a",
+			RequestParams: dify.GetConversationsReq{User: "user-1"},
+		})
+	}
+
+	var keys []string
+	for _, request := range server.RequestsTo(http.MethodGet, "/conversations") {
+		keys = append(keys, request.ApiKey)
+	}
+	if got := strings.Join(keys, ","); got != "app-a,app-b,app-b" {
+		t.Errorf("keys sent = %s, want app-a,app-b,app-b", got)
+	}
+}
@@ -0,0 +1,40 @@
+package dify
+
+import (
+	"context"
+	"time"
+)
+
+// AutoStopOption 调用方取消 ctx 后自动停止 Dify 端的生成
+//
+// 流式 ChatMessage 已收到 task_id 但回答尚未结束时 ctx 被取消，
+// 客户端使用相同的 User 调用 StopTask，避免 Dify 继续生成并计费。
+type AutoStopOption struct {
+	Timeout time.Duration                       // StopTask 的超时，默认 5 秒，不受原 ctx 取消的影响
+	OnStop  func(resp *StopTaskResp, err error) // 可选，报告停止结果
+}
+
+// autoStop ctx 被取消且回答未结束时停止任务
+func (c *Client) autoStop(ctx context.Context, option *ChatMessageOption, progress *streamProgress) {
+	if option.AutoStop == nil || ctx.Err() == nil || progress.taskId == "" || progress.finished {
+		return
+	}
+
+	timeout := option.AutoStop.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	resp, stopErr := c.StopTask(stopCtx, StopTaskOption{
+		ApiKey: option.ApiKey,
+		TaskId: progress.taskId,
+		RequestBody: StopTaskReq{
+			User: option.RequestBody.User,
+		},
+	})
+	if option.AutoStop.OnStop != nil {
+		option.AutoStop.OnStop(resp, stopErr)
+	}
+}
@@ -0,0 +1,73 @@
+package dify_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+func TestAutoStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		autoStop bool
+		cancel   bool
+		wantStop bool
+	}{
+		{name: "cancelled with auto stop", autoStop: true, cancel: true, wantStop: true},
+		{name: "cancelled without auto stop", cancel: true},
+		{name: "finished with auto stop", autoStop: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+			server.Enqueue(difytest.Reply{Chunks: []string{"a", "b", "c"}, Delay: 20 * time.Millisecond})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var stopped []error
+			option := dify.ChatMessageOption{
+				ApiKey: "app-test",
+				OnEvent: func(ev dify.ChatMessageRespSSEData) {
+					if tt.cancel && ev.Event == "message" {
+						cancel()
+					}
+				},
+				RequestBody: dify.ChatMessageReq{Query: "hi", ResponseMode: dify.ResponseModeStreaming, User: "user-1"},
+			}
+			if tt.autoStop {
+				option.AutoStop = &dify.AutoStopOption{
+					OnStop: func(resp *dify.StopTaskResp, err error) {
+						stopped = append(stopped, err)
+					},
+				}
+			}
+			_, _ = client.ChatMessage(ctx, option)
+
+			requests := 0
+			for _, request := range server.Requests() {
+				if request.Method != http.MethodPost || !strings.HasSuffix(request.Path, "/stop") {
+					continue
+				}
+				requests++
+				var body dify.StopTaskReq
+				if err := request.JSON(&body); err != nil || body.User != "user-1" || request.ApiKey != "app-test" {
+					t.Errorf("stop request = %+v, body = %+v", request, body)
+				}
+			}
+			if got := requests == 1; got != tt.wantStop {
+				t.Errorf("stop requests = %d, want stop %v", requests, tt.wantStop)
+			}
+			if tt.wantStop && (len(stopped) != 1 || stopped[0] != nil) {
+				t.Errorf("OnStop results = %v, want one success", stopped)
+			}
+			if !tt.wantStop && len(stopped) != 0 {
+				t.Errorf("OnStop called %d times, want 0", len(stopped))
+			}
+		})
+	}
+}
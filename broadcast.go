@@ -0,0 +1,229 @@
+package dify
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// SlowConsumerPolicy 订阅者跟不上事件速度时的处理方式
+type SlowConsumerPolicy int
+
+const (
+	SlowConsumerBlock      SlowConsumerPolicy = iota // 阻塞发布方，直到订阅者读取，会拖慢所有订阅者和上游
+	SlowConsumerDrop                                 // 丢弃最旧的未读事件
+	SlowConsumerDisconnect                           // 断开该订阅者，Err 返回 ErrSlowConsumer
+)
+
+var ErrSlowConsumer = errors.New("subscriber is too slow and has been disconnected")
+
+// SubscribeOption 订阅配置
+type SubscribeOption struct {
+	Buffer int                // 允许积压的未读事件数，默认 64；晚加入的订阅者回放历史事件时不受此限制
+	Policy SlowConsumerPolicy // 积压超过 Buffer 时的处理方式
+}
+
+// Broadcaster 将一个 ChatMessage 流分发给多个订阅者
+//
+// 每个订阅者有独立的积压上限和慢消费策略，晚加入的订阅者会先收到本条消息已产生的全部事件。
+//
+//	b := dify.NewBroadcaster()
+//	browser := b.Subscribe(dify.SubscribeOption{Policy: dify.SlowConsumerDisconnect})
+//	audit := b.Subscribe(dify.SubscribeOption{Policy: dify.SlowConsumerBlock})
+//	go b.Run(dify.NewChatMessageStream(ctx, client, option))
+type Broadcaster struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	history     []ChatMessageRespSSEData
+	subscribers map[*Subscription]struct{}
+	closed      bool
+	err         error
+}
+
+func NewBroadcaster() *Broadcaster {
+	b := &Broadcaster{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Run 读取 stream 的全部事件并分发，流结束后关闭广播，返回流的错误
+func (b *Broadcaster) Run(stream *ChatMessageStream) error {
+	for {
+		ev, recvErr := stream.Recv()
+		if recvErr == io.EOF {
+			b.Close(nil)
+			return nil
+		}
+		if recvErr != nil {
+			b.Close(recvErr)
+			return recvErr
+		}
+		b.Publish(ev)
+	}
+}
+
+// Publish 分发一个事件，可以直接作为 ChatMessageOption.OnEvent
+func (b *Broadcaster) Publish(ev ChatMessageRespSSEData) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.history = append(b.history, ev)
+	for sub := range b.subscribers {
+		if sub.closed || sub.cursor < sub.base || sub.lag(len(b.history)) <= sub.buffer {
+			// 回放中的订阅者暂不丢弃或断开
+			continue
+		}
+		switch sub.policy {
+		case SlowConsumerDrop:
+			skip := len(b.history) - sub.buffer
+			sub.dropped += skip - sub.cursor
+			sub.cursor = skip
+		case SlowConsumerDisconnect:
+			sub.closeLocked(ErrSlowConsumer)
+		}
+	}
+	b.cond.Broadcast()
+
+	// 阻塞策略的订阅者积压过多时等待其读取
+	for {
+		waiting := false
+		for sub := range b.subscribers {
+			if sub.policy == SlowConsumerBlock && !sub.closed && sub.lag(len(b.history)) > sub.buffer {
+				waiting = true
+				break
+			}
+		}
+		if !waiting {
+			return
+		}
+		b.cond.Wait()
+	}
+}
+
+// Close 结束广播，订阅者读完剩余事件后其通道关闭，Err 返回 err
+func (b *Broadcaster) Close(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.err = err
+	b.cond.Broadcast()
+}
+
+// Subscribe 添加订阅者，从本条消息的第一个事件开始接收
+func (b *Broadcaster) Subscribe(option SubscribeOption) *Subscription {
+	if option.Buffer <= 0 {
+		option.Buffer = 64
+	}
+	ch := make(chan ChatMessageRespSSEData)
+	sub := &Subscription{
+		C:           ch,
+		broadcaster: b,
+		ch:          ch,
+		buffer:      option.Buffer,
+		policy:      option.Policy,
+		done:        make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	sub.base = len(b.history)
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go sub.deliver()
+	return sub
+}
+
+// Subscription 一个订阅者
+type Subscription struct {
+	C <-chan ChatMessageRespSSEData // 事件通道，广播结束或订阅断开后关闭
+
+	broadcaster *Broadcaster
+	ch          chan ChatMessageRespSSEData
+	buffer      int
+	policy      SlowConsumerPolicy
+	done        chan struct{}
+
+	// 以下字段由 broadcaster.mu 保护
+	base    int // 订阅时已有的事件数，回放这些事件不计入积压
+	cursor  int // 下一个要投递的事件下标
+	dropped int
+	closed  bool
+	err     error
+}
+
+// lag 订阅时之后产生但尚未投递的事件数，调用方需持有锁
+func (s *Subscription) lag(total int) int {
+	return total - max(s.cursor, s.base)
+}
+
+// closeLocked 断开订阅，调用方需持有锁
+func (s *Subscription) closeLocked(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	close(s.done)
+	delete(s.broadcaster.subscribers, s)
+	s.broadcaster.cond.Broadcast()
+}
+
+func (s *Subscription) deliver() {
+	b := s.broadcaster
+	defer close(s.ch)
+	for {
+		b.mu.Lock()
+		for !s.closed && s.cursor >= len(b.history) && !b.closed {
+			b.cond.Wait()
+		}
+		if s.closed {
+			b.mu.Unlock()
+			return
+		}
+		if s.cursor >= len(b.history) {
+			// 广播已结束且事件已全部投递
+			s.closeLocked(b.err)
+			b.mu.Unlock()
+			return
+		}
+		ev := b.history[s.cursor]
+		s.cursor++
+		b.cond.Broadcast()
+		b.mu.Unlock()
+
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.broadcaster.mu.Lock()
+	defer s.broadcaster.mu.Unlock()
+	s.closeLocked(nil)
+}
+
+// Err 返回订阅结束的原因：ErrSlowConsumer、上游流的错误，正常结束时为 nil
+func (s *Subscription) Err() error {
+	s.broadcaster.mu.Lock()
+	defer s.broadcaster.mu.Unlock()
+	return s.err
+}
+
+// Dropped 返回因 SlowConsumerDrop 策略丢弃的事件数
+func (s *Subscription) Dropped() int {
+	s.broadcaster.mu.Lock()
+	defer s.broadcaster.mu.Unlock()
+	return s.dropped
+}
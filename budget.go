@@ -0,0 +1,226 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// errBudgetNoStore 设置了没有 Store 的 BudgetPolicy
+var errBudgetNoStore = errors.New("budgetErr: BudgetPolicy.Store is nil")
+
+// BudgetPeriod 预算的统计周期
+type BudgetPeriod int
+
+const (
+	BudgetPeriodDaily   BudgetPeriod = iota // 按自然日
+	BudgetPeriodMonthly                     // 按自然月
+)
+
+// BudgetLimit 一个用户在一个周期内的额度，0 表示不限
+type BudgetLimit struct {
+	MaxTokens int64
+	MaxPrice  float64 // 费用上限，与 Usage.Currency 相同币种
+}
+
+// BudgetSpend 已用额度
+type BudgetSpend struct {
+	Tokens int64
+	Price  float64
+}
+
+// BudgetStore 保存用户在每个周期内的已用额度
+type BudgetStore interface {
+	// Spent 返回 key 的已用额度，不存在时返回零值
+	Spent(ctx context.Context, key string) (BudgetSpend, error)
+	// Debit 原子地累加已用额度，ttl 后 key 可以过期
+	Debit(ctx context.Context, key string, spend BudgetSpend, ttl time.Duration) error
+}
+
+// BudgetPolicy 调用 ChatMessage 前检查用户额度，消息结束后扣减实际用量
+//
+// 额度按应用名和用户统计，应用名见 ClientConfig.AppNames，未配置时为完整密钥的哈希，不同密钥互不影响。
+type BudgetPolicy struct {
+	Store     BudgetStore // 必填
+	Period    BudgetPeriod
+	Location  *time.Location                                                 // 周期的时区，默认 time.Local
+	Default   BudgetLimit                                                    // 默认额度
+	LimitFor  func(ctx context.Context, app string, user string) BudgetLimit // 可选，按应用和用户返回额度，优先于 Default
+	KeyPrefix string                                                         // 存储 key 的前缀，默认 dify:budget:
+}
+
+// key 返回用户在当前周期的存储 key 及其剩余有效期
+func (p *BudgetPolicy) key(app string, user string, now time.Time) (string, time.Duration) {
+	location := p.Location
+	if location == nil {
+		location = time.Local
+	}
+	prefix := p.KeyPrefix
+	if prefix == "" {
+		prefix = "dify:budget:"
+	}
+
+	now = now.In(location)
+	var period string
+	var end time.Time
+	switch p.Period {
+	case BudgetPeriodMonthly:
+		period = now.Format("200601")
+		end = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, location)
+	default:
+		period = now.Format("20060102")
+		end = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location)
+	}
+	return prefix + app + ":" + user + ":" + period, end.Sub(now)
+}
+
+func (p *BudgetPolicy) limit(ctx context.Context, app string, user string) BudgetLimit {
+	if p.LimitFor != nil {
+		return p.LimitFor(ctx, app, user)
+	}
+	return p.Default
+}
+
+// check 额度用尽时返回 ErrBudgetExceeded
+func (p *BudgetPolicy) check(ctx context.Context, app string, user string) error {
+	limit := p.limit(ctx, app, user)
+	if limit.MaxTokens <= 0 && limit.MaxPrice <= 0 {
+		return nil
+	}
+	if p.Store == nil {
+		return errBudgetNoStore
+	}
+	key, _ := p.key(app, user, time.Now())
+	spent, spentErr := p.Store.Spent(ctx, key)
+	if spentErr != nil {
+		return fmt.Errorf("budgetSpentErr: %w", spentErr)
+	}
+	if limit.MaxTokens > 0 && spent.Tokens >= limit.MaxTokens {
+		return fmt.Errorf("%w: user %s used %d of %d tokens", ErrBudgetExceeded, user, spent.Tokens, limit.MaxTokens)
+	}
+	if limit.MaxPrice > 0 && spent.Price >= limit.MaxPrice {
+		return fmt.Errorf("%w: user %s spent %.6f of %.6f", ErrBudgetExceeded, user, spent.Price, limit.MaxPrice)
+	}
+	return nil
+}
+
+// debit 扣减一条消息的实际用量
+func (p *BudgetPolicy) debit(ctx context.Context, record UsageRecord) error {
+	if p.Store == nil {
+		return errBudgetNoStore
+	}
+	key, ttl := p.key(record.App, record.User, record.CreatedAt)
+	price, _ := strconv.ParseFloat(record.Usage.TotalPrice, 64)
+	return p.Store.Debit(ctx, key, BudgetSpend{Tokens: int64(record.Usage.TotalTokens), Price: price}, ttl)
+}
+
+// MemoryBudgetStore 进程内的额度存储，适用于单实例部署
+type MemoryBudgetStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryBudgetEntry
+}
+
+type memoryBudgetEntry struct {
+	spend    BudgetSpend
+	expireAt time.Time
+}
+
+var _ BudgetStore = (*MemoryBudgetStore)(nil)
+
+func NewMemoryBudgetStore() *MemoryBudgetStore {
+	return &MemoryBudgetStore{
+		entries: make(map[string]*memoryBudgetEntry),
+	}
+}
+
+func (s *MemoryBudgetStore) Spent(_ context.Context, key string) (BudgetSpend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.expireAt) {
+		return BudgetSpend{}, nil
+	}
+	return entry.spend, nil
+}
+
+func (s *MemoryBudgetStore) Debit(_ context.Context, key string, spend BudgetSpend, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range s.entries {
+		if now.After(entry.expireAt) {
+			delete(s.entries, k)
+		}
+	}
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryBudgetEntry{}
+		s.entries[key] = entry
+	}
+	entry.spend.Tokens += spend.Tokens
+	entry.spend.Price += spend.Price
+	entry.expireAt = now.Add(ttl)
+	return nil
+}
+
+// RedisClient 额度存储所需的 Redis 命令，可以用 go-redis 等客户端简单适配
+type RedisClient interface {
+	// Get 返回 key 的值，key 不存在时返回空字符串和 nil
+	Get(ctx context.Context, key string) (string, error)
+	IncrBy(ctx context.Context, key string, value int64) (int64, error)
+	IncrByFloat(ctx context.Context, key string, value float64) (float64, error)
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// RedisBudgetStore 基于 Redis 的额度存储，多实例共享，使用 INCRBY 保证扣减的原子性
+type RedisBudgetStore struct {
+	client RedisClient
+}
+
+var _ BudgetStore = (*RedisBudgetStore)(nil)
+
+func NewRedisBudgetStore(client RedisClient) *RedisBudgetStore {
+	return &RedisBudgetStore{client: client}
+}
+
+func (s *RedisBudgetStore) Spent(ctx context.Context, key string) (spend BudgetSpend, err error) {
+	tokens, getErr := s.client.Get(ctx, key+":tokens")
+	if getErr != nil {
+		err = fmt.Errorf("redisGetErr: %w", getErr)
+		return
+	}
+	price, getErr := s.client.Get(ctx, key+":price")
+	if getErr != nil {
+		err = fmt.Errorf("redisGetErr: %w", getErr)
+		return
+	}
+	if tokens != "" {
+		spend.Tokens, _ = strconv.ParseInt(tokens, 10, 64)
+	}
+	if price != "" {
+		spend.Price, _ = strconv.ParseFloat(price, 64)
+	}
+	return
+}
+
+func (s *RedisBudgetStore) Debit(ctx context.Context, key string, spend BudgetSpend, ttl time.Duration) error {
+	if _, incrErr := s.client.IncrBy(ctx, key+":tokens", spend.Tokens); incrErr != nil {
+		return fmt.Errorf("redisIncrByErr: %w", incrErr)
+	}
+	if _, incrErr := s.client.IncrByFloat(ctx, key+":price", spend.Price); incrErr != nil {
+		return fmt.Errorf("redisIncrByFloatErr: %w", incrErr)
+	}
+	if expireErr := s.client.Expire(ctx, key+":tokens", ttl); expireErr != nil {
+		return fmt.Errorf("redisExpireErr: %w", expireErr)
+	}
+	if expireErr := s.client.Expire(ctx, key+":price", ttl); expireErr != nil {
+		return fmt.Errorf("redisExpireErr: %w", expireErr)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBudgetPolicyKey(t *testing.T) {
+	location := time.FixedZone("UTC+8", 8*60*60)
+	now := time.Date(2026, 1, 31, 22, 0, 0, 0, location)
+
+	tests := []struct {
+		name    string
+		policy  BudgetPolicy
+		wantKey string
+		wantTTL time.Duration
+	}{
+		{name: "daily", policy: BudgetPolicy{Location: location}, wantKey: "dify:budget:support:user-1:20260131", wantTTL: 2 * time.Hour},
+		{name: "monthly", policy: BudgetPolicy{Location: location, Period: BudgetPeriodMonthly}, wantKey: "dify:budget:support:user-1:202601", wantTTL: 2 * time.Hour},
+		{name: "time zone", policy: BudgetPolicy{Location: time.UTC}, wantKey: "dify:budget:support:user-1:20260131", wantTTL: 10 * time.Hour},
+		{name: "prefix", policy: BudgetPolicy{Location: location, KeyPrefix: "quota:"}, wantKey: "quota:support:user-1:20260131", wantTTL: 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ttl := tt.policy.key("support", "user-1", now)
+			if key != tt.wantKey || ttl != tt.wantTTL {
+				t.Errorf("key() = %s, %s, want %s, %s", key, ttl, tt.wantKey, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestBudgetPolicyCheck(t *testing.T) {
+	ctx := context.Background()
+	policy := &BudgetPolicy{
+		Store:   NewMemoryBudgetStore(),
+		Default: BudgetLimit{MaxTokens: 10},
+		LimitFor: func(ctx context.Context, app string, user string) BudgetLimit {
+			if user == "vip" {
+				return BudgetLimit{MaxPrice: 1}
+			}
+			return BudgetLimit{MaxTokens: 10}
+		},
+	}
+	debit := func(user string, tokens int, price string) {
+		t.Helper()
+		err := policy.debit(ctx, UsageRecord{App: "support", User: user, CreatedAt: time.Now(), Usage: Usage{TotalTokens: tokens, TotalPrice: price}})
+		if err != nil {
+			t.Fatalf("debit() error = %v", err)
+		}
+	}
+
+	debit("user-1", 9, "0")
+	if err := policy.check(ctx, "support", "user-1"); err != nil {
+		t.Fatalf("check() under the limit error = %v", err)
+	}
+	debit("user-1", 1, "0")
+	if err := policy.check(ctx, "support", "user-1"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("check() at the limit error = %v, want ErrBudgetExceeded", err)
+	}
+	if err := policy.check(ctx, "sales", "user-1"); err != nil {
+		t.Errorf("check() for another app error = %v", err)
+	}
+
+	debit("vip", 1000, "0.6")
+	if err := policy.check(ctx, "support", "vip"); err != nil {
+		t.Fatalf("check() under the price limit error = %v", err)
+	}
+	debit("vip", 1, "0.4")
+	if err := policy.check(ctx, "support", "vip"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("check() at the price limit error = %v, want ErrBudgetExceeded", err)
+	}
+}
+
+// newUsageServer 返回一个阻塞回答对话消息的服务，每条消息消耗 tokens 个 token
+func newUsageServer(t *testing.T, tokens int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"event":"message","conversation_id":"conv-1","answer":"ok","metadata":{"usage":{"total_tokens":%d}}}`, tokens)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientBudgetPerApiKey(t *testing.T) {
+	server := newUsageServer(t, 6)
+	client := NewClient(server.URL, WithBudgetPolicy(BudgetPolicy{
+		Store:   NewMemoryBudgetStore(),
+		Default: BudgetLimit{MaxTokens: 10},
+	}))
+	chat := func(apiKey string) error {
+		_, err := client.ChatMessage(context.Background(), ChatMessageOption{
+			ApiKey:      apiKey,
+			RequestBody: ChatMessageReq{Query: "hi", ResponseMode: ResponseModeBlocking, User: "user-1"},
+		})
+		return err
+	}
+
+	// 首尾相同的两个密钥分别计算额度
+	for _, apiKey := range []string{"app-abcd1111wxyz", "app-abcd1111wxyz", "app-abcd2222wxyz"} {
+		if err := chat(apiKey); err != nil {
+			t.Fatalf("ChatMessage(%s) error = %v", apiKey, err)
+		}
+	}
+	if err := chat("app-abcd1111wxyz"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("ChatMessage() over budget error = %v, want ErrBudgetExceeded", err)
+	}
+	if err := chat("app-abcd2222wxyz"); err != nil {
+		t.Errorf("ChatMessage() with the other key error = %v", err)
+	}
+}
+
+func TestBudgetPolicyWithoutStore(t *testing.T) {
+	policy := BudgetPolicy{Default: BudgetLimit{MaxTokens: 10}}
+	clients := []struct {
+		name   string
+		client ClientI
+	}{
+		{name: "option", client: NewClient("http://127.0.0.1:0", WithBudgetPolicy(policy))},
+		{name: "config", client: NewClientWithConfig(ClientConfig{ApiBaseUrl: "http://127.0.0.1:0", BudgetPolicy: &policy})},
+	}
+	for _, tt := range clients {
+		t.Run(tt.name, func(t *testing.T) {
+			// 没有 Store 时返回错误而不是 panic
+			_, err := tt.client.ChatMessage(context.Background(), ChatMessageOption{
+				ApiKey:      "app-test",
+				RequestBody: ChatMessageReq{Query: "hi", ResponseMode: ResponseModeBlocking, User: "user-1"},
+			})
+			if !errors.Is(err, errBudgetNoStore) {
+				t.Errorf("ChatMessage() error = %v, want errBudgetNoStore", err)
+			}
+		})
+	}
+}
+
+// fakeRedis 在内存中实现 RedisClient
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+	ttls   map[string]time.Duration
+}
+
+func (r *fakeRedis) Get(_ context.Context, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.values[key], nil
+}
+
+func (r *fakeRedis) IncrBy(_ context.Context, key string, value int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, _ := strconv.ParseInt(r.values[key], 10, 64)
+	current += value
+	r.values[key] = strconv.FormatInt(current, 10)
+	return current, nil
+}
+
+func (r *fakeRedis) IncrByFloat(_ context.Context, key string, value float64) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, _ := strconv.ParseFloat(r.values[key], 64)
+	current += value
+	r.values[key] = strconv.FormatFloat(current, 'f', -1, 64)
+	return current, nil
+}
+
+func (r *fakeRedis) Expire(_ context.Context, key string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ttls[key] = ttl
+	return nil
+}
+
+func TestBudgetStores(t *testing.T) {
+	redis := &fakeRedis{values: make(map[string]string), ttls: make(map[string]time.Duration)}
+	stores := map[string]BudgetStore{
+		"memory": NewMemoryBudgetStore(),
+		"redis":  NewRedisBudgetStore(redis),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if spent, err := store.Spent(ctx, "k"); err != nil || spent != (BudgetSpend{}) {
+				t.Fatalf("Spent() of a new key = %+v, %v", spent, err)
+			}
+			for _, spend := range []BudgetSpend{{Tokens: 3, Price: 0.25}, {Tokens: 4, Price: 0.5}} {
+				if err := store.Debit(ctx, "k", spend, time.Hour); err != nil {
+					t.Fatalf("Debit() error = %v", err)
+				}
+			}
+			if spent, err := store.Spent(ctx, "k"); err != nil || spent != (BudgetSpend{Tokens: 7, Price: 0.75}) {
+				t.Errorf("Spent() = %+v, %v, want 7 tokens and 0.75", spent, err)
+			}
+		})
+	}
+	if redis.ttls["k:tokens"] != time.Hour || redis.ttls["k:price"] != time.Hour {
+		t.Errorf("redis ttls = %v", redis.ttls)
+	}
+
+	memory := NewMemoryBudgetStore()
+	_ = memory.Debit(context.Background(), "expired", BudgetSpend{Tokens: 1}, -time.Second)
+	if spent, _ := memory.Spent(context.Background(), "expired"); spent.Tokens != 0 {
+		t.Errorf("Spent() of an expired key = %+v, want zero", spent)
+	}
+}
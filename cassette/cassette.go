@@ -0,0 +1,587 @@
+// Package cassette 录制与回放客户端的 HTTP 交互，用于在 CI 中离线、确定性地测试
+//
+// 录制模式下请求转发给真实的 Dify 服务，交互保存到夹具文件，其中密钥和用户标识会被脱敏；
+// 回放模式下按方法、路径（含查询参数）和规范化后的请求体依次匹配已录制的交互，不访问网络。
+// 流式响应按原始片段和时间间隔保存，文件名以 .gz 结尾时使用 gzip 压缩：
+//
+//	mode := cassette.ModeReplay
+//	if os.Getenv("DIFY_RECORD") != "" {
+//		mode = cassette.ModeRecord
+//	}
+//	recorder, err := cassette.New(cassette.Option{Path: "testdata/chat.json.gz", Mode: mode})
+//	defer recorder.Close()
+//	client := dify.NewClientWithConfig(dify.ClientConfig{ApiBaseUrl: apiUrl, HttpClient: recorder.Client()})
+package cassette
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrNoInteraction 回放时没有与请求匹配的交互
+var ErrNoInteraction = errors.New("cassette: no matching interaction")
+
+const (
+	redacted     = "<redacted>"
+	scrubbedUser = "<user>"
+)
+
+// Mode 录制或回放
+type Mode int
+
+const (
+	ModeReplay Mode = iota // 只从夹具文件回放，不访问网络
+	ModeRecord             // 转发请求并录制，Close 时写入夹具文件
+)
+
+// Option Recorder 配置
+type Option struct {
+	Path      string            // 夹具文件路径，以 .gz 结尾时使用 gzip 压缩
+	Mode      Mode              // 默认 ModeReplay
+	Transport http.RoundTripper // 录制时使用的底层传输，默认 http.DefaultTransport
+	Secrets   []string          // 额外需要脱敏的字符串，在请求和响应中全部替换；请求头中的密钥总是会被去掉
+	Realtime  bool              // 回放流式响应时按录制时的间隔发送片段，默认立即发送
+}
+
+// Cassette 夹具文件的内容
+type Cassette struct {
+	Version      int            `json:"version"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction 一次请求及其响应
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request 录制的请求，已脱敏
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`           // 路径，含规范化后的查询参数
+	Body   string `json:"body,omitempty"` // 规范化后的请求体
+}
+
+// Response 录制的响应，流式响应保存在 Chunks 中
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	Chunks     []Chunk     `json:"chunks,omitempty"`
+}
+
+// Chunk 流式响应的一个片段
+type Chunk struct {
+	DelayMs int64  `json:"delay_ms"` // 距上一个片段的时间
+	Data    string `json:"data"`
+}
+
+// Recorder 录制或回放交互的 http.RoundTripper
+type Recorder struct {
+	option Option
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool   // 回放时已使用的交互
+	users    []string // 录制时请求中出现的用户标识
+	closed   bool
+}
+
+var _ http.RoundTripper = (*Recorder)(nil)
+
+// New 创建 Recorder，回放模式下读取夹具文件
+func New(option Option) (*Recorder, error) {
+	if option.Path == "" {
+		return nil, errors.New("cassette: path is required")
+	}
+	if option.Transport == nil {
+		option.Transport = http.DefaultTransport
+	}
+	r := &Recorder{option: option, cassette: Cassette{Version: 1}}
+	if option.Mode == ModeReplay {
+		cassette, err := Load(option.Path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = *cassette
+		r.used = make([]bool, len(cassette.Interactions))
+	}
+	return r, nil
+}
+
+// Load 读取夹具文件
+func Load(path string) (*Cassette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("openErr: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, gzipErr := gzip.NewReader(file)
+		if gzipErr != nil {
+			return nil, fmt.Errorf("gzipErr: %w", gzipErr)
+		}
+		defer func() {
+			_ = gzipReader.Close()
+		}()
+		reader = gzipReader
+	}
+
+	var cassette Cassette
+	decodeErr := json.NewDecoder(reader).Decode(&cassette)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("decodeErr: %w", decodeErr)
+	}
+	return &cassette, nil
+}
+
+// Client 返回使用该 Recorder 的 http.Client，用于 ClientConfig.HttpClient
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Interactions 返回录制或加载的交互
+func (r *Recorder) Interactions() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.cassette.Interactions)
+}
+
+// Unused 返回回放时尚未使用的交互数，可用于断言测试走完了录制的流程
+func (r *Recorder) Unused() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unused := 0
+	for _, used := range r.used {
+		if !used {
+			unused++
+		}
+	}
+	return unused
+}
+
+// Close 录制模式下脱敏并写入夹具文件，回放模式下不做处理
+//
+// 应在所有响应体读取完毕后调用，未读完的流式响应只保存已读到的部分。
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.option.Mode != ModeRecord {
+		r.closed = true
+		return nil
+	}
+	r.closed = true
+
+	for _, interaction := range r.cassette.Interactions {
+		interaction.Request.Path = r.scrub(interaction.Request.Path)
+		interaction.Request.Body = r.scrub(interaction.Request.Body)
+		interaction.Response.Body = r.scrubUsers(r.scrub(interaction.Response.Body))
+		for i := range interaction.Response.Chunks {
+			interaction.Response.Chunks[i].Data = r.scrubUsers(r.scrub(interaction.Response.Chunks[i].Data))
+		}
+	}
+	return r.save()
+}
+
+// save 原子地写入夹具文件，调用方需持有锁
+func (r *Recorder) save() error {
+	path := r.option.Path
+	mkdirErr := os.MkdirAll(filepath.Dir(path), 0o755)
+	if mkdirErr != nil {
+		return fmt.Errorf("mkdirErr: %w", mkdirErr)
+	}
+
+	var buffer bytes.Buffer
+	var writer io.Writer = &buffer
+	var gzipWriter *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		gzipWriter = gzip.NewWriter(&buffer)
+		writer = gzipWriter
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encodeErr := encoder.Encode(r.cassette)
+	if encodeErr != nil {
+		return fmt.Errorf("encodeErr: %w", encodeErr)
+	}
+	if gzipWriter != nil {
+		closeErr := gzipWriter.Close()
+		if closeErr != nil {
+			return fmt.Errorf("gzipErr: %w", closeErr)
+		}
+	}
+
+	temp := path + ".tmp"
+	writeErr := os.WriteFile(temp, buffer.Bytes(), 0o644)
+	if writeErr != nil {
+		return fmt.Errorf("writeErr: %w", writeErr)
+	}
+	return os.Rename(temp, path)
+}
+
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		var readErr error
+		body, readErr = io.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if readErr != nil {
+			return nil, fmt.Errorf("readAllErr: %w", readErr)
+		}
+	}
+
+	if r.option.Mode == ModeRecord {
+		return r.record(request, body)
+	}
+	return r.replay(request, body)
+}
+
+func (r *Recorder) record(request *http.Request, body []byte) (*http.Response, error) {
+	// 按发起顺序保存，响应在读取过程中补全
+	normalized, user := normalize(request, body)
+	interaction := &Interaction{Request: normalized}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, errors.New("cassette: recorder is closed")
+	}
+	if user != "" && !slices.Contains(r.users, user) {
+		r.users = append(r.users, user)
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	forwarded := request.Clone(request.Context())
+	forwarded.Body = http.NoBody
+	if len(body) > 0 {
+		forwarded.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	forwarded.ContentLength = int64(len(body))
+	response, err := r.option.Transport.RoundTrip(forwarded)
+	if err != nil {
+		r.mu.Lock()
+		r.cassette.Interactions = slices.DeleteFunc(r.cassette.Interactions, func(i *Interaction) bool {
+			return i == interaction
+		})
+		r.mu.Unlock()
+		return nil, err
+	}
+
+	r.mu.Lock()
+	interaction.Response.StatusCode = response.StatusCode
+	interaction.Response.Header = recordedHeader(response.Header)
+	r.mu.Unlock()
+	response.Body = &recordingBody{
+		ReadCloser: response.Body,
+		recorder:   r,
+		response:   &interaction.Response,
+		streaming:  isEventStream(response.Header),
+		last:       time.Now(),
+	}
+	return response, nil
+}
+
+// recordingBody 在读取响应体的同时保存内容，流式响应按每次读到的片段和间隔保存
+//
+// 片段以字符串写入 JSON，读取时被截断的多字节字符留到下一个片段，避免保存为 U+FFFD。
+type recordingBody struct {
+	io.ReadCloser
+	recorder  *Recorder
+	response  *Response
+	streaming bool
+	last      time.Time
+	partial   []byte // 上次读取末尾不完整的字符
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if b.streaming {
+			data := append(b.partial, p[:n]...)
+			complete := completeRunes(data)
+			b.partial = slices.Clone(data[complete:])
+			b.appendChunk(data[:complete])
+		} else {
+			b.recorder.mu.Lock()
+			b.response.Body += string(p[:n])
+			b.recorder.mu.Unlock()
+		}
+	}
+	if err != nil {
+		b.flush()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.flush()
+	return b.ReadCloser.Close()
+}
+
+// flush 保存剩余的不完整字符，响应结束时调用
+func (b *recordingBody) flush() {
+	b.appendChunk(b.partial)
+	b.partial = nil
+}
+
+func (b *recordingBody) appendChunk(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	now := time.Now()
+	b.recorder.mu.Lock()
+	b.response.Chunks = append(b.response.Chunks, Chunk{
+		DelayMs: now.Sub(b.last).Milliseconds(),
+		Data:    string(data),
+	})
+	b.recorder.mu.Unlock()
+	b.last = now
+}
+
+// completeRunes 返回 data 中以完整字符结尾的前缀长度
+func completeRunes(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if utf8.FullRune(data[i:]) {
+				return len(data)
+			}
+			return i
+		}
+	}
+	return len(data)
+}
+
+func (r *Recorder) replay(request *http.Request, body []byte) (*http.Response, error) {
+	normalized, _ := normalize(request, body)
+
+	r.mu.Lock()
+	var interaction *Interaction
+	for i, candidate := range r.cassette.Interactions {
+		if r.used[i] || !matches(candidate.Request, normalized) {
+			continue
+		}
+		r.used[i] = true
+		interaction = candidate
+		break
+	}
+	r.mu.Unlock()
+	if interaction == nil {
+		return nil, fmt.Errorf("%w: %s %s %s", ErrNoInteraction, normalized.Method, normalized.Path, normalized.Body)
+	}
+
+	header := interaction.Response.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	var responseBody io.ReadCloser
+	if len(interaction.Response.Chunks) > 0 {
+		responseBody = &replayingBody{
+			ctx:      request.Context(),
+			chunks:   interaction.Response.Chunks,
+			realtime: r.option.Realtime,
+		}
+	} else {
+		responseBody = io.NopCloser(strings.NewReader(interaction.Response.Body))
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+		StatusCode:    interaction.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          responseBody,
+		ContentLength: -1,
+		Request:       request,
+	}, nil
+}
+
+// replayingBody 依次返回录制的片段，Realtime 时按录制的间隔等待
+type replayingBody struct {
+	ctx      context.Context
+	chunks   []Chunk
+	realtime bool
+	pending  string
+	closed   bool
+}
+
+func (b *replayingBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("cassette: read on closed body")
+	}
+	for b.pending == "" {
+		if len(b.chunks) == 0 {
+			return 0, io.EOF
+		}
+		chunk := b.chunks[0]
+		b.chunks = b.chunks[1:]
+		if b.realtime && chunk.DelayMs > 0 {
+			timer := time.NewTimer(time.Duration(chunk.DelayMs) * time.Millisecond)
+			select {
+			case <-timer.C:
+			case <-b.ctx.Done():
+				timer.Stop()
+				return 0, b.ctx.Err()
+			}
+		}
+		b.pending = chunk.Data
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+func (b *replayingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// scrub 替换交互中出现的 Secrets，请求中的用户标识已在 normalize 中按字段替换，调用方需持有锁
+func (r *Recorder) scrub(s string) string {
+	for _, secret := range r.option.Secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	return s
+}
+
+// scrubUsers 将响应中值恰好为请求用户标识的 JSON 字符串替换为 "<user>"，不改动包含该标识的其他文本，调用方需持有锁
+func (r *Recorder) scrubUsers(s string) string {
+	for _, user := range r.users {
+		s = strings.ReplaceAll(s, quote(user), quote(scrubbedUser))
+	}
+	return s
+}
+
+// quote 返回 s 的 JSON 字符串形式
+func quote(s string) string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	return strings.TrimSpace(buffer.String())
+}
+
+// matches 判断录制的请求与当前请求是否相同
+func matches(recorded Request, request Request) bool {
+	return recorded.Method == request.Method && recorded.Path == request.Path && recorded.Body == request.Body
+}
+
+// normalize 将请求转换为可比较的形式
+//
+// 查询参数排序，JSON 请求体按键排序，multipart 请求体忽略随机的分隔符，文件内容以摘要表示；
+// 查询参数、JSON 字段和表单字段中的 user 统一替换为 <user>，其他内容保持不变，替换前的用户标识作为 user 返回。
+// 请求头不保存，因此密钥不会写入夹具文件。
+func normalize(request *http.Request, body []byte) (normalized Request, user string) {
+	query := request.URL.Query()
+	if user = query.Get("user"); user != "" {
+		query.Set("user", scrubbedUser)
+	}
+	path := request.URL.Path
+	if len(query) > 0 {
+		path += "?" + strings.ReplaceAll(query.Encode(), url.QueryEscape(scrubbedUser), scrubbedUser)
+	}
+
+	normalized = Request{Method: request.Method, Path: path}
+	if len(body) == 0 {
+		return normalized, user
+	}
+
+	bodyUser := ""
+	mediaType, params, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "multipart/form-data":
+		normalized.Body, bodyUser = normalizeMultipart(body, params["boundary"])
+	case mediaType == "application/json" || json.Valid(body):
+		normalized.Body, bodyUser = normalizeJSON(body)
+	default:
+		normalized.Body = "sha256:" + digest(body)
+	}
+	if bodyUser != "" {
+		user = bodyUser
+	}
+	return normalized, user
+}
+
+func normalizeJSON(body []byte) (normalized string, user string) {
+	var value any
+	if json.Unmarshal(body, &value) != nil {
+		return "sha256:" + digest(body), ""
+	}
+	if object, ok := value.(map[string]any); ok {
+		if user, _ = object["user"].(string); user != "" {
+			object["user"] = scrubbedUser
+		}
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+	return strings.TrimSpace(buffer.String()), user
+}
+
+func normalizeMultipart(body []byte, boundary string) (normalized string, user string) {
+	var fields []string
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		content, _ := io.ReadAll(part)
+		if part.FileName() != "" {
+			fields = append(fields, fmt.Sprintf("%s=@%s;sha256:%s", part.FormName(), part.FileName(), digest(content)))
+			continue
+		}
+		value := string(content)
+		if part.FormName() == "user" && value != "" {
+			user, value = value, scrubbedUser
+		}
+		fields = append(fields, part.FormName()+"="+value)
+	}
+	slices.Sort(fields)
+	return "multipart:" + strings.Join(fields, "&"), user
+}
+
+// recordedHeader 保存响应头，去掉 Cookie 和随连接变化的字段
+func recordedHeader(header http.Header) http.Header {
+	recorded := header.Clone()
+	for _, key := range []string{"Set-Cookie", "Date", "Content-Length", "Connection", "Keep-Alive"} {
+		recorded.Del(key)
+	}
+	return recorded
+}
+
+func isEventStream(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,208 @@
+package cassette_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/cassette"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+// session 依次发起阻塞对话、流式对话、获取历史和上传文件，返回各步骤结果的摘要
+func session(t *testing.T, client dify.ClientI, user string) []string {
+	t.Helper()
+	ctx := context.Background()
+	blocking, err := client.ChatMessage(ctx, dify.ChatMessageOption{
+		ApiKey:      "app-secret",
+		RequestBody: dify.ChatMessageReq{Query: "alice in wonderland", ResponseMode: dify.ResponseModeBlocking, User: user},
+	})
+	if err != nil {
+		t.Fatalf("ChatMessage() error = %v", err)
+	}
+
+	var streamed strings.Builder
+	_, err = client.ChatMessage(ctx, dify.ChatMessageOption{
+		ApiKey: "app-secret",
+		OnEvent: func(ev dify.ChatMessageRespSSEData) {
+			streamed.WriteString(ev.Answer)
+		},
+		RequestBody: dify.ChatMessageReq{Query: "more", ResponseMode: dify.ResponseModeStreaming, ConversationId: blocking.ConversationId, User: user},
+	})
+	if err != nil {
+		t.Fatalf("ChatMessage() streaming error = %v", err)
+	}
+
+	messages, err := client.GetMessages(ctx, dify.GetMessagesOption{
+		ApiKey:        "app-secret",
+		RequestParams: dify.GetMessagesReq{ConversationId: blocking.ConversationId, User: user},
+	})
+	if err != nil {
+		t.Fatalf("GetMessages() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	uploaded, err := client.UploadFile(ctx, dify.UploadFileOption{
+		ApiKey:          "app-secret",
+		RequestFormData: dify.UploadFileReq{File: file, User: user},
+	})
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	return []string{blocking.Answer, streamed.String(), messages.Data[1].Answer, uploaded.Name}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := difytest.NewServer()
+	defer server.Close()
+	server.Enqueue(
+		difytest.Reply{Answer: "alice met token-123"},
+		difytest.Reply{Chunks: []string{"down ", "the hole"}},
+	)
+	path := filepath.Join(t.TempDir(), "testdata", "session.json.gz")
+
+	recorder, err := cassette.New(cassette.Option{Path: path, Mode: cassette.ModeRecord, Secrets: []string{"token-123"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := session(t, dify.NewClientWithConfig(dify.ClientConfig{ApiBaseUrl: server.URL, HttpClient: recorder.Client()}), "alice")
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	saved, err := cassette.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(saved.Interactions) != 4 {
+		t.Fatalf("interactions = %d, want 4", len(saved.Interactions))
+	}
+	chat, stream, messages, upload := saved.Interactions[0], saved.Interactions[1], saved.Interactions[2], saved.Interactions[3]
+	// 只替换 user 字段和参数，其他位置的同名文本保持不变
+	if !strings.Contains(chat.Request.Body, `"query":"alice in wonderland"`) || !strings.Contains(chat.Request.Body, `"user":"<user>"`) {
+		t.Errorf("chat request body = %s", chat.Request.Body)
+	}
+	if !strings.Contains(chat.Response.Body, "alice met <redacted>") {
+		t.Errorf("chat response body = %s", chat.Response.Body)
+	}
+	if len(stream.Response.Chunks) == 0 || stream.Response.Body != "" {
+		t.Errorf("stream response = %+v, want chunks", stream.Response)
+	}
+	if !strings.Contains(messages.Request.Path, "user=<user>") || strings.Contains(messages.Request.Path, "alice") {
+		t.Errorf("messages path = %s", messages.Request.Path)
+	}
+	if !strings.HasPrefix(upload.Request.Body, "multipart:") || !strings.Contains(upload.Request.Body, "user=<user>") || !strings.Contains(upload.Request.Body, "file=@notes.txt;sha256:") {
+		t.Errorf("upload body = %s", upload.Request.Body)
+	}
+	// 响应中回显的用户标识同样被替换，包含该标识的其他文本保持不变
+	if !strings.Contains(upload.Response.Body, `"created_by":"<user>"`) {
+		t.Errorf("upload response body = %s", upload.Response.Body)
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "app-secret") {
+		t.Error("cassette contains the api key")
+	}
+	if strings.Contains(string(data), `\"alice\"`) {
+		t.Error("cassette contains the user id")
+	}
+
+	// 回放不访问网络，用户标识不同也能匹配
+	server.Close()
+	replayer, err := cassette.New(cassette.Option{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dify.NewClientWithConfig(dify.ClientConfig{ApiBaseUrl: server.URL, HttpClient: replayer.Client()})
+	replayed := session(t, client, "bob")
+	if strings.Join(replayed, "|") != strings.Replace(strings.Join(recorded, "|"), "token-123", "<redacted>", 1) {
+		t.Errorf("replayed = %v, recorded = %v", replayed, recorded)
+	}
+	if unused := replayer.Unused(); unused != 0 {
+		t.Errorf("Unused() = %d, want 0", unused)
+	}
+
+	_, err = client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		ApiKey:      "app-secret",
+		RequestBody: dify.ChatMessageReq{Query: "not recorded", ResponseMode: dify.ResponseModeBlocking, User: "bob"},
+	})
+	if !errors.Is(err, cassette.ErrNoInteraction) {
+		t.Errorf("ChatMessage() error = %v, want ErrNoInteraction", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestRecordSplitRunes(t *testing.T) {
+	const body = "data: {\"answer\":\"你好\"}\n\n"
+	// 每次只读一个字节，多字节字符被拆到多次读取中
+	transport := roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/event-stream"}},
+			Body:       io.NopCloser(iotest.OneByteReader(strings.NewReader(body))),
+		}, nil
+	})
+	path := filepath.Join(t.TempDir(), "stream.json")
+	recorder, err := cassette.New(cassette.Option{Path: path, Mode: cassette.ModeRecord, Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := recorder.Client().Get("http://dify/v1/chat-messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	replayer, err := cassette.New(cassette.Option{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err = replayer.Client().Get("http://dify/v1/chat-messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if replayed, _ := io.ReadAll(response.Body); string(replayed) != body {
+		t.Errorf("replayed body = %q, want %q", replayed, body)
+	}
+}
+
+func TestNewReplayMissingFile(t *testing.T) {
+	if _, err := cassette.New(cassette.Option{Path: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("New() error = nil for a missing cassette")
+	}
+	if _, err := cassette.New(cassette.Option{}); err == nil {
+		t.Error("New() error = nil without a path")
+	}
+}
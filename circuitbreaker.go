@@ -0,0 +1,250 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState 熔断器状态
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // 闭合，请求正常放行
+	CircuitOpen                         // 打开，请求直接返回 ErrCircuitOpen
+	CircuitHalfOpen                     // 半开，放行少量试探请求
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerConfig 熔断器配置，每个 ApiBaseUrl 独立统计
+type CircuitBreakerConfig struct {
+	FailureRatio        float64                                                  // 失败率达到该值时打开熔断，默认 0.5
+	MinRequests         int                                                      // 统计窗口内请求数达到该值才判断失败率，默认 10
+	Interval            time.Duration                                            // 闭合状态下统计窗口的长度，默认 60 秒
+	CoolDown            time.Duration                                            // 打开后经过多久进入半开状态，默认 30 秒
+	HalfOpenMaxRequests int                                                      // 半开状态下允许同时进行的试探请求数，默认 1
+	IsFailure           func(response *http.Response, err error) bool            // 可选，判断一次请求是否失败，默认网络错误（主动取消除外）或 5xx 视为失败
+	OnStateChange       func(baseUrl string, from CircuitState, to CircuitState) // 可选，状态变化时回调
+}
+
+func (c CircuitBreakerConfig) withDefaults() CircuitBreakerConfig {
+	if c.FailureRatio <= 0 {
+		c.FailureRatio = 0.5
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 10
+	}
+	if c.Interval <= 0 {
+		c.Interval = 60 * time.Second
+	}
+	if c.CoolDown <= 0 {
+		c.CoolDown = 30 * time.Second
+	}
+	if c.HalfOpenMaxRequests <= 0 {
+		c.HalfOpenMaxRequests = 1
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = func(response *http.Response, err error) bool {
+			if err != nil {
+				// 调用方主动取消不算作后端故障
+				return !errors.Is(err, context.Canceled)
+			}
+			return response.StatusCode >= http.StatusInternalServerError
+		}
+	}
+	return c
+}
+
+type circuitBreakers struct {
+	config   CircuitBreakerConfig
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(config *CircuitBreakerConfig) *circuitBreakers {
+	if config == nil {
+		return nil
+	}
+	return &circuitBreakers{
+		config:   config.withDefaults(),
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+// get 返回 baseUrl 对应的熔断器，未启用熔断时返回 nil
+func (cbs *circuitBreakers) get(baseUrl string) *circuitBreaker {
+	if cbs == nil {
+		return nil
+	}
+	cbs.mu.Lock()
+	defer cbs.mu.Unlock()
+
+	breaker, ok := cbs.breakers[baseUrl]
+	if !ok {
+		breaker = &circuitBreaker{
+			baseUrl: baseUrl,
+			config:  &cbs.config,
+			expiry:  time.Now().Add(cbs.config.Interval),
+		}
+		cbs.breakers[baseUrl] = breaker
+	}
+	return breaker
+}
+
+type circuitBreaker struct {
+	baseUrl string
+	config  *CircuitBreakerConfig
+
+	mu         sync.Mutex
+	state      CircuitState
+	generation uint64
+	requests   int
+	failures   int
+	inFlight   int       // 半开状态下进行中的试探请求数
+	expiry     time.Time // 闭合状态为统计窗口结束时间，打开状态为进入半开的时间
+	changes    [][2]CircuitState
+}
+
+// allow 判断是否放行请求，放行时返回本次请求所属的代数，用于 done 时丢弃过期结果
+func (b *circuitBreaker) allow() (generation uint64, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.refresh(time.Now())
+	switch b.state {
+	case CircuitOpen:
+		err = ErrCircuitOpen
+		return
+	case CircuitHalfOpen:
+		if b.inFlight >= b.config.HalfOpenMaxRequests {
+			err = ErrCircuitOpen
+			return
+		}
+		b.inFlight++
+	}
+	b.requests++
+	generation = b.generation
+	return
+}
+
+// done 记录请求结果
+func (b *circuitBreaker) done(generation uint64, response *http.Response, err error) {
+	if b == nil {
+		return
+	}
+	failed := b.config.IsFailure(response, err)
+
+	b.mu.Lock()
+	defer b.unlock()
+
+	now := time.Now()
+	b.refresh(now)
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case CircuitClosed:
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.config.MinRequests && float64(b.failures)/float64(b.requests) >= b.config.FailureRatio {
+			b.setState(CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		b.inFlight--
+		if failed {
+			b.setState(CircuitOpen, now)
+		} else {
+			b.setState(CircuitClosed, now)
+		}
+	}
+}
+
+// abort 放弃一次已放行但未实际发出的请求
+func (b *circuitBreaker) abort(generation uint64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	b.requests--
+	if b.state == CircuitHalfOpen {
+		b.inFlight--
+	}
+}
+
+// refresh 处理统计窗口过期和冷却结束，调用方需持有锁
+func (b *circuitBreaker) refresh(now time.Time) {
+	switch b.state {
+	case CircuitClosed:
+		if now.After(b.expiry) {
+			b.newGeneration(now)
+		}
+	case CircuitOpen:
+		if now.After(b.expiry) {
+			b.setState(CircuitHalfOpen, now)
+		}
+	}
+}
+
+func (b *circuitBreaker) setState(state CircuitState, now time.Time) {
+	if b.state == state {
+		return
+	}
+	b.changes = append(b.changes, [2]CircuitState{b.state, state})
+	b.state = state
+	b.newGeneration(now)
+}
+
+// unlock 释放锁后再触发状态变化回调，避免回调中再次发起请求时死锁
+func (b *circuitBreaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	if b.config.OnStateChange == nil {
+		return
+	}
+	for _, change := range changes {
+		b.config.OnStateChange(b.baseUrl, change[0], change[1])
+	}
+}
+
+func (b *circuitBreaker) newGeneration(now time.Time) {
+	b.generation++
+	b.requests = 0
+	b.failures = 0
+	b.inFlight = 0
+	switch b.state {
+	case CircuitClosed:
+		b.expiry = now.Add(b.config.Interval)
+	case CircuitOpen:
+		b.expiry = now.Add(b.config.CoolDown)
+	default:
+		b.expiry = time.Time{}
+	}
+}
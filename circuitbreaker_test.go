@@ -0,0 +1,202 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	okResponse     = &http.Response{StatusCode: http.StatusOK}
+	failedResponse = &http.Response{StatusCode: http.StatusBadGateway}
+)
+
+func newTestBreaker(config CircuitBreakerConfig) (*circuitBreaker, *[]string) {
+	var changes []string
+	config.OnStateChange = func(baseUrl string, from CircuitState, to CircuitState) {
+		changes = append(changes, from.String()+"->"+to.String())
+	}
+	return newCircuitBreakers(&config).get("http://dify"), &changes
+}
+
+// send 放行并记录一次请求结果
+func send(t *testing.T, breaker *circuitBreaker, response *http.Response) {
+	t.Helper()
+	generation, err := breaker.allow()
+	if err != nil {
+		t.Fatalf("allow() error = %v", err)
+	}
+	breaker.done(generation, response, nil)
+}
+
+func TestCircuitBreakerOpensOnFailureRatio(t *testing.T) {
+	breaker, changes := newTestBreaker(CircuitBreakerConfig{FailureRatio: 0.5, MinRequests: 4, CoolDown: time.Hour})
+
+	send(t, breaker, failedResponse)
+	send(t, breaker, failedResponse)
+	send(t, breaker, okResponse)
+	if breaker.state != CircuitClosed {
+		t.Fatalf("state after 3 requests = %s, want closed until MinRequests", breaker.state)
+	}
+	send(t, breaker, okResponse)
+	if breaker.state != CircuitOpen {
+		t.Fatalf("state = %s, want open at 50%% failures", breaker.state)
+	}
+	if _, err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("allow() while open error = %v, want ErrCircuitOpen", err)
+	}
+	if len(*changes) != 1 || (*changes)[0] != "closed->open" {
+		t.Errorf("changes = %v", *changes)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name    string
+		probe   *http.Response
+		want    CircuitState
+		changes string
+	}{
+		{name: "successful probe closes", probe: okResponse, want: CircuitClosed, changes: "closed->open,open->half-open,half-open->closed"},
+		{name: "failed probe reopens", probe: failedResponse, want: CircuitOpen, changes: "closed->open,open->half-open,half-open->open"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker, changes := newTestBreaker(CircuitBreakerConfig{MinRequests: 1, CoolDown: 10 * time.Millisecond})
+			send(t, breaker, failedResponse)
+			time.Sleep(20 * time.Millisecond)
+
+			// 半开状态默认只放行一个试探请求
+			generation, err := breaker.allow()
+			if err != nil {
+				t.Fatalf("probe allow() error = %v", err)
+			}
+			if _, err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("second probe allow() error = %v, want ErrCircuitOpen", err)
+			}
+			breaker.done(generation, tt.probe, nil)
+
+			if breaker.state != tt.want {
+				t.Errorf("state = %s, want %s", breaker.state, tt.want)
+			}
+			if got := strings.Join(*changes, ","); got != tt.changes {
+				t.Errorf("changes = %s, want %s", got, tt.changes)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerIgnoresStaleResults(t *testing.T) {
+	breaker, _ := newTestBreaker(CircuitBreakerConfig{MinRequests: 1, CoolDown: time.Hour})
+	stale, err := breaker.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, breaker, failedResponse)
+	if breaker.state != CircuitOpen {
+		t.Fatalf("state = %s, want open", breaker.state)
+	}
+
+	// 打开之前发出的请求结果不影响新的统计
+	breaker.done(stale, okResponse, nil)
+	if breaker.state != CircuitOpen {
+		t.Errorf("state after stale result = %s, want open", breaker.state)
+	}
+}
+
+func TestCircuitBreakerAbortReleasesProbe(t *testing.T) {
+	breaker, _ := newTestBreaker(CircuitBreakerConfig{MinRequests: 1, CoolDown: 10 * time.Millisecond})
+	send(t, breaker, failedResponse)
+	time.Sleep(20 * time.Millisecond)
+
+	generation, err := breaker.allow()
+	if err != nil {
+		t.Fatalf("probe allow() error = %v", err)
+	}
+	breaker.abort(generation)
+	if breaker.state != CircuitHalfOpen {
+		t.Fatalf("state after abort = %s, want half-open", breaker.state)
+	}
+	if _, err := breaker.allow(); err != nil {
+		t.Errorf("allow() after abort error = %v, want the probe slot back", err)
+	}
+}
+
+func TestClientCircuitBreakerCancelledProbe(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"result":"success"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithCircuitBreaker(CircuitBreakerConfig{
+		MinRequests: 1,
+		CoolDown:    10 * time.Millisecond,
+	})).(*Client)
+	stop := func(ctx context.Context) error {
+		_, err := client.StopTask(ctx, StopTaskOption{ApiKey: "app-a", TaskId: "task-1", RequestBody: StopTaskReq{User: "user-1"}})
+		return err
+	}
+
+	_ = stop(context.Background())
+	if err := stop(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("stop() while open error = %v, want ErrCircuitOpen", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// 被取消的试探请求不会占住半开名额，也不会关闭熔断
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := stop(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled stop() error = %v, want context.Canceled", err)
+	}
+	if state := client.breakers.get(server.URL).state; state != CircuitHalfOpen {
+		t.Fatalf("state after cancelled probe = %s, want half-open", state)
+	}
+	if err := stop(context.Background()); err != nil {
+		t.Fatalf("probe stop() error = %v", err)
+	}
+	if state := client.breakers.get(server.URL).state; state != CircuitClosed {
+		t.Errorf("state after successful probe = %s, want closed", state)
+	}
+}
+
+func TestClientCircuitBreakerOpensOnTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithCircuitBreaker(CircuitBreakerConfig{MinRequests: 2, CoolDown: time.Hour})).(*Client)
+	stop := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := client.StopTask(ctx, StopTaskOption{ApiKey: "app-a", TaskId: "task-1", RequestBody: StopTaskReq{User: "user-1"}})
+		return err
+	}
+
+	// 超过调用方期限的请求计为失败，挂起的地址会被熔断
+	for range 2 {
+		if err := stop(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("stop() error = %v, want context.DeadlineExceeded", err)
+		}
+	}
+	if state := client.breakers.get(server.URL).state; state != CircuitOpen {
+		t.Fatalf("state after timeouts = %s, want open", state)
+	}
+	if err := stop(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("stop() while open error = %v, want ErrCircuitOpen", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/go-querystring/query"
@@ -24,23 +25,61 @@ var (
 	ApiPathStopTask           = "/chat-messages/%s/stop"
 	ApiPathGetSuggested       = "/messages/%s/suggested"
 	ApiPathGetMessages        = "/messages"
+	ApiPathGetConversations   = "/conversations"
+	ApiPathDeleteConversation = "/conversations/%s"
 
 	ResponseModeBlocking  = "blocking"
 	ResponseModeStreaming = "streaming"
 )
 
-type ClientI interface {
+// Chatter 发送对话消息
+type Chatter interface {
 	ChatMessage(ctx context.Context, option ChatMessageOption) (*ChatMessageResp, error)
+}
+
+// Uploader 上传文件
+type Uploader interface {
 	UploadFile(ctx context.Context, option UploadFileOption) (*UploadFileResp, error)
 	UploadFileViaGin(ctx context.Context, option UploadFileViaGinOption) (*UploadFileResp, error)
+}
+
+// TaskStopper 停止流式响应
+type TaskStopper interface {
 	StopTask(ctx context.Context, option StopTaskOption) (*StopTaskResp, error)
+}
+
+// Suggester 获取下一轮建议问题
+type Suggester interface {
 	GetSuggested(ctx context.Context, option GetSuggestedOption) (*GetSuggestedResp, error)
+}
+
+// MessageHistory 获取会话历史消息
+type MessageHistory interface {
 	GetMessages(ctx context.Context, option GetMessagesOption) (*GetMessagesResp, error)
+}
+
+// ConversationManager 列出、删除和重命名会话
+type ConversationManager interface {
+	GetConversations(ctx context.Context, option GetConversationsOption) (*GetConversationsResp, error)
+	DeleteConversation(ctx context.Context, option DeleteConversationOption) (*DeleteConversationResp, error)
 	ConversationRename(ctx context.Context, option ConversationRenameOption) (*ConversationRenameResp, error)
 }
 
+// ClientI 客户端的全部能力，只用到部分能力的代码可以依赖上面更小的接口，便于测试时替换
+type ClientI interface {
+	Chatter
+	Uploader
+	TaskStopper
+	Suggester
+	MessageHistory
+	ConversationManager
+}
+
 type Client struct {
-	config ClientConfig
+	config    ClientConfig
+	limiter   *rateLimiter
+	breakers  *circuitBreakers
+	endpoints *endpointPool
 }
 
 func NewClient(apiUrl string, opts ...Option) ClientI {
@@ -55,7 +94,10 @@ func NewClient(apiUrl string, opts ...Option) ClientI {
 
 func NewClientWithConfig(config ClientConfig) ClientI {
 	return &Client{
-		config: config,
+		config:    config,
+		limiter:   newRateLimiter(config.RateLimit),
+		breakers:  newCircuitBreakers(config.CircuitBreaker),
+		endpoints: newEndpointPool(config.Endpoints, config.HttpClient),
 	}
 }
 
@@ -66,6 +108,9 @@ type requestOption struct {
 	RequestBody     interface{}
 	RequestFormData requestOptionRequestFormData
 	Headers         map[string]string
+	Header          http.Header // 中间件设置的请求头，覆盖同名请求头
+	Streaming       bool        // 是否为流式请求，用于区分限流规则，流式请求不自动切换服务地址
+	ConversationId  string      // 请求所属的会话，用于将请求发往会话所在的服务地址
 }
 
 type requestOptionRequestFormData struct {
@@ -75,7 +120,7 @@ type requestOptionRequestFormData struct {
 
 func (c *Client) request(ctx context.Context, option requestOption) (readCloser *http.Response, err error) {
 
-	var body *strings.Reader
+	var body []byte
 
 	contentType := option.Headers["Content-Type"]
 	if contentType == "application/json" || contentType == "" {
@@ -84,38 +129,174 @@ func (c *Client) request(ctx context.Context, option requestOption) (readCloser
 			fmt.Printf("marshalErr: %s\n", marshalErr.Error())
 			return
 		}
-		body = strings.NewReader(string(bodyBytes))
+		body = bodyBytes
 	}
 
 	if strings.Contains(contentType, "multipart/form-data") {
-		body = strings.NewReader(option.RequestFormData.Buffer.String())
+		body = option.RequestFormData.Buffer.Bytes()
+	}
+
+	apiKey := option.ApiKey
+	if c.config.ApiKeyProvider != nil {
+		acquiredApiKey, acquireErr := c.config.ApiKeyProvider.Acquire(ctx, option.ApiKey)
+		if acquireErr != nil {
+			err = fmt.Errorf("acquireApiKeyErr: %w", acquireErr)
+			return
+		}
+		apiKey = acquiredApiKey
+	}
+
+	release, waitErr := c.limiter.wait(ctx, apiKey, option.ApiPath, option.Streaming)
+	if waitErr != nil {
+		err = fmt.Errorf("rateLimitErr: %w", waitErr)
+		return
+	}
+
+	// 依次尝试可用的服务地址，直到成功或不需要再切换
+	tried := make(map[string]bool)
+	for {
+		baseUrl, pinned := c.endpoints.pick(c.config.ApiBaseUrl, option.ConversationId, tried)
+		if baseUrl == "" {
+			break
+		}
+		tried[baseUrl] = true
+		if readCloser != nil {
+			_ = readCloser.Body.Close()
+		}
+
+		readCloser, err = c.do(ctx, baseUrl, apiKey, option, body)
+		if pinned || !c.shouldFailover(ctx, option, readCloser, err) {
+			break
+		}
+	}
+	if readCloser == nil {
+		release()
+		if err == nil {
+			err = ErrNoEndpoint
+		}
+		return
 	}
 
-	request, newRequestErr := http.NewRequestWithContext(ctx, option.Method, c.config.ApiBaseUrl+option.ApiPath, body)
+	if option.ConversationId != "" && readCloser.StatusCode < http.StatusBadRequest {
+		c.endpoints.pin(option.ConversationId, readCloser)
+	}
+	readCloser.Body = &releaseOnCloseBody{ReadCloser: readCloser.Body, release: release}
+	return
+}
+
+// do 向指定地址发起一次请求
+func (c *Client) do(ctx context.Context, baseUrl string, apiKey string, option requestOption, body []byte) (readCloser *http.Response, err error) {
+	request, newRequestErr := http.NewRequestWithContext(ctx, option.Method, baseUrl+option.ApiPath, bytes.NewReader(body))
 	if newRequestErr != nil {
 		err = errors.New(fmt.Sprintf("newRequestErr: %s", newRequestErr.Error()))
 		return
 	}
 
-	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", option.ApiKey))
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", apiKey))
 	switch option.Method {
-	case http.MethodPost:
+	case http.MethodPost, http.MethodDelete:
 		request.Header.Add("Content-Type", "application/json")
 	}
 	for k, v := range option.Headers {
-		request.Header.Add(k, v)
+		request.Header.Set(k, v)
+	}
+	for k, v := range option.Header {
+		request.Header[k] = v
+	}
+
+	breaker := c.breakers.get(baseUrl)
+	generation, allowErr := breaker.allow()
+	if allowErr != nil {
+		err = fmt.Errorf("circuitBreakerErr: %w", allowErr)
+		return
+	}
+
+	// 调用方主动取消时归还名额，结果不代表服务端状况，也避免半开状态的试探名额泄漏；
+	// 超时仍计入统计，否则使用超时的调用方无法让挂起的地址熔断
+	if errors.Is(ctx.Err(), context.Canceled) {
+		breaker.abort(generation)
+		err = fmt.Errorf("doResp: %w", ctx.Err())
+		return
 	}
 
+	call := callStateFromContext(ctx)
+	call.attempt(baseUrl)
+	start := time.Now()
 	readCloser, doErr := c.config.HttpClient.Do(request)
+	call.response(readCloser)
+	if doErr != nil && errors.Is(ctx.Err(), context.Canceled) {
+		breaker.abort(generation)
+	} else {
+		breaker.done(generation, readCloser, doErr)
+	}
+	c.endpoints.record(baseUrl, time.Since(start), doErr != nil || readCloser.StatusCode >= http.StatusInternalServerError)
 	if doErr != nil {
-		err = errors.New(fmt.Sprintf("doResp: %s", doErr.Error()))
+		c.reportApiKey(apiKey, doErr)
+		err = fmt.Errorf("doResp: %w", doErr)
 		return
 	}
+	if c.config.ApiKeyProvider != nil {
+		if readCloser.StatusCode >= http.StatusBadRequest {
+			c.reportApiKey(apiKey, peekAPIError(readCloser))
+		} else {
+			c.reportApiKey(apiKey, nil)
+		}
+	}
 	return
 }
 
+// shouldFailover 判断是否切换到下一个服务地址重试
+//
+// 只有配置了多地址的非流式请求会切换；携带未绑定会话的请求返回 404 时，
+// 会话可能属于其他地址，也会继续尝试。
+func (c *Client) shouldFailover(ctx context.Context, option requestOption, response *http.Response, err error) bool {
+	if c.endpoints == nil || option.Streaming || ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	if response.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	return response.StatusCode == http.StatusNotFound && option.ConversationId != ""
+}
+
+// reportApiKey 向密钥提供者回报请求结果
+func (c *Client) reportApiKey(apiKey string, err error) {
+	if c.config.ApiKeyProvider == nil {
+		return
+	}
+	c.config.ApiKeyProvider.Report(apiKey, err)
+}
+
 // ChatMessage 发送对话消息
 func (c *Client) ChatMessage(ctx context.Context, option ChatMessageOption) (resp *ChatMessageResp, err error) {
+	ctx, state := c.startCall(ctx, CallInfo{
+		Operation:      OperationChatMessage,
+		ApiPath:        ApiPathChatMessage,
+		App:            c.appName(option.ApiKey),
+		ResponseMode:   option.RequestBody.ResponseMode,
+		ConversationId: option.RequestBody.ConversationId,
+		User:           option.RequestBody.User,
+	})
+	defer func() {
+		state.finished(resp, err)
+	}()
+
+	return invoke(ctx, c, &Call{
+		Operation: OperationChatMessage,
+		ApiPath:   ApiPathChatMessage,
+		Option:    &option,
+	}, c.chatMessage)
+}
+
+// chatMessage 发送对话消息
+func (c *Client) chatMessage(ctx context.Context, call *Call) (resp *ChatMessageResp, err error) {
+	option, err := callOption[ChatMessageOption](call)
+	if err != nil {
+		return
+	}
 
 	// 校验参数
 	validate := validator.New()
@@ -129,28 +310,47 @@ func (c *Client) ChatMessage(ctx context.Context, option ChatMessageOption) (res
 		return
 	}
 
+	// 检查额度
+	if c.config.BudgetPolicy != nil {
+		budgetErr := c.config.BudgetPolicy.check(ctx, c.appName(option.ApiKey), option.RequestBody.User)
+		if budgetErr != nil {
+			err = budgetErr
+			return
+		}
+	}
+
 	// 发起请求
 	response, requestErr := c.request(ctx, requestOption{
-		Method:      http.MethodPost,
-		ApiPath:     ApiPathChatMessage,
-		ApiKey:      option.ApiKey,
-		RequestBody: option.RequestBody,
-		Headers:     nil,
+		Method:         http.MethodPost,
+		ApiPath:        call.ApiPath,
+		Header:         call.Header,
+		ApiKey:         option.ApiKey,
+		RequestBody:    option.RequestBody,
+		Headers:        nil,
+		Streaming:      option.RequestBody.ResponseMode == ResponseModeStreaming,
+		ConversationId: option.RequestBody.ConversationId,
 	})
 	if requestErr != nil {
-		err = errors.New(fmt.Sprintf("requestErr: %s", requestErr.Error()))
+		err = fmt.Errorf("requestErr: %w", requestErr)
 		return
 	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(response.Body)
 
 	// 错误处理
 	if response.StatusCode != http.StatusOK {
 		all, _ := io.ReadAll(response.Body)
-		err = errors.New(string(all))
+		err = newAPIError(response.StatusCode, all)
 		return
 	}
 
 	// 解析返回参
 	if option.RequestBody.ResponseMode == "streaming" {
+		var usage usageTracker
+		defer usage.finish(ctx, c)
+		var progress streamProgress
+		defer c.autoStop(ctx, option, &progress)
 		for ev, sseReadErr := range sse.Read(response.Body, nil) {
 			if sseReadErr != nil {
 				fmt.Printf("Error reading SSE error: %s", sseReadErr.Error())
@@ -164,8 +364,29 @@ func (c *Client) ChatMessage(ctx context.Context, option ChatMessageOption) (res
 				continue
 			}
 
+			if option.RequestBody.ConversationId == "" {
+				c.endpoints.pin(difySSEData.ConversationId, response)
+			}
+			callStateFromContext(ctx).event(difySSEData)
+			usage.streamEvent(ctx, c, option, difySSEData)
+			progress.event(difySSEData)
 			option.OnEvent(difySSEData)
 		}
+
+		// 连接在回答结束前断开时，通过会话历史补齐回答
+		if option.Resume != nil && !progress.finished && ctx.Err() == nil {
+			events, resumeErr := c.resume(ctx, option, &progress)
+			if resumeErr != nil {
+				err = resumeErr
+				return
+			}
+			for _, difySSEData := range events {
+				callStateFromContext(ctx).event(difySSEData)
+				usage.streamEvent(ctx, c, option, difySSEData)
+				progress.event(difySSEData)
+				option.OnEvent(difySSEData)
+			}
+		}
 	} else {
 		all, readAllErr := io.ReadAll(response.Body)
 		if readAllErr != nil {
@@ -178,6 +399,16 @@ func (c *Client) ChatMessage(ctx context.Context, option ChatMessageOption) (res
 			err = errors.New(fmt.Sprintf("unmarshalErr: %s", unmarshalErr.Error()))
 			return
 		}
+		c.endpoints.pin(resp.ConversationId, response)
+		c.recordUsage(ctx, UsageRecord{
+			App:            c.appName(option.ApiKey),
+			User:           option.RequestBody.User,
+			ConversationId: resp.ConversationId,
+			MessageId:      resp.MessageId,
+			TaskId:         resp.TaskId,
+			Source:         UsageSourceBlocking,
+			Usage:          resp.Metadata.Usage,
+		})
 	}
 
 	return
@@ -185,6 +416,30 @@ func (c *Client) ChatMessage(ctx context.Context, option ChatMessageOption) (res
 
 // UploadFile 上传文件
 func (c *Client) UploadFile(ctx context.Context, option UploadFileOption) (resp *UploadFileResp, err error) {
+	ctx, state := c.startCall(ctx, CallInfo{
+		Operation: OperationUploadFile,
+		ApiPath:   ApiPathUploadFile,
+		App:       c.appName(option.ApiKey),
+		User:      option.RequestFormData.User,
+	})
+	defer func() {
+		state.finished(resp, err)
+	}()
+
+	return invoke(ctx, c, &Call{
+		Operation: OperationUploadFile,
+		ApiPath:   ApiPathUploadFile,
+		Option:    &option,
+	}, c.uploadFile)
+}
+
+// uploadFile 上传文件
+func (c *Client) uploadFile(ctx context.Context, call *Call) (resp *UploadFileResp, err error) {
+	option, err := callOption[UploadFileOption](call)
+	if err != nil {
+		return
+	}
+
 	// 校验参数
 	validate := validator.New()
 	validateErr := validate.Struct(option)
@@ -215,7 +470,8 @@ func (c *Client) UploadFile(ctx context.Context, option UploadFileOption) (resp
 
 	requestResp, requestErr := c.request(ctx, requestOption{
 		Method:      http.MethodPost,
-		ApiPath:     ApiPathUploadFile,
+		ApiPath:     call.ApiPath,
+		Header:      call.Header,
 		ApiKey:      option.ApiKey,
 		RequestBody: nil,
 		RequestFormData: requestOptionRequestFormData{
@@ -227,9 +483,12 @@ func (c *Client) UploadFile(ctx context.Context, option UploadFileOption) (resp
 		},
 	})
 	if requestErr != nil {
-		err = errors.New(fmt.Sprintf("requestErr: %s", requestErr.Error()))
+		err = fmt.Errorf("requestErr: %w", requestErr)
 		return
 	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(requestResp.Body)
 
 	// 解析返回参
 	all, readAllErr := io.ReadAll(requestResp.Body)
@@ -248,6 +507,30 @@ func (c *Client) UploadFile(ctx context.Context, option UploadFileOption) (resp
 
 // UploadFileViaGin 上传文件通过gin
 func (c *Client) UploadFileViaGin(ctx context.Context, option UploadFileViaGinOption) (resp *UploadFileResp, err error) {
+	ctx, state := c.startCall(ctx, CallInfo{
+		Operation: OperationUploadFileViaGin,
+		ApiPath:   ApiPathUploadFile,
+		App:       c.appName(option.ApiKey),
+		User:      option.RequestFormData.User,
+	})
+	defer func() {
+		state.finished(resp, err)
+	}()
+
+	return invoke(ctx, c, &Call{
+		Operation: OperationUploadFileViaGin,
+		ApiPath:   ApiPathUploadFile,
+		Option:    &option,
+	}, c.uploadFileViaGin)
+}
+
+// uploadFileViaGin 上传文件通过gin
+func (c *Client) uploadFileViaGin(ctx context.Context, call *Call) (resp *UploadFileResp, err error) {
+	option, err := callOption[UploadFileViaGinOption](call)
+	if err != nil {
+		return
+	}
+
 	// 校验参数
 	validate := validator.New()
 	validateErr := validate.Struct(option)
@@ -286,7 +569,8 @@ func (c *Client) UploadFileViaGin(ctx context.Context, option UploadFileViaGinOp
 
 	requestResp, requestErr := c.request(ctx, requestOption{
 		Method:      http.MethodPost,
-		ApiPath:     ApiPathUploadFile,
+		ApiPath:     call.ApiPath,
+		Header:      call.Header,
 		ApiKey:      option.ApiKey,
 		RequestBody: nil,
 		RequestFormData: requestOptionRequestFormData{
@@ -298,9 +582,12 @@ func (c *Client) UploadFileViaGin(ctx context.Context, option UploadFileViaGinOp
 		},
 	})
 	if requestErr != nil {
-		err = errors.New(fmt.Sprintf("requestErr: %s", requestErr.Error()))
+		err = fmt.Errorf("requestErr: %w", requestErr)
 		return
 	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(requestResp.Body)
 
 	// 解析返回参
 	all, readAllErr := io.ReadAll(requestResp.Body)
@@ -319,6 +606,30 @@ func (c *Client) UploadFileViaGin(ctx context.Context, option UploadFileViaGinOp
 
 // StopTask 停止响应
 func (c *Client) StopTask(ctx context.Context, option StopTaskOption) (resp *StopTaskResp, err error) {
+	ctx, state := c.startCall(ctx, CallInfo{
+		Operation: OperationStopTask,
+		ApiPath:   fmt.Sprintf(ApiPathStopTask, option.TaskId),
+		App:       c.appName(option.ApiKey),
+		User:      option.RequestBody.User,
+	})
+	defer func() {
+		state.finished(resp, err)
+	}()
+
+	return invoke(ctx, c, &Call{
+		Operation: OperationStopTask,
+		ApiPath:   fmt.Sprintf(ApiPathStopTask, option.TaskId),
+		Option:    &option,
+	}, c.stopTask)
+}
+
+// stopTask 停止响应
+func (c *Client) stopTask(ctx context.Context, call *Call) (resp *StopTaskResp, err error) {
+	option, err := callOption[StopTaskOption](call)
+	if err != nil {
+		return
+	}
+
 	// 校验参数
 	validate := validator.New()
 	validateErr := validate.Struct(option)
@@ -330,15 +641,19 @@ func (c *Client) StopTask(ctx context.Context, option StopTaskOption) (resp *Sto
 	// 发起请求
 	requestResp, requestErr := c.request(ctx, requestOption{
 		Method:      http.MethodPost,
-		ApiPath:     fmt.Sprintf(ApiPathStopTask, option.TaskId),
+		ApiPath:     call.ApiPath,
+		Header:      call.Header,
 		ApiKey:      option.ApiKey,
 		RequestBody: option.RequestBody,
 		Headers:     nil,
 	})
 	if requestErr != nil {
-		err = errors.New(fmt.Sprintf("requestErr: %s", requestErr.Error()))
+		err = fmt.Errorf("requestErr: %w", requestErr)
 		return
 	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(requestResp.Body)
 
 	// 解析返回参
 	all, readAllErr := io.ReadAll(requestResp.Body)
@@ -357,6 +672,30 @@ func (c *Client) StopTask(ctx context.Context, option StopTaskOption) (resp *Sto
 
 // GetSuggested 获取下一轮建议问题列表
 func (c *Client) GetSuggested(ctx context.Context, option GetSuggestedOption) (resp *GetSuggestedResp, err error) {
+	ctx, state := c.startCall(ctx, CallInfo{
+		Operation: OperationGetSuggested,
+		ApiPath:   fmt.Sprintf(ApiPathGetSuggested, option.MessageId),
+		App:       c.appName(option.ApiKey),
+		User:      option.RequestParams.User,
+	})
+	defer func() {
+		state.finished(resp, err)
+	}()
+
+	return invoke(ctx, c, &Call{
+		Operation: OperationGetSuggested,
+		ApiPath:   fmt.Sprintf(ApiPathGetSuggested, option.MessageId),
+		Option:    &option,
+	}, c.getSuggested)
+}
+
+// getSuggested 获取下一轮建议问题列表
+func (c *Client) getSuggested(ctx context.Context, call *Call) (resp *GetSuggestedResp, err error) {
+	option, err := callOption[GetSuggestedOption](call)
+	if err != nil {
+		return
+	}
+
 	// 校验参数
 	validate := validator.New()
 	validateErr := validate.Struct(option)
@@ -370,15 +709,19 @@ func (c *Client) GetSuggested(ctx context.Context, option GetSuggestedOption) (r
 	params := values.Encode()
 	requestResp, requestErr := c.request(ctx, requestOption{
 		Method:      http.MethodGet,
-		ApiPath:     fmt.Sprintf(ApiPathGetSuggested, option.MessageId) + "?" + params,
+		ApiPath:     call.ApiPath + "?" + params,
+		Header:      call.Header,
 		ApiKey:      option.ApiKey,
 		RequestBody: nil,
 		Headers:     nil,
 	})
 	if requestErr != nil {
-		err = errors.New(fmt.Sprintf("requestErr: %s", requestErr.Error()))
+		err = fmt.Errorf("requestErr: %w", requestErr)
 		return
 	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(requestResp.Body)
 
 	// 解析返回参
 	all, readAllErr := io.ReadAll(requestResp.Body)
@@ -397,6 +740,105 @@ func (c *Client) GetSuggested(ctx context.Context, option GetSuggestedOption) (r
 
 // GetMessages 获取会话历史消息
 func (c *Client) GetMessages(ctx context.Context, option GetMessagesOption) (resp *GetMessagesResp, err error) {
+	ctx, state := c.startCall(ctx, CallInfo{
+		Operation:      OperationGetMessages,
+		ApiPath:        ApiPathGetMessages,
+		App:            c.appName(option.ApiKey),
+		ConversationId: option.RequestParams.ConversationId,
+		User:           option.RequestParams.User,
+	})
+	defer func() {
+		state.finished(resp, err)
+	}()
+
+	return invoke(ctx, c, &Call{
+		Operation: OperationGetMessages,
+		ApiPath:   ApiPathGetMessages,
+		Option:    &option,
+	}, c.getMessages)
+}
+
+// getMessages 获取会话历史消息
+func (c *Client) getMessages(ctx context.Context, call *Call) (resp *GetMessagesResp, err error) {
+	option, err := callOption[GetMessagesOption](call)
+	if err != nil {
+		return
+	}
+
+	// 校验参数
+	validate := validator.New()
+	validateErr := validate.Struct(option)
+	if validateErr != nil {
+		err = errors.New(fmt.Sprintf("validateErr: %s", validateErr.Error()))
+		return
+	}
+
+	// 发起请求
+	values, _ := query.Values(option.RequestParams)
+	params := values.Encode()
+	requestResp, requestErr := c.request(ctx, requestOption{
+		Method:         http.MethodGet,
+		ApiPath:        call.ApiPath + "?" + params,
+		Header:         call.Header,
+		ApiKey:         option.ApiKey,
+		ConversationId: option.RequestParams.ConversationId,
+	})
+	if requestErr != nil {
+		err = fmt.Errorf("requestErr: %w", requestErr)
+		return
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(requestResp.Body)
+
+	// 错误处理，否则翻页时会把错误响应当作空页而提前结束
+	if requestResp.StatusCode != http.StatusOK {
+		all, _ := io.ReadAll(requestResp.Body)
+		err = newAPIError(requestResp.StatusCode, all)
+		return
+	}
+
+	// 解析返回参
+	all, readAllErr := io.ReadAll(requestResp.Body)
+	if readAllErr != nil {
+		err = errors.New(fmt.Sprintf("readAllErr: %s", readAllErr.Error()))
+		return
+	}
+	unmarshalErr := json.Unmarshal(all, &resp)
+	if unmarshalErr != nil {
+		err = errors.New(fmt.Sprintf("unmarshalErr: %s", unmarshalErr.Error()))
+		return
+	}
+
+	return
+}
+
+// GetConversations 获取会话列表
+func (c *Client) GetConversations(ctx context.Context, option GetConversationsOption) (resp *GetConversationsResp, err error) {
+	ctx, state := c.startCall(ctx, CallInfo{
+		Operation: OperationGetConversations,
+		ApiPath:   ApiPathGetConversations,
+		App:       c.appName(option.ApiKey),
+		User:      option.RequestParams.User,
+	})
+	defer func() {
+		state.finished(resp, err)
+	}()
+
+	return invoke(ctx, c, &Call{
+		Operation: OperationGetConversations,
+		ApiPath:   ApiPathGetConversations,
+		Option:    &option,
+	}, c.getConversations)
+}
+
+// getConversations 获取会话列表
+func (c *Client) getConversations(ctx context.Context, call *Call) (resp *GetConversationsResp, err error) {
+	option, err := callOption[GetConversationsOption](call)
+	if err != nil {
+		return
+	}
+
 	// 校验参数
 	validate := validator.New()
 	validateErr := validate.Struct(option)
@@ -410,11 +852,22 @@ func (c *Client) GetMessages(ctx context.Context, option GetMessagesOption) (res
 	params := values.Encode()
 	requestResp, requestErr := c.request(ctx, requestOption{
 		Method:  http.MethodGet,
-		ApiPath: ApiPathGetMessages + "?" + params,
+		ApiPath: call.ApiPath + "?" + params,
+		Header:  call.Header,
 		ApiKey:  option.ApiKey,
 	})
 	if requestErr != nil {
-		err = errors.New(fmt.Sprintf("requestErr: %s", requestErr.Error()))
+		err = fmt.Errorf("requestErr: %w", requestErr)
+		return
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(requestResp.Body)
+
+	// 错误处理
+	if requestResp.StatusCode != http.StatusOK {
+		all, _ := io.ReadAll(requestResp.Body)
+		err = newAPIError(requestResp.StatusCode, all)
 		return
 	}
 
@@ -433,8 +886,110 @@ func (c *Client) GetMessages(ctx context.Context, option GetMessagesOption) (res
 	return
 }
 
+// DeleteConversation 删除会话
+func (c *Client) DeleteConversation(ctx context.Context, option DeleteConversationOption) (resp *DeleteConversationResp, err error) {
+	ctx, state := c.startCall(ctx, CallInfo{
+		Operation:      OperationDeleteConversation,
+		ApiPath:        fmt.Sprintf(ApiPathDeleteConversation, option.ConversationId),
+		App:            c.appName(option.ApiKey),
+		ConversationId: option.ConversationId,
+		User:           option.RequestBody.User,
+	})
+	defer func() {
+		state.finished(resp, err)
+	}()
+
+	return invoke(ctx, c, &Call{
+		Operation: OperationDeleteConversation,
+		ApiPath:   fmt.Sprintf(ApiPathDeleteConversation, option.ConversationId),
+		Option:    &option,
+	}, c.deleteConversation)
+}
+
+// deleteConversation 删除会话
+func (c *Client) deleteConversation(ctx context.Context, call *Call) (resp *DeleteConversationResp, err error) {
+	option, err := callOption[DeleteConversationOption](call)
+	if err != nil {
+		return
+	}
+
+	// 校验参数
+	validate := validator.New()
+	validateErr := validate.Struct(option)
+	if validateErr != nil {
+		err = errors.New(fmt.Sprintf("validateErr: %s", validateErr.Error()))
+		return
+	}
+
+	// 发起请求
+	response, requestErr := c.request(ctx, requestOption{
+		Method:         http.MethodDelete,
+		ApiPath:        call.ApiPath,
+		Header:         call.Header,
+		ApiKey:         option.ApiKey,
+		RequestBody:    option.RequestBody,
+		ConversationId: option.ConversationId,
+	})
+	if requestErr != nil {
+		err = fmt.Errorf("requestErr: %w", requestErr)
+		return
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(response.Body)
+
+	// 错误处理
+	if response.StatusCode >= http.StatusBadRequest {
+		all, _ := io.ReadAll(response.Body)
+		err = newAPIError(response.StatusCode, all)
+		return
+	}
+
+	// 解析返回参，新版本 Dify 返回 204 且没有响应体
+	if response.StatusCode == http.StatusNoContent {
+		resp = &DeleteConversationResp{Result: "success"}
+		return
+	}
+	all, readAllErr := io.ReadAll(response.Body)
+	if readAllErr != nil {
+		err = errors.New(fmt.Sprintf("readAllErr: %s", readAllErr.Error()))
+		return
+	}
+	unmarshalErr := json.Unmarshal(all, &resp)
+	if unmarshalErr != nil {
+		err = errors.New(fmt.Sprintf("unmarshalErr: %s", unmarshalErr.Error()))
+		return
+	}
+
+	return
+}
+
 // ConversationRename 会话重命名
 func (c *Client) ConversationRename(ctx context.Context, option ConversationRenameOption) (resp *ConversationRenameResp, err error) {
+	ctx, state := c.startCall(ctx, CallInfo{
+		Operation:      OperationConversationRename,
+		ApiPath:        fmt.Sprintf(ApiPathConversationRename, option.ConversationId),
+		App:            c.appName(option.ApiKey),
+		ConversationId: option.ConversationId,
+		User:           option.RequestBody.User,
+	})
+	defer func() {
+		state.finished(resp, err)
+	}()
+
+	return invoke(ctx, c, &Call{
+		Operation: OperationConversationRename,
+		ApiPath:   fmt.Sprintf(ApiPathConversationRename, option.ConversationId),
+		Option:    &option,
+	}, c.conversationRename)
+}
+
+// conversationRename 会话重命名
+func (c *Client) conversationRename(ctx context.Context, call *Call) (resp *ConversationRenameResp, err error) {
+	option, err := callOption[ConversationRenameOption](call)
+	if err != nil {
+		return
+	}
 
 	// 校验参数
 	validate := validator.New()
@@ -446,21 +1001,26 @@ func (c *Client) ConversationRename(ctx context.Context, option ConversationRena
 
 	// 发起请求
 	response, requestErr := c.request(ctx, requestOption{
-		Method:      http.MethodPost,
-		ApiPath:     fmt.Sprintf(ApiPathConversationRename, option.ConversationId),
-		ApiKey:      option.ApiKey,
-		RequestBody: option.RequestBody,
-		Headers:     nil,
+		Method:         http.MethodPost,
+		ApiPath:        call.ApiPath,
+		Header:         call.Header,
+		ApiKey:         option.ApiKey,
+		RequestBody:    option.RequestBody,
+		Headers:        nil,
+		ConversationId: option.ConversationId,
 	})
 	if requestErr != nil {
-		err = errors.New(fmt.Sprintf("requestErr: %s", requestErr.Error()))
+		err = fmt.Errorf("requestErr: %w", requestErr)
 		return
 	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(response.Body)
 
 	// 错误处理
 	if response.StatusCode != http.StatusOK {
 		all, _ := io.ReadAll(response.Body)
-		err = errors.New(string(all))
+		err = newAPIError(response.StatusCode, all)
 		return
 	}
 
@@ -0,0 +1,301 @@
+package dify_test
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+func newTestClient(t *testing.T) (*difytest.Server, dify.ClientI) {
+	t.Helper()
+	server := difytest.NewServer()
+	t.Cleanup(server.Close)
+	return server, dify.NewClient(server.URL)
+}
+
+// chat 发送一条阻塞消息，返回回答
+func chat(t *testing.T, client dify.ClientI, conversationId string, query string) *dify.ChatMessageResp {
+	t.Helper()
+	resp, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		ApiKey: "app-test",
+		RequestBody: dify.ChatMessageReq{
+			Query:          query,
+			ResponseMode:   dify.ResponseModeBlocking,
+			ConversationId: conversationId,
+			User:           "user-1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("ChatMessage() error = %v", err)
+	}
+	return resp
+}
+
+func TestChatMessageBlocking(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Enqueue(difytest.Reply{Answer: "你好", Usage: dify.Usage{TotalTokens: 12}})
+
+	resp, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		ApiKey: "app-test",
+		RequestBody: dify.ChatMessageReq{
+			Inputs:       map[string]interface{}{"role": "助手"},
+			Query:        "hi",
+			ResponseMode: dify.ResponseModeBlocking,
+			User:         "user-1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("ChatMessage() error = %v", err)
+	}
+	if resp.Answer != "你好" || resp.ConversationId == "" || resp.Metadata.Usage.TotalTokens != 12 {
+		t.Fatalf("ChatMessage() = %+v", resp)
+	}
+
+	request := server.AssertRequested(t, http.MethodPost, "/chat-messages")
+	if request.ApiKey != "app-test" {
+		t.Errorf("ApiKey = %q, want app-test", request.ApiKey)
+	}
+	if got := request.Header.Values("Content-Type"); len(got) != 1 || got[0] != "application/json" {
+		t.Errorf("Content-Type = %q, want [application/json]", got)
+	}
+	var body dify.ChatMessageReq
+	if err := request.JSON(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Inputs["role"] != "助手" || body.User != "user-1" {
+		t.Errorf("request body = %+v", body)
+	}
+}
+
+func TestChatMessageStreaming(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Enqueue(difytest.Reply{Chunks: []string{"你", "好", "呀"}, Usage: dify.Usage{TotalTokens: 7}})
+
+	var events []dify.ChatMessageRespSSEData
+	_, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		ApiKey: "app-test",
+		OnEvent: func(ev dify.ChatMessageRespSSEData) {
+			events = append(events, ev)
+		},
+		RequestBody: dify.ChatMessageReq{
+			Query:        "hi",
+			ResponseMode: dify.ResponseModeStreaming,
+			User:         "user-1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("ChatMessage() error = %v", err)
+	}
+
+	var answer strings.Builder
+	var names []string
+	for _, ev := range events {
+		names = append(names, ev.Event)
+		answer.WriteString(ev.Answer)
+	}
+	if got, want := strings.Join(names, ","), "message,message,message,message_end"; got != want {
+		t.Fatalf("events = %s, want %s", got, want)
+	}
+	if answer.String() != "你好呀" {
+		t.Errorf("answer = %q, want 你好呀", answer.String())
+	}
+	end := events[len(events)-1]
+	if end.Metadata.Usage.TotalTokens != 7 {
+		t.Errorf("message_end metadata = %+v", end.Metadata)
+	}
+
+	// 会话中保存了完整回答
+	messages := server.Messages(end.ConversationId)
+	if len(messages) != 1 || messages[0].Answer != "你好呀" {
+		t.Errorf("Messages() = %+v", messages)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(server *difytest.Server)
+		call   func(client dify.ClientI) error
+		status int
+		code   string
+	}{
+		{
+			name: "chat reply error",
+			setup: func(server *difytest.Server) {
+				server.Enqueue(difytest.Reply{Error: &difytest.Error{Status: http.StatusBadRequest, Code: "invalid_param", Message: "bad inputs"}})
+			},
+			call: func(client dify.ClientI) error {
+				_, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+					ApiKey:      "app-test",
+					RequestBody: dify.ChatMessageReq{Query: "hi", ResponseMode: dify.ResponseModeBlocking, User: "user-1"},
+				})
+				return err
+			},
+			status: http.StatusBadRequest,
+			code:   "invalid_param",
+		},
+		{
+			name: "streaming chat throttled",
+			setup: func(server *difytest.Server) {
+				server.Fail(http.MethodPost, "/chat-messages", difytest.Error{Status: http.StatusTooManyRequests, Code: "too_many_requests"})
+			},
+			call: func(client dify.ClientI) error {
+				_, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+					ApiKey:      "app-test",
+					OnEvent:     func(dify.ChatMessageRespSSEData) {},
+					RequestBody: dify.ChatMessageReq{Query: "hi", ResponseMode: dify.ResponseModeStreaming, User: "user-1"},
+				})
+				return err
+			},
+			status: http.StatusTooManyRequests,
+			code:   "too_many_requests",
+		},
+		{
+			name: "unknown api key",
+			setup: func(server *difytest.Server) {
+				server.RequireApiKeys("app-other")
+			},
+			call: func(client dify.ClientI) error {
+				_, err := client.GetConversations(context.Background(), dify.GetConversationsOption{
+					ApiKey:        "app-test",
+					RequestParams: dify.GetConversationsReq{User: "user-1"},
+				})
+				return err
+			},
+			status: http.StatusUnauthorized,
+			code:   "unauthorized",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+			tt.setup(server)
+
+			err := tt.call(client)
+			var apiErr *dify.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Code != tt.code {
+				t.Errorf("APIError = %d %s, want %d %s", apiErr.StatusCode, apiErr.Code, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestGetMessagesPaging(t *testing.T) {
+	_, client := newTestClient(t)
+	conversationId := ""
+	for _, query := range []string{"q1", "q2", "q3", "q4", "q5"} {
+		conversationId = chat(t, client, conversationId, query).ConversationId
+	}
+
+	// 从最新的消息向前翻页，每页内按时间正序
+	var pages [][]string
+	firstId := ""
+	for {
+		resp, err := client.GetMessages(context.Background(), dify.GetMessagesOption{
+			ApiKey: "app-test",
+			RequestParams: dify.GetMessagesReq{
+				ConversationId: conversationId,
+				User:           "user-1",
+				FirstId:        firstId,
+				Limit:          2,
+			},
+		})
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		var queries []string
+		for _, message := range resp.Data {
+			queries = append(queries, message.Query)
+		}
+		pages = append(pages, queries)
+		if !resp.HasMore {
+			break
+		}
+		firstId = resp.Data[0].Id
+	}
+
+	got := make([]string, 0, len(pages))
+	for _, page := range pages {
+		got = append(got, strings.Join(page, ","))
+	}
+	if want := "q4,q5|q2,q3|q1"; strings.Join(got, "|") != want {
+		t.Errorf("pages = %s, want %s", strings.Join(got, "|"), want)
+	}
+}
+
+func TestDeleteConversation(t *testing.T) {
+	server, client := newTestClient(t)
+	conversationId := chat(t, client, "", "hi").ConversationId
+
+	deleteConversation := func() (*dify.DeleteConversationResp, error) {
+		return client.DeleteConversation(context.Background(), dify.DeleteConversationOption{
+			ConversationId: conversationId,
+			ApiKey:         "app-test",
+			RequestBody:    dify.DeleteConversationReq{User: "user-1"},
+		})
+	}
+	resp, err := deleteConversation()
+	if err != nil {
+		t.Fatalf("DeleteConversation() error = %v", err)
+	}
+	if resp.Result != "success" {
+		t.Errorf("Result = %q, want success", resp.Result)
+	}
+	if conversations := server.Conversations("user-1"); len(conversations) != 0 {
+		t.Errorf("Conversations() = %+v, want none", conversations)
+	}
+
+	// 再次删除返回 404
+	_, err = deleteConversation()
+	var apiErr *dify.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("second DeleteConversation() error = %v, want 404", err)
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	server, client := newTestClient(t)
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	resp, err := client.UploadFile(context.Background(), dify.UploadFileOption{
+		ApiKey:          "app-test",
+		RequestFormData: dify.UploadFileReq{File: file, User: "user-1"},
+	})
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if resp.Id == "" || resp.Name != "notes.txt" || resp.Size != 5 || resp.CreatedBy != "user-1" {
+		t.Errorf("UploadFile() = %+v", resp)
+	}
+
+	// 只能有一个 multipart 的 Content-Type，否则严格的服务端无法解析
+	request := server.AssertRequested(t, http.MethodPost, "/files/upload")
+	contentTypes := request.Header.Values("Content-Type")
+	if len(contentTypes) != 1 {
+		t.Fatalf("Content-Type = %q, want exactly one", contentTypes)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentTypes[0]); mediaType != "multipart/form-data" {
+		t.Errorf("Content-Type = %q, want multipart/form-data", contentTypes[0])
+	}
+}
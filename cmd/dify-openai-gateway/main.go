@@ -0,0 +1,104 @@
+// dify-openai-gateway 以 OpenAI Chat Completions 协议对外提供 Dify 对话应用
+//
+// 环境变量：
+//
+//	DIFY_API_URL        Dify API 地址，如 https://api.dify.ai/v1
+//	DIFY_OPENAI_APPS    模型名与应用密钥，如 customer-service=app-xxx,faq=app-yyy
+//	GATEWAY_API_KEYS    可选，允许访问网关的密钥，逗号分隔，为空时不校验；Dify 用户标识由密钥推导
+//
+// 用法：
+//
+//	dify-openai-gateway -addr :8080
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/openai"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	flag.Parse()
+
+	apiUrl := os.Getenv("DIFY_API_URL")
+	if apiUrl == "" {
+		log.Fatal("DIFY_API_URL is required")
+	}
+	apps, parseErr := parseApps(os.Getenv("DIFY_OPENAI_APPS"))
+	if parseErr != nil {
+		log.Fatalf("parseAppsErr: %s", parseErr.Error())
+	}
+
+	var opts []dify.Option
+	for _, app := range apps {
+		opts = append(opts, dify.WithAppName(app.ApiKey, app.Model))
+	}
+	client := dify.NewClient(apiUrl, opts...)
+
+	server := openai.NewServer(openai.ServerOption{
+		Client:       client,
+		Apps:         apps,
+		Authenticate: authenticator(os.Getenv("GATEWAY_API_KEYS")),
+	})
+	log.Printf("listening on %s, models: %d", *addr, len(apps))
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
+
+// parseApps 解析 model=apiKey 列表
+func parseApps(value string) ([]openai.App, error) {
+	var apps []openai.App
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		model, apiKey, ok := strings.Cut(item, "=")
+		if !ok || model == "" || apiKey == "" {
+			return nil, fmt.Errorf("invalid app %q, want model=apiKey", item)
+		}
+		apps = append(apps, openai.App{Model: model, ApiKey: apiKey})
+	}
+	if len(apps) == 0 {
+		return nil, errors.New("DIFY_OPENAI_APPS is empty")
+	}
+	return apps, nil
+}
+
+// authenticator 校验 Authorization: Bearer 密钥，Dify 用户标识由密钥推导
+//
+// 请求中的 user 字段只用于区分同一密钥下的终端用户，持有一个密钥不能以其他密钥的用户身份
+// 继续会话；未配置密钥时不校验调用方，直接使用 user 字段。
+func authenticator(value string) func(r *http.Request, req *openai.ChatCompletionReq) (string, error) {
+	keys := make(map[string]bool)
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = true
+		}
+	}
+	return func(r *http.Request, req *openai.ChatCompletionReq) (string, error) {
+		if len(keys) == 0 {
+			return req.User, nil
+		}
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !keys[key] {
+			return "", errors.New("invalid api key")
+		}
+		// 使用密钥的哈希，避免把网关密钥写入 Dify
+		sum := sha256.Sum256([]byte(key))
+		user := "gateway-" + hex.EncodeToString(sum[:8])
+		if req.User != "" {
+			user += ":" + req.User
+		}
+		return user, nil
+	}
+}
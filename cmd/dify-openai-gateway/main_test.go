@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Davied-H/dify-go/openai"
+)
+
+func TestAuthenticator(t *testing.T) {
+	authenticate := authenticator("key-a, key-b")
+	user := func(key string, requestUser string) (string, error) {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		return authenticate(r, &openai.ChatCompletionReq{User: requestUser})
+	}
+
+	a, err := user("key-a", "")
+	if err != nil || !strings.HasPrefix(a, "gateway-") || strings.Contains(a, "key-a") {
+		t.Fatalf("user for key-a = %q, %v, want a hash of the key", a, err)
+	}
+	// 不同密钥即使声明相同的 user 也得到不同的 Dify 用户
+	aAlice, _ := user("key-a", "alice")
+	bAlice, _ := user("key-b", "alice")
+	if aAlice != a+":alice" || bAlice == aAlice {
+		t.Errorf("users = %q, %q, want them scoped to the key", aAlice, bAlice)
+	}
+	for _, key := range []string{"", "key-c"} {
+		if _, err := user(key, "alice"); err == nil {
+			t.Errorf("user(%q) error = nil, want invalid api key", key)
+		}
+	}
+	// /v1/models 没有请求体，传入空的请求
+	if _, err := authenticate(httptest.NewRequest(http.MethodGet, "/v1/models", nil), &openai.ChatCompletionReq{}); err == nil {
+		t.Error("models without a key error = nil")
+	}
+
+	open := authenticator("")
+	if got, err := open(httptest.NewRequest(http.MethodPost, "/", nil), &openai.ChatCompletionReq{User: "alice"}); err != nil || got != "alice" {
+		t.Errorf("open gateway user = %q, %v, want alice", got, err)
+	}
+}
+
+func TestParseApps(t *testing.T) {
+	apps, err := parseApps(" customer-service=app-a, faq=app-b ,")
+	if err != nil || len(apps) != 2 || apps[1].Model != "faq" || apps[1].ApiKey != "app-b" {
+		t.Errorf("parseApps() = %+v, %v", apps, err)
+	}
+	for _, value := range []string{"", "faq", "=app-a", "faq="} {
+		if _, err := parseApps(value); err == nil {
+			t.Errorf("parseApps(%q) error = nil", value)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+const chatHelp = `命令：
+  /stop              停止当前回答，也可以按 Ctrl+C
+  /new               开始新会话
+  /suggest           获取上一条回答的建议问题
+  /history [n]       查看当前会话最近 n 条消息，默认 10
+  /upload <file>     上传文件，随下一条消息发送
+  /inputs [k=v ...]  设置应用变量，k= 删除变量，不带参数时列出
+  /help              显示帮助
+  /exit              退出
+`
+
+// runChat 与应用进行交互式对话
+func runChat(args []string) error {
+	flags := flag.NewFlagSet("chat", flag.ExitOnError)
+	apiKey := flags.String("key", os.Getenv("DIFY_API_KEY"), "应用密钥，默认使用环境变量 DIFY_API_KEY")
+	user := flags.String("user", "dify-cli", "用户标识")
+	conversationId := flags.String("conversation", "", "继续已有的会话")
+	verbose := flags.Bool("v", false, "显示工作流节点事件和用量")
+	_ = flags.Parse(args)
+
+	if *apiKey == "" {
+		flags.Usage()
+		return errors.New("-key or DIFY_API_KEY is required")
+	}
+	client, clientErr := newClient()
+	if clientErr != nil {
+		return clientErr
+	}
+
+	repl := &chatRepl{
+		client:         client,
+		apiKey:         *apiKey,
+		user:           *user,
+		verbose:        *verbose,
+		out:            os.Stdout,
+		conversationId: *conversationId,
+		inputs:         make(map[string]interface{}),
+	}
+	return repl.run(os.Stdin)
+}
+
+// chatRepl 交互式对话的状态，提问进行中时仍读取输入以响应 /stop
+type chatRepl struct {
+	client  dify.ClientI
+	apiKey  string
+	user    string
+	verbose bool
+	out     io.Writer
+
+	conversationId string
+	lastMessageId  string
+	inputs         map[string]interface{}
+	files          []dify.ChatMessageFile // 随下一条消息发送的文件
+
+	mu     sync.Mutex
+	taskId string // 进行中的回答
+}
+
+func (r *chatRepl) run(in io.Reader) error {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	fmt.Fprintln(r.out, "输入问题开始对话，/help 查看命令")
+	for {
+		fmt.Fprint(r.out, "> ")
+		var line string
+		select {
+		case received, ok := <-lines:
+			if !ok {
+				fmt.Fprintln(r.out)
+				return nil
+			}
+			line = strings.TrimSpace(received)
+		case <-interrupts:
+			fmt.Fprintln(r.out)
+			return nil
+		}
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "/") {
+			r.send(line, lines, interrupts)
+			continue
+		}
+
+		command, argument, _ := strings.Cut(line, " ")
+		argument = strings.TrimSpace(argument)
+		switch command {
+		case "/exit", "/quit":
+			return nil
+		case "/help":
+			fmt.Fprint(r.out, chatHelp)
+		case "/stop":
+			fmt.Fprintln(r.out, "当前没有进行中的回答")
+		case "/new":
+			r.conversationId = ""
+			r.lastMessageId = ""
+			r.files = nil
+			fmt.Fprintln(r.out, "已开始新会话")
+		case "/suggest":
+			r.suggest()
+		case "/history":
+			r.history(argument)
+		case "/upload":
+			r.upload(argument)
+		case "/inputs":
+			r.setInputs(argument)
+		default:
+			fmt.Fprintf(r.out, "未知命令 %s，/help 查看命令\n", command)
+		}
+	}
+}
+
+// send 流式发送问题，回答结束前 /stop 或 Ctrl+C 停止回答
+func (r *chatRepl) send(query string, lines <-chan string, interrupts <-chan os.Signal) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	option := dify.ChatMessageOption{
+		ApiKey: r.apiKey,
+		RequestBody: dify.ChatMessageReq{
+			Inputs:         r.inputs,
+			Query:          query,
+			ResponseMode:   dify.ResponseModeStreaming,
+			ConversationId: r.conversationId,
+			User:           r.user,
+			Files:          r.files,
+		},
+		OnEvent:  r.event,
+		AutoStop: &dify.AutoStopOption{},
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.client.ChatMessage(ctx, option)
+		done <- err
+	}()
+
+	stopped := false
+	stop := func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		if !r.stop() {
+			cancel()
+		}
+	}
+	for {
+		select {
+		case err := <-done:
+			r.mu.Lock()
+			r.taskId = ""
+			r.mu.Unlock()
+			if err != nil && !errors.Is(err, context.Canceled) {
+				fmt.Fprintf(r.out, "\n错误：%s\n", err.Error())
+				return
+			}
+			r.files = nil
+			if stopped {
+				fmt.Fprintln(r.out, "[已停止]")
+			}
+			return
+		case line, ok := <-lines:
+			if !ok {
+				stop()
+				lines = nil
+				continue
+			}
+			if strings.TrimSpace(line) == "/stop" {
+				stop()
+				continue
+			}
+			fmt.Fprintln(r.out, "\n[正在回答，输入 /stop 或按 Ctrl+C 停止]")
+		case <-interrupts:
+			stop()
+		}
+	}
+}
+
+// stop 调用 StopTask 停止进行中的回答，还没有收到 task_id 或调用失败时返回 false
+func (r *chatRepl) stop() bool {
+	r.mu.Lock()
+	taskId := r.taskId
+	r.mu.Unlock()
+	if taskId == "" {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := r.client.StopTask(ctx, dify.StopTaskOption{
+		ApiKey: r.apiKey,
+		TaskId: taskId,
+		RequestBody: dify.StopTaskReq{
+			User: r.user,
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(r.out, "\n停止失败：%s\n", err.Error())
+		return false
+	}
+	return true
+}
+
+// event 输出流式事件，在 ChatMessage 的 goroutine 中调用
+func (r *chatRepl) event(ev dify.ChatMessageRespSSEData) {
+	if ev.TaskId != "" {
+		r.mu.Lock()
+		r.taskId = ev.TaskId
+		r.mu.Unlock()
+	}
+	if ev.ConversationId != "" {
+		r.conversationId = ev.ConversationId
+	}
+	if ev.MessageId != "" {
+		r.lastMessageId = ev.MessageId
+	}
+
+	switch ev.Event {
+	case "message", "agent_message":
+		fmt.Fprint(r.out, ev.Answer)
+	case "message_replace":
+		fmt.Fprintf(r.out, "\n[回答已替换]\n%s", ev.Answer)
+	case "message_end":
+		fmt.Fprintln(r.out)
+		if r.verbose {
+			usage := ev.Metadata.Usage
+			fmt.Fprintf(r.out, "[用量] prompt %d + completion %d = %d tokens, %.2fs\n",
+				usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, usage.Latency)
+			for _, resource := range ev.Metadata.RetrieverResources {
+				fmt.Fprintf(r.out, "[引用] %s / %s\n", resource.DatasetName, resource.DocumentName)
+			}
+		}
+	case "error":
+		fmt.Fprintln(r.out, "\n[回答出错]")
+	}
+
+	if !r.verbose {
+		return
+	}
+	switch ev.Event {
+	case "workflow_started":
+		fmt.Fprintf(r.out, "[工作流开始] %s\n", ev.Data.WorkflowId)
+	case "node_started":
+		fmt.Fprintf(r.out, "[节点开始] #%d %s (%s)\n", ev.Data.Index, ev.Data.Title, ev.Data.NodeType)
+	case "node_finished":
+		fmt.Fprintf(r.out, "[节点结束] #%d %s %s %.2fs", ev.Data.Index, ev.Data.Title, ev.Data.Status, ev.Data.ElapsedTime)
+		if ev.Data.Error != "" {
+			fmt.Fprintf(r.out, " %s", ev.Data.Error)
+		}
+		fmt.Fprintln(r.out)
+	case "workflow_finished":
+		fmt.Fprintf(r.out, "[工作流结束] %s %d 步 %d tokens %.2fs\n", ev.Data.Status, ev.Data.TotalSteps, ev.Data.TotalTokens, ev.Data.ElapsedTime)
+	}
+}
+
+func (r *chatRepl) suggest() {
+	if r.lastMessageId == "" {
+		fmt.Fprintln(r.out, "还没有回答")
+		return
+	}
+	resp, err := r.client.GetSuggested(context.Background(), dify.GetSuggestedOption{
+		ApiKey:    r.apiKey,
+		MessageId: r.lastMessageId,
+		RequestParams: dify.GetSuggestedReq{
+			User: r.user,
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(r.out, "错误：%s\n", err.Error())
+		return
+	}
+	if len(resp.Data) == 0 {
+		fmt.Fprintln(r.out, "没有建议问题")
+		return
+	}
+	for i, question := range resp.Data {
+		fmt.Fprintf(r.out, "%d. %s\n", i+1, question)
+	}
+}
+
+func (r *chatRepl) history(argument string) {
+	if r.conversationId == "" {
+		fmt.Fprintln(r.out, "还没有会话")
+		return
+	}
+	limit := 10
+	if argument != "" {
+		n, err := strconv.Atoi(argument)
+		if err != nil || n <= 0 {
+			fmt.Fprintln(r.out, "用法：/history [n]")
+			return
+		}
+		limit = n
+	}
+	resp, err := r.client.GetMessages(context.Background(), dify.GetMessagesOption{
+		ApiKey: r.apiKey,
+		RequestParams: dify.GetMessagesReq{
+			ConversationId: r.conversationId,
+			User:           r.user,
+			Limit:          limit,
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(r.out, "错误：%s\n", err.Error())
+		return
+	}
+	// 接口返回最近的 limit 条消息，页内按时间正序
+	messages := resp.Data
+	for _, message := range messages {
+		createdAt := time.Unix(int64(message.CreatedAt), 0).Format(time.DateTime)
+		fmt.Fprintf(r.out, "[%s]\n用户：%s\n助手：%s\n\n", createdAt, message.Query, message.Answer)
+	}
+	if len(messages) == 0 {
+		fmt.Fprintln(r.out, "没有消息")
+	}
+}
+
+func (r *chatRepl) upload(path string) {
+	if path == "" {
+		fmt.Fprintln(r.out, "用法：/upload <file>")
+		return
+	}
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		fmt.Fprintf(r.out, "错误：%s\n", openErr.Error())
+		return
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	resp, err := r.client.UploadFile(context.Background(), dify.UploadFileOption{
+		ApiKey: r.apiKey,
+		RequestFormData: dify.UploadFileReq{
+			File: file,
+			User: r.user,
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(r.out, "错误：%s\n", err.Error())
+		return
+	}
+	r.files = append(r.files, dify.ChatMessageFile{
+		Type:           fileType(path),
+		TransferMethod: "local_file",
+		UploadFileId:   resp.Id,
+	})
+	fmt.Fprintf(r.out, "已上传 %s，将随下一条消息发送\n", resp.Name)
+}
+
+// fileType 按扩展名判断 Dify 的文件类型
+func fileType(path string) string {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")) {
+	case "jpg", "jpeg", "png", "gif", "webp", "svg":
+		return "image"
+	case "mp3", "m4a", "wav", "webm", "amr", "mpga":
+		return "audio"
+	case "mp4", "mov", "mpeg":
+		return "video"
+	case "txt", "md", "markdown", "pdf", "html", "xlsx", "xls", "docx", "csv", "eml", "msg", "pptx", "ppt", "xml", "epub":
+		return "document"
+	}
+	return "custom"
+}
+
+func (r *chatRepl) setInputs(argument string) {
+	if argument == "" {
+		if len(r.inputs) == 0 {
+			fmt.Fprintln(r.out, "没有设置变量")
+			return
+		}
+		keys := make([]string, 0, len(r.inputs))
+		for key := range r.inputs {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			fmt.Fprintf(r.out, "%s=%v\n", key, r.inputs[key])
+		}
+		return
+	}
+	for _, pair := range strings.Fields(argument) {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(r.out, "无效的变量 %q，格式 k=v\n", pair)
+			continue
+		}
+		if value == "" {
+			delete(r.inputs, key)
+			continue
+		}
+		r.inputs[key] = value
+	}
+}
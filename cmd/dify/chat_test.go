@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+// syncBuffer 可在多个 goroutine 中写入的输出
+type syncBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.String()
+}
+
+// replHarness 逐行输入并等待提示符，避免回答进行中的输入被忽略
+type replHarness struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  *syncBuffer
+	done chan error
+}
+
+func startRepl(t *testing.T, server *difytest.Server) *replHarness {
+	t.Helper()
+	reader, writer := io.Pipe()
+	h := &replHarness{t: t, in: writer, out: &syncBuffer{}, done: make(chan error, 1)}
+	repl := &chatRepl{
+		client: dify.NewClient(server.URL),
+		apiKey: "app-test",
+		user:   "user-1",
+		out:    h.out,
+		inputs: make(map[string]interface{}),
+	}
+	go func() {
+		h.done <- repl.run(reader)
+	}()
+	h.waitFor("> ", 1)
+	t.Cleanup(func() {
+		_ = writer.Close()
+	})
+	return h
+}
+
+// waitFor 等待输出中 s 出现至少 n 次
+func (h *replHarness) waitFor(s string, n int) {
+	h.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(h.out.String(), s) < n {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out waiting for %q, output:\n%s", s, h.out.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// input 输入一行，等待下一个提示符，返回这一行产生的输出
+func (h *replHarness) input(line string) string {
+	h.t.Helper()
+	before := h.out.String()
+	if _, err := io.WriteString(h.in, line+"\n"); err != nil {
+		h.t.Fatal(err)
+	}
+	h.waitFor("> ", strings.Count(before, "> ")+1)
+	return strings.TrimSuffix(strings.TrimPrefix(h.out.String(), before), "> ")
+}
+
+func TestChatRepl(t *testing.T) {
+	server := difytest.NewServer()
+	defer server.Close()
+	server.Enqueue(difytest.Reply{Answer: "一"}, difytest.Reply{Answer: "二", Suggested: []string{"然后呢"}})
+	h := startRepl(t, server)
+
+	tests := []struct {
+		line string
+		want []string // 按顺序出现
+	}{
+		{line: "/history", want: []string{"还没有会话"}},
+		{line: "/inputs k=v", want: nil},
+		{line: "first", want: []string{"一"}},
+		{line: "second", want: []string{"二"}},
+		{line: "/history", want: []string{"用户：first\n助手：一", "用户：second\n助手：二"}},
+		{line: "/history 1", want: []string{"用户：second"}},
+		{line: "/history x", want: []string{"用法：/history [n]"}},
+		{line: "/suggest", want: []string{"1. 然后呢"}},
+		{line: "/inputs", want: []string{"k=v"}},
+		{line: "/unknown", want: []string{"未知命令 /unknown"}},
+		{line: "/new", want: []string{"已开始新会话"}},
+		{line: "/history", want: []string{"还没有会话"}},
+	}
+	for _, tt := range tests {
+		output := h.input(tt.line)
+		position := 0
+		for _, want := range tt.want {
+			i := strings.Index(output[position:], want)
+			if i < 0 {
+				t.Errorf("%s output = %q, want %q in order", tt.line, output, want)
+				break
+			}
+			position += i + len(want)
+		}
+	}
+	var body dify.ChatMessageReq
+	requests := server.RequestsTo(http.MethodPost, "/chat-messages")
+	if err := requests[1].JSON(&body); err != nil || body.ConversationId == "" || body.Inputs["k"] != "v" {
+		t.Errorf("second request body = %+v, %v", body, err)
+	}
+
+	if _, err := io.WriteString(h.in, "/exit\n"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-h.done:
+		if err != nil {
+			t.Errorf("run() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("/exit did not end the repl")
+	}
+}
+
+func TestChatReplStop(t *testing.T) {
+	server := difytest.NewServer()
+	defer server.Close()
+	server.Enqueue(difytest.Reply{Chunks: []string{"a", "b", "c", "d", "e"}, Delay: 50 * time.Millisecond})
+	h := startRepl(t, server)
+
+	if _, err := io.WriteString(h.in, "hi\n"); err != nil {
+		t.Fatal(err)
+	}
+	h.waitFor("a", 1)
+	h.input("/stop")
+	if output := h.out.String(); !strings.Contains(output, "[已停止]") || strings.Contains(output, "abcde") {
+		t.Errorf("output = %q, want a stopped answer", output)
+	}
+	var stops int
+	for _, request := range server.Requests() {
+		if strings.HasSuffix(request.Path, "/stop") {
+			stops++
+		}
+	}
+	if stops != 1 {
+		t.Errorf("stop requests = %d, want 1", stops)
+	}
+}
+
+func TestFileType(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "a.PNG", want: "image"},
+		{path: "voice.mp3", want: "audio"},
+		{path: "clip.mov", want: "video"},
+		{path: "notes.md", want: "document"},
+		{path: "archive.zip", want: "custom"},
+		{path: "noext", want: "custom"},
+	}
+	for _, tt := range tests {
+		if got := fileType(tt.path); got != tt.want {
+			t.Errorf("fileType(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
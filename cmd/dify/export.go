@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+// runExport 导出用户的会话和消息
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	var apps appsFlag
+	flags.Var(&apps, "app", "应用名与密钥，格式 name=apiKey，可重复")
+	user := flags.String("user", "", "用户标识")
+	format := flags.String("format", "jsonl", "导出格式：jsonl 或 markdown")
+	since := flags.String("since", "", "只导出此日期及之后的消息，格式 2006-01-02")
+	until := flags.String("until", "", "只导出此日期之前的消息，格式 2006-01-02")
+	output := flags.String("o", "", "输出文件，默认标准输出")
+	_ = flags.Parse(args)
+
+	if *user == "" || len(apps) == 0 {
+		flags.Usage()
+		return errors.New("-user and -app are required")
+	}
+	option := dify.ExportOption{
+		Apps: apps,
+		User: *user,
+	}
+	switch *format {
+	case "jsonl":
+		option.Format = dify.ExportFormatJSONL
+	case "markdown", "md":
+		option.Format = dify.ExportFormatMarkdown
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	var parseErr error
+	if option.Since, parseErr = parseDate(*since); parseErr != nil {
+		return parseErr
+	}
+	if option.Until, parseErr = parseDate(*until); parseErr != nil {
+		return parseErr
+	}
+
+	client, clientErr := newClient()
+	if clientErr != nil {
+		return clientErr
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, createErr := os.Create(*output)
+		if createErr != nil {
+			return fmt.Errorf("createErr: %w", createErr)
+		}
+		defer func(file *os.File) {
+			_ = file.Close()
+		}(file)
+		w = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	summary, exportErr := dify.Export(ctx, client, w, option)
+	fmt.Fprintf(os.Stderr, "exported %d conversations, %d messages\n", summary.Conversations, summary.Messages)
+	return exportErr
+}
+
+// parseDate 按本地时区解析日期，空字符串返回零值
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, want 2006-01-02", value)
+	}
+	return t, nil
+}
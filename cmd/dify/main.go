@@ -0,0 +1,84 @@
+// dify 命令行工具
+//
+// 环境变量 DIFY_API_URL 为 Dify API 地址，如 https://api.dify.ai/v1。
+//
+// 用法：
+//
+//	dify chat -key app-xxx [-user user_id] [-conversation id] [-v]
+//	dify export -user user_id -app name=app-xxx [-format jsonl|markdown] [-since 2006-01-02] [-until 2006-01-02] [-o file]
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "chat":
+		err = runChat(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: dify <command> [flags]
+
+Commands:
+  chat      与应用进行交互式对话
+  export    导出用户的会话和消息
+
+Run "dify <command> -h" for the flags of a command.
+`)
+}
+
+// newClient 根据环境变量创建客户端
+func newClient() (dify.ClientI, error) {
+	apiUrl := os.Getenv("DIFY_API_URL")
+	if apiUrl == "" {
+		return nil, errors.New("DIFY_API_URL is required")
+	}
+	return dify.NewClient(apiUrl), nil
+}
+
+// appsFlag 可重复的 -app name=apiKey 参数
+type appsFlag []dify.ExportApp
+
+func (f *appsFlag) String() string {
+	names := make([]string, 0, len(*f))
+	for _, app := range *f {
+		names = append(names, app.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *appsFlag) Set(value string) error {
+	name, apiKey, ok := strings.Cut(value, "=")
+	if !ok || name == "" || apiKey == "" {
+		return fmt.Errorf("invalid app %q, want name=apiKey", value)
+	}
+	*f = append(*f, dify.ExportApp{Name: name, ApiKey: apiKey})
+	return nil
+}
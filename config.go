@@ -3,8 +3,17 @@ package dify
 import "net/http"
 
 type ClientConfig struct {
-	ApiBaseUrl string
-	HttpClient *http.Client
+	ApiBaseUrl     string
+	HttpClient     *http.Client
+	ApiKeyProvider ApiKeyProvider        // 可选，为空时直接使用 Option 中的 ApiKey
+	RateLimit      *RateLimitConfig      // 可选，为空时不限流
+	CircuitBreaker *CircuitBreakerConfig // 可选，为空时不启用熔断
+	Endpoints      *EndpointsConfig      // 可选，设置后在多个服务地址间选择与切换，ApiBaseUrl 不再使用
+	Observers      []Observer            // 可选，观察每次 API 调用，如链路追踪、指标
+	AppNames       map[string]string     // 可选，密钥到应用名的映射，用于观察者等场景标识应用
+	Middlewares    []Middleware          // 可选，按顺序包装每次方法调用，第一个位于最外层
+	UsageRecorder  UsageRecorder         // 可选，记录每条消息的用量
+	BudgetPolicy   *BudgetPolicy         // 可选，调用前检查用户额度并在消息结束后扣减
 }
 
 type Option func(*ClientConfig)
@@ -15,3 +24,69 @@ func DefaultConfig(apiUrl string) *ClientConfig {
 		HttpClient: &http.Client{},
 	}
 }
+
+// WithApiKeyProvider 设置密钥提供者，用于多密钥轮换与故障转移
+func WithApiKeyProvider(provider ApiKeyProvider) Option {
+	return func(config *ClientConfig) {
+		config.ApiKeyProvider = provider
+	}
+}
+
+// WithRateLimit 设置客户端限流，按密钥分别限制流式与阻塞请求的速率和并发数
+func WithRateLimit(rateLimit RateLimitConfig) Option {
+	return func(config *ClientConfig) {
+		config.RateLimit = &rateLimit
+	}
+}
+
+// WithCircuitBreaker 启用熔断，后端持续故障时请求直接返回 ErrCircuitOpen
+func WithCircuitBreaker(circuitBreaker CircuitBreakerConfig) Option {
+	return func(config *ClientConfig) {
+		config.CircuitBreaker = &circuitBreaker
+	}
+}
+
+// WithEndpoints 配置多个服务地址，支持健康检查、加权或按延迟选择以及故障切换
+func WithEndpoints(endpoints EndpointsConfig) Option {
+	return func(config *ClientConfig) {
+		config.Endpoints = &endpoints
+	}
+}
+
+// WithObserver 添加调用观察者
+func WithObserver(observer Observer) Option {
+	return func(config *ClientConfig) {
+		config.Observers = append(config.Observers, observer)
+	}
+}
+
+// WithAppName 为密钥设置可读的应用名
+func WithAppName(apiKey string, name string) Option {
+	return func(config *ClientConfig) {
+		if config.AppNames == nil {
+			config.AppNames = make(map[string]string)
+		}
+		config.AppNames[apiKey] = name
+	}
+}
+
+// WithMiddleware 添加中间件
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(config *ClientConfig) {
+		config.Middlewares = append(config.Middlewares, middlewares...)
+	}
+}
+
+// WithUsageRecorder 设置用量记录器
+func WithUsageRecorder(recorder UsageRecorder) Option {
+	return func(config *ClientConfig) {
+		config.UsageRecorder = recorder
+	}
+}
+
+// WithBudgetPolicy 设置用户额度策略，policy.Store 为空时受限用户的请求返回错误
+func WithBudgetPolicy(policy BudgetPolicy) Option {
+	return func(config *ClientConfig) {
+		config.BudgetPolicy = &policy
+	}
+}
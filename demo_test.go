@@ -8,13 +8,21 @@ import (
 )
 
 func init() {
-	loadEnvErr := godotenv.Load(".env")
-	if loadEnvErr != nil {
-		panic(loadEnvErr)
+	// 也可以直接通过环境变量配置，.env 不存在时忽略
+	_ = godotenv.Load(".env")
+}
+
+// requireDemoEnv 演示测试需要真实的 Dify 服务，未配置时跳过
+func requireDemoEnv(t *testing.T) {
+	t.Helper()
+	if os.Getenv("DIFY_API_URL") == "" || os.Getenv("DIFY_API_KEY") == "" {
+		t.Skip("DIFY_API_URL or DIFY_API_KEY is not set")
 	}
 }
 
 func Test_chatMessageStreamDemo(t *testing.T) {
+	requireDemoEnv(t)
+
 	tests := []struct {
 		name string
 	}{
@@ -28,6 +36,8 @@ func Test_chatMessageStreamDemo(t *testing.T) {
 }
 
 func Test_chatMessageBlockDemo(t *testing.T) {
+	requireDemoEnv(t)
+
 	tests := []struct {
 		name string
 	}{
@@ -41,6 +51,8 @@ func Test_chatMessageBlockDemo(t *testing.T) {
 }
 
 func Test_stopTaskDemo(t *testing.T) {
+	requireDemoEnv(t)
+
 	type args struct {
 		taskId string
 	}
@@ -63,6 +75,8 @@ func Test_stopTaskDemo(t *testing.T) {
 }
 
 func Test_getSuggestedDemo(t *testing.T) {
+	requireDemoEnv(t)
+
 	type args struct {
 		messageId string
 	}
@@ -82,6 +96,8 @@ func Test_getSuggestedDemo(t *testing.T) {
 }
 
 func Test_getMessagesDemo(t *testing.T) {
+	requireDemoEnv(t)
+
 	type args struct {
 		conversationId string
 	}
@@ -104,6 +120,8 @@ func Test_getMessagesDemo(t *testing.T) {
 }
 
 func Test_uploadFileDemo(t *testing.T) {
+	requireDemoEnv(t)
+
 	type args struct {
 		f *os.File
 	}
@@ -132,6 +150,8 @@ func Test_uploadFileDemo(t *testing.T) {
 }
 
 func Test_conversationRenameDemo(t *testing.T) {
+	requireDemoEnv(t)
+
 	type args struct {
 	}
 	tests := []struct {
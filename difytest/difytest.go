@@ -0,0 +1,674 @@
+// Package difytest 提供进程内的 Dify 模拟服务，用于离线测试使用客户端的代码
+//
+// Server 实现客户端支持的 Service API，保存会话和消息，回答内容可以预先编排：
+//
+//	server := difytest.NewServer()
+//	defer server.Close()
+//	server.Enqueue(difytest.Reply{Chunks: []string{"你", "好"}, Delay: 10 * time.Millisecond})
+//	server.Enqueue(difytest.Reply{Error: &difytest.Error{Status: 429, Code: "too_many_requests"}})
+//
+//	client := dify.NewClient(server.URL)
+//	...
+//	server.AssertRequested(t, http.MethodPost, "/chat-messages")
+package difytest
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+// Error 模拟的错误响应
+type Error struct {
+	Status  int    // HTTP 状态码
+	Code    string // 错误码，如 invalid_param
+	Message string
+}
+
+// Reply 一次 ChatMessage 的回答
+type Reply struct {
+	Answer    string        // 回答内容，流式模式下 Chunks 为空时按字拆分
+	Chunks    []string      // 流式模式下依次发送的回答片段，为空时使用 Answer
+	Delay     time.Duration // 流式模式下每个片段之前的等待时间
+	DropAfter int           // 大于 0 时发送这么多个片段后直接断开连接，不发送 message_end
+	Usage     dify.Usage    // message_end 或阻塞响应中的用量
+	Suggested []string      // 该消息的建议问题
+	Error     *Error        // 不为空时直接返回错误
+}
+
+func (r Reply) answer() string {
+	if len(r.Chunks) > 0 {
+		return strings.Join(r.Chunks, "")
+	}
+	return r.Answer
+}
+
+func (r Reply) chunks() []string {
+	if len(r.Chunks) > 0 {
+		return r.Chunks
+	}
+	var chunks []string
+	for _, char := range r.Answer {
+		chunks = append(chunks, string(char))
+	}
+	return chunks
+}
+
+// Request 服务收到的一个请求
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	ApiKey string // 从 Authorization 请求头中取出的密钥
+	Body   []byte
+}
+
+// JSON 将请求体解析到 v
+func (r Request) JSON(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Server 模拟的 Dify 服务
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	apiKeys       map[string]bool
+	replies       []Reply
+	responder     func(req dify.ChatMessageReq) Reply
+	failures      map[string][]Error // 按 "METHOD /path" 注入的错误
+	requests      []Request
+	conversations map[string]*conversation
+	messages      map[string]*message
+	tasks         map[string]chan struct{} // 进行中的流式任务，关闭表示已停止
+	sequence      int
+	now           func() time.Time
+}
+
+type conversation struct {
+	dify.Conversation
+	user     string
+	sequence int // 创建顺序
+	messages []*message
+}
+
+type message struct {
+	dify.Message
+	user      string
+	suggested []string
+}
+
+// NewServer 启动模拟服务，使用完毕后调用 Close
+func NewServer() *Server {
+	s := &Server{
+		failures:      make(map[string][]Error),
+		conversations: make(map[string]*conversation),
+		messages:      make(map[string]*message),
+		tasks:         make(map[string]chan struct{}),
+		now:           time.Now,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// RequireApiKeys 只接受这些密钥，其他密钥返回 401；默认接受任意非空密钥
+func (s *Server) RequireApiKeys(apiKeys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiKeys = make(map[string]bool)
+	for _, apiKey := range apiKeys {
+		s.apiKeys[apiKey] = true
+	}
+}
+
+// Enqueue 按顺序为之后的 ChatMessage 编排回答，用完后使用 Respond 设置的回答或回显提问
+func (s *Server) Enqueue(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Respond 根据请求动态生成回答，优先级低于 Enqueue
+func (s *Server) Respond(responder func(req dify.ChatMessageReq) Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responder = responder
+}
+
+// Fail 让之后对 method path 的请求依次返回这些错误，path 不含查询参数，如 /messages
+func (s *Server) Fail(method string, path string, errs ...Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := method + " " + path
+	s.failures[key] = append(s.failures[key], errs...)
+}
+
+// Requests 返回收到的全部请求
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo 返回对 method path 的请求
+func (s *Server) RequestsTo(method string, path string) []Request {
+	var requests []Request
+	for _, request := range s.Requests() {
+		if request.Method == method && request.Path == path {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// AssertRequested 断言收到过对 method path 的请求，返回最后一个
+func (s *Server) AssertRequested(tb testing.TB, method string, path string) Request {
+	tb.Helper()
+	requests := s.RequestsTo(method, path)
+	if len(requests) == 0 {
+		tb.Fatalf("difytest: no %s %s request, got %s", method, path, s.requestSummary())
+		return Request{}
+	}
+	return requests[len(requests)-1]
+}
+
+// AssertNotRequested 断言没有收到对 method path 的请求
+func (s *Server) AssertNotRequested(tb testing.TB, method string, path string) {
+	tb.Helper()
+	if requests := s.RequestsTo(method, path); len(requests) > 0 {
+		tb.Fatalf("difytest: unexpected %d %s %s requests", len(requests), method, path)
+	}
+}
+
+func (s *Server) requestSummary() string {
+	var lines []string
+	for _, request := range s.Requests() {
+		lines = append(lines, request.Method+" "+request.Path)
+	}
+	if len(lines) == 0 {
+		return "no requests"
+	}
+	return "[" + strings.Join(lines, ", ") + "]"
+}
+
+// Conversations 返回用户的全部会话，按创建时间正序
+func (s *Server) Conversations(user string) []dify.Conversation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var conversations []dify.Conversation
+	for _, c := range s.sortedConversations(user) {
+		conversations = append(conversations, c.Conversation)
+	}
+	return conversations
+}
+
+// Messages 返回会话的全部消息，按时间正序，会话不存在时返回 nil
+func (s *Server) Messages(conversationId string) []dify.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.conversations[conversationId]
+	if !ok {
+		return nil
+	}
+	messages := make([]dify.Message, 0, len(c.messages))
+	for _, m := range c.messages {
+		messages = append(messages, m.Message)
+	}
+	return messages
+}
+
+// nextId 生成递增的 ID，调用方需持有锁
+func (s *Server) nextId(prefix string) string {
+	s.sequence++
+	return prefix + "-" + strconv.Itoa(s.sequence)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	apiKey := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	request := Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		ApiKey: apiKey,
+		Body:   body,
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	allowed := apiKey != "" && (s.apiKeys == nil || s.apiKeys[apiKey])
+	key := r.Method + " " + r.URL.Path
+	var failure *Error
+	// 被拒绝的请求不消耗编排的错误
+	if errs := s.failures[key]; allowed && len(errs) > 0 {
+		failure = &errs[0]
+		s.failures[key] = errs[1:]
+	}
+	s.mu.Unlock()
+
+	if !allowed {
+		writeError(w, Error{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "Access token is invalid"})
+		return
+	}
+	if failure != nil {
+		writeError(w, *failure)
+		return
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/info":
+		writeJSON(w, http.StatusOK, map[string]string{"name": "difytest", "mode": "chat"})
+	case r.Method == http.MethodPost && r.URL.Path == "/chat-messages":
+		s.chatMessage(w, r, request)
+	case r.Method == http.MethodPost && len(segments) == 3 && segments[0] == "chat-messages" && segments[2] == "stop":
+		s.stopTask(w, segments[1])
+	case r.Method == http.MethodPost && r.URL.Path == "/files/upload":
+		s.uploadFile(w, r)
+	case r.Method == http.MethodGet && len(segments) == 3 && segments[0] == "messages" && segments[2] == "suggested":
+		s.suggested(w, request, segments[1])
+	case r.Method == http.MethodGet && r.URL.Path == "/messages":
+		s.getMessages(w, request)
+	case r.Method == http.MethodGet && r.URL.Path == "/conversations":
+		s.getConversations(w, request)
+	case r.Method == http.MethodDelete && len(segments) == 2 && segments[0] == "conversations":
+		s.deleteConversation(w, request, segments[1])
+	case r.Method == http.MethodPost && len(segments) == 3 && segments[0] == "conversations" && segments[2] == "name":
+		s.renameConversation(w, request, segments[1])
+	default:
+		writeError(w, Error{Status: http.StatusNotFound, Code: "not_found", Message: fmt.Sprintf("%s %s is not supported by difytest", r.Method, r.URL.Path)})
+	}
+}
+
+func (s *Server) chatMessage(w http.ResponseWriter, r *http.Request, request Request) {
+	var req dify.ChatMessageReq
+	if unmarshalErr := request.JSON(&req); unmarshalErr != nil {
+		writeError(w, Error{Status: http.StatusBadRequest, Code: "invalid_param", Message: unmarshalErr.Error()})
+		return
+	}
+	if req.Query == "" || req.User == "" {
+		writeError(w, Error{Status: http.StatusBadRequest, Code: "invalid_param", Message: "query and user are required"})
+		return
+	}
+
+	s.mu.Lock()
+	var reply Reply
+	switch {
+	case len(s.replies) > 0:
+		reply = s.replies[0]
+		s.replies = s.replies[1:]
+	case s.responder != nil:
+		responder := s.responder
+		s.mu.Unlock()
+		reply = responder(req)
+		s.mu.Lock()
+	default:
+		reply = Reply{Answer: "echo: " + req.Query}
+	}
+	if reply.Error != nil {
+		s.mu.Unlock()
+		writeError(w, *reply.Error)
+		return
+	}
+
+	// 新建或继续会话
+	now := s.now()
+	c, ok := s.conversations[req.ConversationId]
+	if req.ConversationId != "" && (!ok || c.user != req.User) {
+		s.mu.Unlock()
+		writeError(w, Error{Status: http.StatusNotFound, Code: "not_found", Message: "Conversation Not Exists."})
+		return
+	}
+	if req.ConversationId == "" {
+		c = &conversation{user: req.User}
+		c.Id = s.nextId("conversation")
+		c.sequence = s.sequence
+		c.Name = "New conversation"
+		c.Inputs = req.Inputs
+		c.Status = "normal"
+		c.CreatedAt = int(now.Unix())
+		s.conversations[c.Id] = c
+	}
+	c.UpdatedAt = int(now.Unix())
+
+	m := &message{user: req.User, suggested: reply.Suggested}
+	m.Id = s.nextId("message")
+	m.ConversationId = c.Id
+	m.Query = req.Query
+	m.CreatedAt = int(now.Unix())
+	c.messages = append(c.messages, m)
+	s.messages[m.Id] = m
+	taskId := s.nextId("task")
+	stopped := make(chan struct{})
+	s.tasks[taskId] = stopped
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.tasks, taskId)
+		s.mu.Unlock()
+	}()
+
+	if req.ResponseMode != dify.ResponseModeStreaming {
+		s.setAnswer(m, reply.answer())
+		writeJSON(w, http.StatusOK, dify.ChatMessageResp{
+			Event:          "message",
+			TaskId:         taskId,
+			Id:             m.Id,
+			MessageId:      m.Id,
+			ConversationId: c.Id,
+			Mode:           "chat",
+			Answer:         reply.answer(),
+			Metadata:       dify.ChatMessageMetadata{Usage: reply.Usage},
+			CreatedAt:      m.CreatedAt,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	event := func(name string, answer string) dify.ChatMessageRespSSEData {
+		return dify.ChatMessageRespSSEData{
+			Event:          name,
+			ConversationId: c.Id,
+			MessageId:      m.Id,
+			CreatedAt:      m.CreatedAt,
+			TaskId:         taskId,
+			Id:             m.Id,
+			Answer:         answer,
+		}
+	}
+
+	var answer strings.Builder
+chunks:
+	for i, chunk := range reply.chunks() {
+		if reply.DropAfter > 0 && i >= reply.DropAfter {
+			// 模拟网络中断：Dify 端仍会完成生成并保存完整回答
+			s.setAnswer(m, reply.answer())
+			if hijacker, ok := w.(http.Hijacker); ok {
+				if conn, _, hijackErr := hijacker.Hijack(); hijackErr == nil {
+					_ = conn.Close()
+				}
+			}
+			return
+		}
+		if reply.Delay > 0 {
+			select {
+			case <-time.After(reply.Delay):
+			case <-stopped:
+				break chunks
+			case <-r.Context().Done():
+				return
+			}
+		}
+		select {
+		case <-stopped:
+			break chunks
+		default:
+		}
+		answer.WriteString(chunk)
+		writeEvent(w, event("message", chunk))
+		_ = controller.Flush()
+	}
+
+	s.setAnswer(m, answer.String())
+	end := event("message_end", "")
+	end.Metadata.Usage = reply.Usage
+	writeEvent(w, end)
+	_ = controller.Flush()
+}
+
+// setAnswer 保存消息的最终回答
+func (s *Server) setAnswer(m *message, answer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.Answer = answer
+}
+
+func (s *Server) stopTask(w http.ResponseWriter, taskId string) {
+	s.mu.Lock()
+	if stopped, ok := s.tasks[taskId]; ok {
+		delete(s.tasks, taskId)
+		close(stopped)
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, dify.StopTaskResp{Result: "success"})
+}
+
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request) {
+	file, header, formFileErr := r.FormFile("file")
+	if formFileErr != nil {
+		writeError(w, Error{Status: http.StatusBadRequest, Code: "no_file_uploaded", Message: formFileErr.Error()})
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	s.mu.Lock()
+	id := s.nextId("file")
+	s.mu.Unlock()
+	extension := ""
+	if i := strings.LastIndex(header.Filename, "."); i >= 0 {
+		extension = header.Filename[i+1:]
+	}
+	writeJSON(w, http.StatusCreated, dify.UploadFileResp{
+		Id:        id,
+		Name:      header.Filename,
+		Size:      int(header.Size),
+		Extension: extension,
+		MimeType:  header.Header.Get("Content-Type"),
+		CreatedBy: r.FormValue("user"),
+		CreatedAt: int(s.now().Unix()),
+	})
+}
+
+func (s *Server) suggested(w http.ResponseWriter, request Request, messageId string) {
+	s.mu.Lock()
+	m, ok := s.messages[messageId]
+	s.mu.Unlock()
+	if !ok || m.user != request.Query.Get("user") {
+		writeError(w, Error{Status: http.StatusNotFound, Code: "not_found", Message: "Message Not Exists."})
+		return
+	}
+	data := m.suggested
+	if data == nil {
+		data = []string{}
+	}
+	writeJSON(w, http.StatusOK, dify.GetSuggestedResp{Result: "success", Data: data})
+}
+
+func (s *Server) getMessages(w http.ResponseWriter, request Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.conversations[request.Query.Get("conversation_id")]
+	if !ok || c.user != request.Query.Get("user") {
+		writeError(w, Error{Status: http.StatusNotFound, Code: "not_found", Message: "Conversation Not Exists."})
+		return
+	}
+
+	// 从 first_id 之前（不含）向前取 limit 条，按时间正序返回
+	limit := queryLimit(request.Query)
+	end := len(c.messages)
+	if firstId := request.Query.Get("first_id"); firstId != "" {
+		end = -1
+		for i, m := range c.messages {
+			if m.Id == firstId {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			writeError(w, Error{Status: http.StatusNotFound, Code: "not_found", Message: "First Message Not Exists."})
+			return
+		}
+	}
+	start := max(0, end-limit)
+	resp := dify.GetMessagesResp{Limit: limit, HasMore: start > 0, Data: []dify.Message{}}
+	for _, m := range c.messages[start:end] {
+		resp.Data = append(resp.Data, m.Message)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) getConversations(w http.ResponseWriter, request Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversations := s.sortedConversations(request.Query.Get("user"))
+
+	// 按 sort_by 排序，默认 -updated_at
+	sortBy := request.Query.Get("sort_by")
+	if sortBy == "" {
+		sortBy = "-updated_at"
+	}
+	field := strings.TrimPrefix(sortBy, "-")
+	descending := strings.HasPrefix(sortBy, "-")
+	sortConversations(conversations, field, descending)
+
+	start := 0
+	if lastId := request.Query.Get("last_id"); lastId != "" {
+		start = -1
+		for i, c := range conversations {
+			if c.Id == lastId {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			writeError(w, Error{Status: http.StatusNotFound, Code: "not_found", Message: "Last Conversation Not Exists."})
+			return
+		}
+	}
+	limit := queryLimit(request.Query)
+	end := min(len(conversations), start+limit)
+	resp := dify.GetConversationsResp{Limit: limit, HasMore: end < len(conversations), Data: []dify.Conversation{}}
+	for _, c := range conversations[start:end] {
+		resp.Data = append(resp.Data, c.Conversation)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) deleteConversation(w http.ResponseWriter, request Request, conversationId string) {
+	var req dify.DeleteConversationReq
+	_ = request.JSON(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.conversations[conversationId]
+	if !ok || c.user != req.User {
+		writeError(w, Error{Status: http.StatusNotFound, Code: "not_found", Message: "Conversation Not Exists."})
+		return
+	}
+	for _, m := range c.messages {
+		delete(s.messages, m.Id)
+	}
+	delete(s.conversations, conversationId)
+	writeJSON(w, http.StatusOK, dify.DeleteConversationResp{Result: "success"})
+}
+
+func (s *Server) renameConversation(w http.ResponseWriter, request Request, conversationId string) {
+	var req dify.ConversationRenameReq
+	_ = request.JSON(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.conversations[conversationId]
+	if !ok || c.user != req.User {
+		writeError(w, Error{Status: http.StatusNotFound, Code: "not_found", Message: "Conversation Not Exists."})
+		return
+	}
+	switch {
+	case req.Name != "":
+		c.Name = req.Name
+	case req.AutoGenerate && len(c.messages) > 0:
+		c.Name = c.messages[0].Query
+	}
+	c.UpdatedAt = int(s.now().Unix())
+	writeJSON(w, http.StatusOK, dify.ConversationRenameResp{
+		Id:        c.Id,
+		Name:      c.Name,
+		Status:    c.Status,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	})
+}
+
+// sortedConversations 返回用户的会话，按创建顺序，调用方需持有锁
+func (s *Server) sortedConversations(user string) []*conversation {
+	var conversations []*conversation
+	for _, c := range s.conversations {
+		if c.user == user {
+			conversations = append(conversations, c)
+		}
+	}
+	sortConversations(conversations, "created_at", false)
+	return conversations
+}
+
+// sortConversations 按字段排序，时间相同时按创建顺序
+func sortConversations(conversations []*conversation, field string, descending bool) {
+	key := func(c *conversation) int {
+		if field == "updated_at" {
+			return c.UpdatedAt
+		}
+		return c.CreatedAt
+	}
+	slices.SortStableFunc(conversations, func(a, b *conversation) int {
+		if descending {
+			a, b = b, a
+		}
+		if n := cmp.Compare(key(a), key(b)); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.sequence, b.sequence)
+	})
+}
+
+// queryLimit 返回 limit 参数，默认 20，与 Dify 一致限制在 1 到 100 之间
+func queryLimit(query url.Values) int {
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		return 20
+	}
+	return min(limit, 100)
+}
+
+func writeEvent(w io.Writer, ev dify.ChatMessageRespSSEData) {
+	data, _ := json.Marshal(ev)
+	_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+func writeError(w http.ResponseWriter, e Error) {
+	if e.Status == 0 {
+		e.Status = http.StatusBadRequest
+	}
+	writeJSON(w, e.Status, map[string]any{
+		"code":    e.Code,
+		"message": e.Message,
+		"status":  e.Status,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
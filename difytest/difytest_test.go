@@ -0,0 +1,197 @@
+package difytest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+func newServer(t *testing.T) (*Server, dify.ClientI) {
+	t.Helper()
+	s := NewServer()
+	t.Cleanup(s.Close)
+	return s, dify.NewClient(s.URL)
+}
+
+func send(client dify.ClientI, apiKey string, conversationId string, query string) (*dify.ChatMessageResp, error) {
+	return client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		ApiKey: apiKey,
+		RequestBody: dify.ChatMessageReq{
+			Query:          query,
+			ResponseMode:   dify.ResponseModeBlocking,
+			ConversationId: conversationId,
+			User:           "user-1",
+		},
+	})
+}
+
+// statusCode 返回错误中 Dify 的状态码和错误码
+func statusCode(err error) (int, string) {
+	var apiErr *dify.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode, apiErr.Code
+	}
+	return 0, ""
+}
+
+func TestReplies(t *testing.T) {
+	s, client := newServer(t)
+	s.Respond(func(req dify.ChatMessageReq) Reply {
+		return Reply{Answer: strings.ToUpper(req.Query)}
+	})
+	s.Enqueue(Reply{Answer: "first"})
+
+	var answers []string
+	for _, query := range []string{"a", "b"} {
+		resp, err := send(client, "app-test", "", query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		answers = append(answers, resp.Answer)
+	}
+	// Enqueue 的回答优先，用完后由 Respond 生成
+	if strings.Join(answers, ",") != "first,B" {
+		t.Errorf("answers = %v", answers)
+	}
+
+	s2, client2 := newServer(t)
+	resp, err := send(client2, "app-test", "", "hi")
+	if err != nil || resp.Answer != "echo: hi" || len(s2.Conversations("user-1")) != 1 {
+		t.Errorf("default reply = %+v, %v", resp, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s, client := newServer(t)
+	s.RequireApiKeys("app-good")
+	s.Fail(http.MethodPost, "/chat-messages",
+		Error{Status: http.StatusBadRequest, Code: "invalid_param"},
+		Error{Status: http.StatusForbidden, Code: "app_unavailable"},
+	)
+
+	tests := []struct {
+		name           string
+		apiKey         string
+		conversationId string
+		status         int
+		code           string
+	}{
+		{name: "unknown api key", apiKey: "app-bad", status: http.StatusUnauthorized, code: "unauthorized"},
+		{name: "first failure", apiKey: "app-good", status: http.StatusBadRequest, code: "invalid_param"},
+		{name: "second failure", apiKey: "app-good", status: http.StatusForbidden, code: "app_unavailable"},
+		{name: "unknown conversation", apiKey: "app-good", conversationId: "missing", status: http.StatusNotFound, code: "not_found"},
+		{name: "recovered", apiKey: "app-good"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := send(client, tt.apiKey, tt.conversationId, "hi")
+			if status, code := statusCode(err); status != tt.status || code != tt.code {
+				t.Errorf("error = %v, want %d %s", err, tt.status, tt.code)
+			}
+		})
+	}
+	if got := len(s.RequestsTo(http.MethodPost, "/chat-messages")); got != len(tests) {
+		t.Errorf("recorded requests = %d, want %d", got, len(tests))
+	}
+}
+
+func TestDropAfter(t *testing.T) {
+	s, client := newServer(t)
+	s.Enqueue(Reply{Chunks: []string{"a", "b", "c"}, DropAfter: 2})
+
+	var events []string
+	_, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		ApiKey: "app-test",
+		OnEvent: func(ev dify.ChatMessageRespSSEData) {
+			events = append(events, ev.Event+":"+ev.Answer)
+		},
+		RequestBody: dify.ChatMessageReq{Query: "hi", ResponseMode: dify.ResponseModeStreaming, User: "user-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(events, ",") != "message:a,message:b" {
+		t.Errorf("events = %v, want the stream to end without message_end", events)
+	}
+	// 连接中断不影响服务端保存完整回答
+	conversations := s.Conversations("user-1")
+	if messages := s.Messages(conversations[0].Id); len(messages) != 1 || messages[0].Answer != "abc" {
+		t.Errorf("messages = %+v", messages)
+	}
+}
+
+func TestConversationsSortAndIsolation(t *testing.T) {
+	s, client := newServer(t)
+	clock := time.Unix(1700000000, 0)
+	s.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	first, _ := send(client, "app-test", "", "first")
+	second, _ := send(client, "app-test", "", "second")
+	// 继续第一个会话后，它的更新时间最新
+	if _, err := send(client, "app-test", first.ConversationId, "again"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sortBy string
+		want   string
+	}{
+		{sortBy: "", want: first.ConversationId + "," + second.ConversationId},
+		{sortBy: "updated_at", want: second.ConversationId + "," + first.ConversationId},
+		{sortBy: "created_at", want: first.ConversationId + "," + second.ConversationId},
+		{sortBy: "-created_at", want: second.ConversationId + "," + first.ConversationId},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sortBy, func(t *testing.T) {
+			resp, err := client.GetConversations(context.Background(), dify.GetConversationsOption{
+				ApiKey:        "app-test",
+				RequestParams: dify.GetConversationsReq{User: "user-1", SortBy: tt.sortBy},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, conversation := range resp.Data {
+				ids = append(ids, conversation.Id)
+			}
+			if strings.Join(ids, ",") != tt.want {
+				t.Errorf("conversations = %v, want %s", ids, tt.want)
+			}
+		})
+	}
+
+	// 其他用户看不到也不能继续该会话
+	_, err := client.GetMessages(context.Background(), dify.GetMessagesOption{
+		ApiKey:        "app-test",
+		RequestParams: dify.GetMessagesReq{ConversationId: first.ConversationId, User: "user-2"},
+	})
+	if status, _ := statusCode(err); status != http.StatusNotFound {
+		t.Errorf("GetMessages() by another user error = %v, want 404", err)
+	}
+	if len(s.Conversations("user-2")) != 0 {
+		t.Error("user-2 has conversations")
+	}
+}
+
+func TestUnsupportedPath(t *testing.T) {
+	s, _ := newServer(t)
+	request, _ := http.NewRequest(http.MethodGet, s.URL+"/workflows/run", nil)
+	request.Header.Set("Authorization", "Bearer app-test")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", response.StatusCode)
+	}
+	s.AssertRequested(t, http.MethodGet, "/workflows/run")
+}
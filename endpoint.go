@@ -0,0 +1,278 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint 一个 Dify 服务地址
+type Endpoint struct {
+	Url    string // 服务地址，与 ApiBaseUrl 格式相同，如 https://dify-a.example.com/v1
+	Weight int    // 加权选择时的权重，默认 1
+}
+
+// EndpointSelection 服务地址的选择策略
+type EndpointSelection int
+
+const (
+	EndpointSelectionWeighted EndpointSelection = iota // 按权重随机选择
+	EndpointSelectionLatency                           // 选择平均延迟最低的地址，还没有延迟数据的地址排在已测得延迟的地址之后
+)
+
+// EndpointsConfig 多服务地址配置，设置后替代 ApiBaseUrl
+//
+// 非流式请求遇到网络错误、5xx 或熔断时自动切换到下一个地址；
+// 携带 ConversationId 的请求固定发往创建该会话的地址。
+type EndpointsConfig struct {
+	Endpoints           []Endpoint
+	Selection           EndpointSelection
+	HealthCheckPath     string        // 健康检查请求的路径，默认 /info
+	HealthCheckApiKey   string        // 可选，健康检查使用的密钥；未设置时 401 也视为服务可用
+	HealthCheckInterval time.Duration // 健康检查间隔，默认 30 秒
+	HealthCheckTimeout  time.Duration // 单次健康检查超时，默认 5 秒
+	MaxConversations    int           // 最多记录多少个会话与地址的绑定关系，默认 100000
+}
+
+var ErrNoEndpoint = errors.New("no endpoint available")
+
+type endpointPool struct {
+	config     EndpointsConfig
+	httpClient *http.Client
+	endpoints  []*endpointState
+
+	mu            sync.Mutex
+	conversations map[string]*endpointState
+}
+
+type endpointState struct {
+	Endpoint
+
+	mu        sync.Mutex
+	unhealthy bool
+	latency   time.Duration // 请求延迟的指数加权平均
+	checkedAt time.Time
+	checking  bool
+}
+
+func newEndpointPool(config *EndpointsConfig, httpClient *http.Client) *endpointPool {
+	if config == nil || len(config.Endpoints) == 0 {
+		return nil
+	}
+	pool := &endpointPool{
+		config:        *config,
+		httpClient:    httpClient,
+		conversations: make(map[string]*endpointState),
+	}
+	if pool.config.HealthCheckPath == "" {
+		pool.config.HealthCheckPath = "/info"
+	}
+	if pool.config.HealthCheckInterval <= 0 {
+		pool.config.HealthCheckInterval = 30 * time.Second
+	}
+	if pool.config.HealthCheckTimeout <= 0 {
+		pool.config.HealthCheckTimeout = 5 * time.Second
+	}
+	if pool.config.MaxConversations <= 0 {
+		pool.config.MaxConversations = 100000
+	}
+	now := time.Now()
+	for _, endpoint := range config.Endpoints {
+		if endpoint.Weight <= 0 {
+			endpoint.Weight = 1
+		}
+		pool.endpoints = append(pool.endpoints, &endpointState{Endpoint: endpoint, checkedAt: now})
+	}
+	return pool
+}
+
+// pick 选择本次请求的地址，tried 为已经尝试过的地址，没有可用地址时返回空字符串
+//
+// 未配置多地址时只返回一次 defaultUrl；pinned 表示该地址由会话绑定，不能切换。
+func (p *endpointPool) pick(defaultUrl string, conversationId string, tried map[string]bool) (baseUrl string, pinned bool) {
+	if p == nil {
+		if tried[defaultUrl] {
+			return "", false
+		}
+		return defaultUrl, false
+	}
+
+	if conversationId != "" {
+		p.mu.Lock()
+		endpoint, ok := p.conversations[conversationId]
+		p.mu.Unlock()
+		if ok {
+			if tried[endpoint.Url] {
+				return "", true
+			}
+			return endpoint.Url, true
+		}
+	}
+
+	p.checkStale()
+
+	var healthy, untried []*endpointState
+	for _, endpoint := range p.endpoints {
+		if tried[endpoint.Url] {
+			continue
+		}
+		untried = append(untried, endpoint)
+		if endpoint.isHealthy() {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	candidates := healthy
+	if len(candidates) == 0 {
+		// 全部不健康时仍然尝试，健康状态可能已经过期
+		candidates = untried
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	switch p.config.Selection {
+	case EndpointSelectionLatency:
+		best, bestLatency := candidates[0], candidates[0].averageLatency()
+		for _, endpoint := range candidates[1:] {
+			// 延迟为 0 表示还没有成功的请求或健康检查，不能当作最快
+			latency := endpoint.averageLatency()
+			if latency > 0 && (bestLatency == 0 || latency < bestLatency) {
+				best, bestLatency = endpoint, latency
+			}
+		}
+		return best.Url, false
+	default:
+		total := 0
+		for _, endpoint := range candidates {
+			total += endpoint.Weight
+		}
+		n := rand.IntN(total)
+		for _, endpoint := range candidates {
+			n -= endpoint.Weight
+			if n < 0 {
+				return endpoint.Url, false
+			}
+		}
+		return candidates[len(candidates)-1].Url, false
+	}
+}
+
+// record 记录一次请求的结果，用于被动健康检查和延迟统计
+func (p *endpointPool) record(baseUrl string, latency time.Duration, failed bool) {
+	endpoint := p.find(baseUrl)
+	if endpoint == nil {
+		return
+	}
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+
+	endpoint.unhealthy = failed
+	if failed {
+		return
+	}
+	if endpoint.latency == 0 {
+		endpoint.latency = latency
+	} else {
+		endpoint.latency = (endpoint.latency*4 + latency) / 5
+	}
+}
+
+// pin 将会话绑定到响应所在的地址
+func (p *endpointPool) pin(conversationId string, response *http.Response) {
+	if p == nil || conversationId == "" || response == nil || response.Request == nil {
+		return
+	}
+	endpoint := p.find(response.Request.URL.String())
+	if endpoint == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.conversations[conversationId]; !ok && len(p.conversations) >= p.config.MaxConversations {
+		// 超出上限时随机淘汰一个，被淘汰的会话在 404 时会重新查找所在地址
+		for key := range p.conversations {
+			delete(p.conversations, key)
+			break
+		}
+	}
+	p.conversations[conversationId] = endpoint
+}
+
+// find 返回 url 所属的地址
+//
+// url 需要与地址完全相同或以地址加 / 或 ? 开头，避免 http://h:80 匹配到 http://h:8080；
+// 多个地址都匹配时使用最长的那个。
+func (p *endpointPool) find(url string) *endpointState {
+	if p == nil {
+		return nil
+	}
+	var found *endpointState
+	for _, endpoint := range p.endpoints {
+		base := strings.TrimSuffix(endpoint.Url, "/")
+		matched := url == base || strings.HasPrefix(url, base+"/") || strings.HasPrefix(url, base+"?")
+		if matched && (found == nil || len(base) > len(strings.TrimSuffix(found.Url, "/"))) {
+			found = endpoint
+		}
+	}
+	return found
+}
+
+// checkStale 对超过检查间隔的地址在后台发起健康检查
+func (p *endpointPool) checkStale() {
+	now := time.Now()
+	for _, endpoint := range p.endpoints {
+		endpoint.mu.Lock()
+		stale := !endpoint.checking && now.Sub(endpoint.checkedAt) >= p.config.HealthCheckInterval
+		if stale {
+			endpoint.checking = true
+		}
+		endpoint.mu.Unlock()
+		if stale {
+			go p.check(endpoint)
+		}
+	}
+}
+
+func (p *endpointPool) check(endpoint *endpointState) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.HealthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	failed := true
+	request, newRequestErr := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.Url+p.config.HealthCheckPath, nil)
+	if newRequestErr == nil {
+		if p.config.HealthCheckApiKey != "" {
+			request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", p.config.HealthCheckApiKey))
+		}
+		response, doErr := p.httpClient.Do(request)
+		if doErr == nil {
+			_ = response.Body.Close()
+			failed = response.StatusCode >= http.StatusInternalServerError ||
+				(p.config.HealthCheckApiKey != "" && response.StatusCode >= http.StatusBadRequest)
+		}
+	}
+
+	endpoint.mu.Lock()
+	endpoint.checking = false
+	endpoint.checkedAt = time.Now()
+	endpoint.mu.Unlock()
+	p.record(endpoint.Url, time.Since(start), failed)
+}
+
+func (e *endpointState) isHealthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !e.unhealthy
+}
+
+func (e *endpointState) averageLatency() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.latency
+}
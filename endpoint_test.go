@@ -0,0 +1,165 @@
+package dify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEndpointPoolFind(t *testing.T) {
+	pool := newEndpointPool(&EndpointsConfig{Endpoints: []Endpoint{
+		{Url: "http://h:80"},
+		{Url: "http://h:8080"},
+		{Url: "http://h:8080/v1/"},
+	}}, http.DefaultClient)
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "http://h:80", want: "http://h:80"},
+		{url: "http://h:80/chat-messages", want: "http://h:80"},
+		{url: "http://h:8080/chat-messages", want: "http://h:8080"},
+		{url: "http://h:8080/v1/chat-messages?user=u", want: "http://h:8080/v1/"},
+		{url: "http://h:8080/v10/chat-messages", want: "http://h:8080"},
+		{url: "http://h:8", want: ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if endpoint := pool.find(tt.url); endpoint != nil {
+			got = endpoint.Url
+		}
+		if got != tt.want {
+			t.Errorf("find(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestEndpointPoolPin(t *testing.T) {
+	pool := newEndpointPool(&EndpointsConfig{
+		Endpoints: []Endpoint{{Url: "http://h:80"}, {Url: "http://h:8080"}},
+		Selection: EndpointSelectionLatency,
+	}, http.DefaultClient)
+
+	// 端口是另一个地址前缀的会话也要绑定到正确的地址
+	pool.pin("conv-1", &http.Response{Request: httptest.NewRequest(http.MethodPost, "http://h:8080/chat-messages", nil)})
+	baseUrl, pinned := pool.pick("", "conv-1", map[string]bool{})
+	if baseUrl != "http://h:8080" || !pinned {
+		t.Fatalf("pick() = %q, %v, want http://h:8080 pinned", baseUrl, pinned)
+	}
+	if baseUrl, _ := pool.pick("", "conv-1", map[string]bool{"http://h:8080": true}); baseUrl != "" {
+		t.Errorf("pick() after the pinned endpoint failed = %q, want none", baseUrl)
+	}
+	if baseUrl, pinned := pool.pick("", "conv-2", map[string]bool{}); baseUrl != "http://h:80" || pinned {
+		t.Errorf("pick() for an unknown conversation = %q, %v, want http://h:80", baseUrl, pinned)
+	}
+}
+
+// newChatEndpoint 返回一个回答对话消息的服务，会话 ID 为 conv-<name>，前 failures 次请求返回 502
+func TestEndpointPoolLatencySelection(t *testing.T) {
+	pool := newEndpointPool(&EndpointsConfig{
+		Endpoints: []Endpoint{{Url: "http://new"}, {Url: "http://slow"}, {Url: "http://fast"}},
+		Selection: EndpointSelectionLatency,
+	}, http.DefaultClient)
+	pool.record("http://slow", 50*time.Millisecond, false)
+	pool.record("http://fast", 10*time.Millisecond, false)
+
+	// 没有延迟数据的地址排在已测得延迟的地址之后
+	tests := []struct {
+		tried map[string]bool
+		want  string
+	}{
+		{tried: map[string]bool{}, want: "http://fast"},
+		{tried: map[string]bool{"http://fast": true}, want: "http://slow"},
+		{tried: map[string]bool{"http://fast": true, "http://slow": true}, want: "http://new"},
+	}
+	for _, tt := range tests {
+		if baseUrl, _ := pool.pick("", "", tt.tried); baseUrl != tt.want {
+			t.Errorf("pick(tried %v) = %q, want %q", tt.tried, baseUrl, tt.want)
+		}
+	}
+}
+
+func newChatEndpoint(t *testing.T, name string, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"event":"message","conversation_id":"conv-%s","answer":"%s"}`, name, name)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestClientEndpointFailoverAndPinning(t *testing.T) {
+	a, aRequests := newChatEndpoint(t, "a", 1)
+	b, bRequests := newChatEndpoint(t, "b", 0)
+	client := NewClient("", WithEndpoints(EndpointsConfig{
+		Endpoints: []Endpoint{{Url: a.URL}, {Url: b.URL}},
+		Selection: EndpointSelectionLatency,
+	})).(*Client)
+	chat := func(conversationId string) string {
+		t.Helper()
+		resp, err := client.ChatMessage(context.Background(), ChatMessageOption{
+			ApiKey: "app-test",
+			RequestBody: ChatMessageReq{
+				Query:          "hi",
+				ResponseMode:   ResponseModeBlocking,
+				ConversationId: conversationId,
+				User:           "user-1",
+			},
+		})
+		if err != nil {
+			t.Fatalf("ChatMessage() error = %v", err)
+		}
+		return resp.Answer
+	}
+
+	// 第一个地址返回 502 时切换到下一个地址
+	if answer := chat(""); answer != "b" {
+		t.Fatalf("answer = %q, want b after failover", answer)
+	}
+
+	// 第一个地址恢复且延迟更低，但会话仍然发往创建它的地址
+	client.endpoints.record(a.URL, time.Nanosecond, false)
+	if answer := chat("conv-b"); answer != "b" {
+		t.Errorf("answer for conv-b = %q, want b", answer)
+	}
+	if answer := chat(""); answer != "a" {
+		t.Errorf("answer for a new conversation = %q, want a", answer)
+	}
+
+	if got := fmt.Sprintf("%d,%d", aRequests.Load(), bRequests.Load()); got != "2,2" {
+		t.Errorf("requests = %s, want 2,2", got)
+	}
+}
+
+func TestClientEndpointStreamingDoesNotFailover(t *testing.T) {
+	a, _ := newChatEndpoint(t, "a", 1)
+	b, bRequests := newChatEndpoint(t, "b", 0)
+	client := NewClient("", WithEndpoints(EndpointsConfig{
+		Endpoints: []Endpoint{{Url: a.URL}, {Url: b.URL}},
+		Selection: EndpointSelectionLatency,
+	}))
+
+	// 流式请求可能已经产生了部分输出，不自动重试
+	_, err := client.ChatMessage(context.Background(), ChatMessageOption{
+		ApiKey:      "app-test",
+		OnEvent:     func(ChatMessageRespSSEData) {},
+		RequestBody: ChatMessageReq{Query: "hi", ResponseMode: ResponseModeStreaming, User: "user-1"},
+	})
+	if err == nil {
+		t.Fatal("ChatMessage() error = nil, want the 502 from the first endpoint")
+	}
+	if n := bRequests.Load(); n != 0 {
+		t.Errorf("requests to the second endpoint = %d, want 0", n)
+	}
+}
@@ -0,0 +1,56 @@
+package dify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// APIError Dify 接口返回的错误响应
+type APIError struct {
+	StatusCode int    `json:"-"`       // HTTP 状态码
+	Code       string `json:"code"`    // 错误码，如 invalid_param、provider_quota_exceeded
+	Message    string `json:"message"` // 错误信息
+	Status     int    `json:"status"`  // 响应体中的状态码
+	Body       string `json:"-"`       // 原始响应体
+}
+
+func (e *APIError) Error() string {
+	if e.Body != "" {
+		return e.Body
+	}
+	return fmt.Sprintf("dify api error: status=%d code=%s message=%s", e.StatusCode, e.Code, e.Message)
+}
+
+// newAPIError 根据状态码和响应体构造 APIError，响应体不是 JSON 时仅保留原文
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{}
+	_ = json.Unmarshal(body, apiErr)
+	apiErr.StatusCode = statusCode
+	apiErr.Body = string(body)
+	return apiErr
+}
+
+// peekAPIError 读取错误响应体构造 APIError，并把响应体还原以便后续继续读取
+func peekAPIError(response *http.Response) *APIError {
+	all, _ := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(all))
+	return newAPIError(response.StatusCode, all)
+}
+
+// isThrottleError 判断错误是否为限流或额度不足
+func isThrottleError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return strings.Contains(apiErr.Code, "quota")
+}
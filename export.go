@@ -0,0 +1,211 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ExportFormat 导出格式
+type ExportFormat int
+
+const (
+	ExportFormatJSONL    ExportFormat = iota // 每行一条消息，便于程序处理
+	ExportFormatMarkdown                     // 按会话排版的对话记录，便于人工阅读
+)
+
+// ExportApp 需要导出的应用，Dify 的密钥按应用划分，每个应用需要单独的密钥
+type ExportApp struct {
+	Name   string
+	ApiKey string
+}
+
+// ExportOption Export 的参数
+type ExportOption struct {
+	Apps   []ExportApp `validate:"required,min=1"`
+	User   string      `validate:"required"`
+	Format ExportFormat
+	Since  time.Time // 可选，只导出此时间及之后的消息
+	Until  time.Time // 可选，只导出此时间之前的消息
+}
+
+// ExportRecord JSONL 格式中的一行
+type ExportRecord struct {
+	App              string  `json:"app"`
+	User             string  `json:"user"`
+	ConversationId   string  `json:"conversation_id"`
+	ConversationName string  `json:"conversation_name"`
+	Message          Message `json:"message"`
+}
+
+// ExportSummary 导出结果
+type ExportSummary struct {
+	Conversations int
+	Messages      int
+}
+
+// Export 导出用户在各应用中的全部会话和消息，包括消息文件、反馈和引用资源
+//
+// 会话按最近更新时间倒序，会话内的消息按时间正序写入 w。
+func Export(ctx context.Context, client ClientI, w io.Writer, option ExportOption) (summary ExportSummary, err error) {
+	// 校验参数
+	validate := validator.New()
+	validateErr := validate.Struct(option)
+	if validateErr != nil {
+		err = errors.New(fmt.Sprintf("validateErr: %s", validateErr.Error()))
+		return
+	}
+
+	for _, app := range option.Apps {
+		for conversation, conversationErr := range AllConversations(ctx, client, AllConversationsOption{
+			ApiKey:   app.ApiKey,
+			User:     option.User,
+			SortBy:   "-updated_at",
+			PageSize: 100,
+		}) {
+			if conversationErr != nil {
+				err = fmt.Errorf("getConversationsErr: %w", conversationErr)
+				return
+			}
+			// 会话按更新时间倒序，更早的会话不会有范围内的消息
+			if !option.Since.IsZero() && time.Unix(int64(conversation.UpdatedAt), 0).Before(option.Since) {
+				break
+			}
+
+			messages, messagesErr := exportMessages(ctx, client, app, option, conversation.Id)
+			if messagesErr != nil {
+				err = fmt.Errorf("getMessagesErr: %w", messagesErr)
+				return
+			}
+			if len(messages) == 0 {
+				continue
+			}
+
+			writeErr := writeExport(w, option, app, conversation, messages)
+			if writeErr != nil {
+				err = fmt.Errorf("writeErr: %w", writeErr)
+				return
+			}
+			summary.Conversations++
+			summary.Messages += len(messages)
+		}
+	}
+	return
+}
+
+// exportMessages 返回会话在时间范围内的消息，按时间正序
+func exportMessages(ctx context.Context, client MessageHistory, app ExportApp, option ExportOption, conversationId string) ([]Message, error) {
+	var messages []Message
+	for message, err := range AllMessages(ctx, client, AllMessagesOption{
+		ApiKey:         app.ApiKey,
+		ConversationId: conversationId,
+		User:           option.User,
+		PageSize:       100,
+	}) {
+		if err != nil {
+			return nil, err
+		}
+		createdAt := time.Unix(int64(message.CreatedAt), 0)
+		if !option.Since.IsZero() && createdAt.Before(option.Since) {
+			break
+		}
+		if !option.Until.IsZero() && !createdAt.Before(option.Until) {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+func writeExport(w io.Writer, option ExportOption, app ExportApp, conversation Conversation, messages []Message) error {
+	if option.Format == ExportFormatMarkdown {
+		_, err := io.WriteString(w, markdownTranscript(app, conversation, messages))
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, message := range messages {
+		err := encoder.Encode(ExportRecord{
+			App:              app.Name,
+			User:             option.User,
+			ConversationId:   conversation.Id,
+			ConversationName: conversation.Name,
+			Message:          message,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownTranscript 将一个会话排版为 Markdown
+func markdownTranscript(app ExportApp, conversation Conversation, messages []Message) string {
+	const layout = "2006-01-02 15:04:05"
+	var b strings.Builder
+
+	name := conversation.Name
+	if name == "" {
+		name = conversation.Id
+	}
+	fmt.Fprintf(&b, "# %s\n\n", name)
+	fmt.Fprintf(&b, "- 应用：%s\n", app.Name)
+	fmt.Fprintf(&b, "- 会话 ID：%s\n", conversation.Id)
+	fmt.Fprintf(&b, "- 创建时间：%s\n\n", time.Unix(int64(conversation.CreatedAt), 0).Format(layout))
+
+	for _, message := range messages {
+		fmt.Fprintf(&b, "## %s\n\n", time.Unix(int64(message.CreatedAt), 0).Format(layout))
+		fmt.Fprintf(&b, "**用户**：%s\n\n", message.Query)
+		writeMarkdownFiles(&b, message.MessageFiles, false)
+		fmt.Fprintf(&b, "**助手**：%s\n\n", message.Answer)
+		writeMarkdownFiles(&b, message.MessageFiles, true)
+
+		var notes []string
+		if message.Feedback != nil && message.Feedback.Rating != "" {
+			note := "反馈：" + message.Feedback.Rating
+			if message.Feedback.Content != "" {
+				note += "（" + message.Feedback.Content + "）"
+			}
+			notes = append(notes, note)
+		}
+		for _, resource := range message.RetrieverResources {
+			notes = append(notes, fmt.Sprintf("引用：%s / %s", resource.DatasetName, resource.DocumentName))
+		}
+		for _, note := range notes {
+			fmt.Fprintf(&b, "> - %s\n", note)
+		}
+		if len(notes) > 0 {
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("---\n\n")
+	return b.String()
+}
+
+// writeMarkdownFiles 写入用户或助手的消息文件
+func writeMarkdownFiles(b *strings.Builder, files []MessageFile, assistant bool) {
+	written := false
+	for _, file := range files {
+		if (file.BelongsTo == "assistant") != assistant {
+			continue
+		}
+		name := file.Filename
+		if name == "" {
+			name = file.Type
+		}
+		fmt.Fprintf(b, "- 附件：[%s](%s)\n", name, file.Url)
+		written = true
+	}
+	if written {
+		b.WriteString("\n")
+	}
+}
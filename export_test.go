@@ -0,0 +1,155 @@
+package dify_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+// exportMessagesJSON /messages 的返回，包含 Dify 返回的完整消息文件和反馈字段
+const exportMessagesJSON = `{"limit":100,"has_more":false,"data":[
+	{"id":"m1","conversation_id":"c1","query":"看看这张图","answer":"是一只猫","created_at":1700000000,
+	 "message_files":[{"id":"f1","filename":"cat.png","type":"image","url":"https://files/cat.png","mime_type":"image/png","size":2048,"transfer_method":"local_file","belongs_to":"user","upload_file_id":"u1"}],
+	 "feedback":{"rating":"like","content":"准确"},"retriever_resources":[]},
+	{"id":"m2","conversation_id":"c1","query":"再画一只","answer":"好的","created_at":1700000600,
+	 "message_files":[{"id":"f2","filename":"","type":"image","url":"https://files/gen.png","mime_type":"image/png","size":4096,"transfer_method":"tool_file","belongs_to":"assistant","upload_file_id":""}],
+	 "feedback":null,"retriever_resources":[{"dataset_name":"宠物","document_name":"猫.md"}]}
+]}`
+
+func newExportServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/conversations":
+			_, _ = fmt.Fprint(w, `{"limit":100,"has_more":false,"data":[{"id":"c1","name":"猫","status":"normal","created_at":1700000000,"updated_at":1700000600}]}`)
+		case "/messages":
+			_, _ = fmt.Fprint(w, exportMessagesJSON)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestExportJSONL(t *testing.T) {
+	server := newExportServer(t)
+	var out bytes.Buffer
+	summary, err := dify.Export(context.Background(), dify.NewClient(server.URL), &out, dify.ExportOption{
+		Apps: []dify.ExportApp{{Name: "pets", ApiKey: "app-test"}},
+		User: "user-1",
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if summary.Conversations != 1 || summary.Messages != 2 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	var records []map[string]json.RawMessage
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 || string(records[0]["app"]) != `"pets"` || string(records[0]["conversation_name"]) != `"猫"` {
+		t.Fatalf("records = %v", records)
+	}
+
+	// 消息文件和反馈保留 Dify 返回的全部字段
+	var message struct {
+		MessageFiles []map[string]any `json:"message_files"`
+		Feedback     map[string]any   `json:"feedback"`
+	}
+	if err := json.Unmarshal(records[0]["message"], &message); err != nil {
+		t.Fatal(err)
+	}
+	file := message.MessageFiles[0]
+	want := map[string]any{
+		"id": "f1", "filename": "cat.png", "type": "image", "url": "https://files/cat.png", "mime_type": "image/png",
+		"size": float64(2048), "transfer_method": "local_file", "belongs_to": "user", "upload_file_id": "u1",
+	}
+	for key, value := range want {
+		if file[key] != value {
+			t.Errorf("message_files[0].%s = %v, want %v", key, file[key], value)
+		}
+	}
+	if message.Feedback["rating"] != "like" || message.Feedback["content"] != "准确" {
+		t.Errorf("feedback = %v", message.Feedback)
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	server := newExportServer(t)
+	var out bytes.Buffer
+	_, err := dify.Export(context.Background(), dify.NewClient(server.URL), &out, dify.ExportOption{
+		Apps:   []dify.ExportApp{{Name: "pets", ApiKey: "app-test"}},
+		User:   "user-1",
+		Format: dify.ExportFormatMarkdown,
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	for _, want := range []string{
+		"# 猫",
+		"- 应用：pets",
+		"**用户**：看看这张图\n\n- 附件：[cat.png](https://files/cat.png)",
+		"**助手**：好的\n\n- 附件：[image](https://files/gen.png)",
+		"> - 反馈：like（准确）",
+		"> - 引用：宠物 / 猫.md",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("markdown missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Index(out.String(), "看看这张图") > strings.Index(out.String(), "再画一只") {
+		t.Error("messages are not in chronological order")
+	}
+}
+
+func TestExportTimeRange(t *testing.T) {
+	server := newExportServer(t)
+	tests := []struct {
+		name  string
+		since time.Time
+		until time.Time
+		want  int
+	}{
+		{name: "since", since: time.Unix(1700000300, 0), want: 1},
+		{name: "until", until: time.Unix(1700000300, 0), want: 1},
+		{name: "after everything", since: time.Unix(1800000000, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := dify.Export(context.Background(), dify.NewClient(server.URL), &bytes.Buffer{}, dify.ExportOption{
+				Apps:  []dify.ExportApp{{Name: "pets", ApiKey: "app-test"}},
+				User:  "user-1",
+				Since: tt.since,
+				Until: tt.until,
+			})
+			if err != nil || summary.Messages != tt.want {
+				t.Errorf("Export() = %+v, %v, want %d messages", summary, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportValidation(t *testing.T) {
+	_, err := dify.Export(context.Background(), dify.NewClient("http://127.0.0.1:0"), &bytes.Buffer{}, dify.ExportOption{User: "user-1"})
+	if err == nil || !strings.HasPrefix(err.Error(), "validateErr") {
+		t.Errorf("Export() error = %v, want validateErr", err)
+	}
+}
@@ -0,0 +1,160 @@
+package dify
+
+import (
+	"context"
+	"iter"
+	"slices"
+)
+
+// AllMessagesOption AllMessages 的参数
+type AllMessagesOption struct {
+	ApiKey         string
+	ConversationId string
+	User           string
+	FirstId        string // 可选，从这条消息之前开始，为空时从最新的消息开始
+	PageSize       int    // 每页条数，默认 20
+	MaxItems       int    // 最多返回多少条，0 表示不限
+}
+
+// AllMessages 按时间倒序遍历会话的全部历史消息，自动通过 first_id 向前翻页
+//
+// 返回当前页的同时预取下一页；遍历中途 break 或 ctx 被取消时停止翻页，
+// 出错时产生一次错误后结束。
+//
+//	for message, err := range dify.AllMessages(ctx, client, dify.AllMessagesOption{...}) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(message.Query, message.Answer)
+//	}
+func AllMessages(ctx context.Context, client MessageHistory, option AllMessagesOption) iter.Seq2[Message, error] {
+	return paginate(ctx, option.FirstId, option.PageSize, option.MaxItems, func(ctx context.Context, cursor string, limit int) (page[Message], error) {
+		resp, err := client.GetMessages(ctx, GetMessagesOption{
+			ApiKey: option.ApiKey,
+			RequestParams: GetMessagesReq{
+				ConversationId: option.ConversationId,
+				User:           option.User,
+				FirstId:        cursor,
+				Limit:          limit,
+			},
+		})
+		if err != nil {
+			return page[Message]{}, err
+		}
+		// 每页内按时间正序返回，第一条是下一页的 first_id
+		items := slices.Clone(resp.Data)
+		slices.Reverse(items)
+		next := ""
+		if len(resp.Data) > 0 {
+			next = resp.Data[0].Id
+		}
+		return page[Message]{items: items, next: next, hasMore: resp.HasMore}, nil
+	})
+}
+
+// AllConversationsOption AllConversations 的参数
+type AllConversationsOption struct {
+	ApiKey   string
+	User     string
+	LastId   string // 可选，从这个会话之后开始
+	SortBy   string // 排序字段，见 GetConversationsReq.SortBy
+	PageSize int    // 每页条数，默认 20
+	MaxItems int    // 最多返回多少个，0 表示不限
+}
+
+// AllConversations 遍历用户的全部会话，自动通过 last_id 向后翻页，行为与 AllMessages 相同
+func AllConversations(ctx context.Context, client ConversationManager, option AllConversationsOption) iter.Seq2[Conversation, error] {
+	return paginate(ctx, option.LastId, option.PageSize, option.MaxItems, func(ctx context.Context, cursor string, limit int) (page[Conversation], error) {
+		resp, err := client.GetConversations(ctx, GetConversationsOption{
+			ApiKey: option.ApiKey,
+			RequestParams: GetConversationsReq{
+				User:   option.User,
+				LastId: cursor,
+				Limit:  limit,
+				SortBy: option.SortBy,
+			},
+		})
+		if err != nil {
+			return page[Conversation]{}, err
+		}
+		next := ""
+		if len(resp.Data) > 0 {
+			next = resp.Data[len(resp.Data)-1].Id
+		}
+		return page[Conversation]{items: resp.Data, next: next, hasMore: resp.HasMore}, nil
+	})
+}
+
+// page 一页结果，next 为下一页的游标
+type page[T any] struct {
+	items   []T
+	next    string
+	hasMore bool
+}
+
+// paginate 按游标依次取页，处理当前页时预取下一页
+func paginate[T any](ctx context.Context, cursor string, pageSize int, maxItems int, fetch func(ctx context.Context, cursor string, limit int) (page[T], error)) iter.Seq2[T, error] {
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+
+	type result struct {
+		page page[T]
+		err  error
+	}
+
+	return func(yield func(T, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		fetchAsync := func(cursor string, remaining int) <-chan result {
+			limit := pageSize
+			if maxItems > 0 {
+				limit = min(limit, remaining)
+			}
+			ch := make(chan result, 1)
+			go func() {
+				p, err := fetch(ctx, cursor, limit)
+				ch <- result{page: p, err: err}
+			}()
+			return ch
+		}
+
+		var zero T
+		count := 0
+		pending := fetchAsync(cursor, maxItems)
+		for pending != nil {
+			var r result
+			select {
+			case r = <-pending:
+			case <-ctx.Done():
+				yield(zero, ctx.Err())
+				return
+			}
+			if r.err != nil {
+				yield(zero, r.err)
+				return
+			}
+
+			pending = nil
+			fetched := count + len(r.page.items)
+			if r.page.hasMore && r.page.next != "" && len(r.page.items) > 0 && (maxItems <= 0 || fetched < maxItems) {
+				pending = fetchAsync(r.page.next, maxItems-fetched)
+			}
+
+			for _, item := range r.page.items {
+				if maxItems > 0 && count >= maxItems {
+					return
+				}
+				if ctx.Err() != nil {
+					yield(zero, ctx.Err())
+					return
+				}
+				if !yield(item, nil) {
+					return
+				}
+				count++
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package dify_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+// seedConversation 在一个会话中发送 n 条消息 q0..q(n-1)，返回会话 ID
+func seedConversation(t *testing.T, client dify.ClientI, n int) string {
+	t.Helper()
+	conversationId := ""
+	for i := range n {
+		conversationId = chat(t, client, conversationId, fmt.Sprintf("q%d", i)).ConversationId
+	}
+	return conversationId
+}
+
+func TestAllMessages(t *testing.T) {
+	server, client := newTestClient(t)
+	conversationId := seedConversation(t, client, 5)
+	tests := []struct {
+		name     string
+		maxItems int
+		want     string
+		requests int
+	}{
+		{name: "all pages", want: "q4,q3,q2,q1,q0", requests: 3},
+		{name: "max items", maxItems: 3, want: "q4,q3,q2", requests: 2},
+		{name: "max items on page boundary", maxItems: 2, want: "q4,q3", requests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(server.RequestsTo(http.MethodGet, "/messages"))
+			var queries []string
+			for message, err := range dify.AllMessages(context.Background(), client, dify.AllMessagesOption{
+				ApiKey:         "app-test",
+				ConversationId: conversationId,
+				User:           "user-1",
+				PageSize:       2,
+				MaxItems:       tt.maxItems,
+			}) {
+				if err != nil {
+					t.Fatalf("AllMessages() error = %v", err)
+				}
+				queries = append(queries, message.Query)
+			}
+			if got := strings.Join(queries, ","); got != tt.want {
+				t.Errorf("AllMessages() = %s, want %s", got, tt.want)
+			}
+			if requests := len(server.RequestsTo(http.MethodGet, "/messages")) - before; requests != tt.requests {
+				t.Errorf("requests = %d, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestAllMessagesStopsEarly(t *testing.T) {
+	server, client := newTestClient(t)
+	conversationId := seedConversation(t, client, 6)
+
+	for _, err := range dify.AllMessages(context.Background(), client, dify.AllMessagesOption{
+		ApiKey: "app-test", ConversationId: conversationId, User: "user-1", PageSize: 2,
+	}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	// 第一页和预取的第二页，不再继续翻页
+	if requests := len(server.RequestsTo(http.MethodGet, "/messages")); requests > 2 {
+		t.Errorf("requests = %d, want at most 2 after break", requests)
+	}
+}
+
+func TestAllMessagesErrors(t *testing.T) {
+	_, client := newTestClient(t)
+	conversationId := seedConversation(t, client, 3)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		conversationId string
+		wantErr        func(error) bool
+	}{
+		{name: "unknown conversation", ctx: context.Background(), conversationId: "missing", wantErr: func(err error) bool {
+			var apiErr *dify.APIError
+			return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+		}},
+		{name: "cancelled", ctx: cancelled, conversationId: conversationId, wantErr: func(err error) bool {
+			return errors.Is(err, context.Canceled)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []error
+			for _, err := range dify.AllMessages(tt.ctx, client, dify.AllMessagesOption{
+				ApiKey: "app-test", ConversationId: tt.conversationId, User: "user-1", PageSize: 2,
+			}) {
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}
+			if len(errs) != 1 || !tt.wantErr(errs[0]) {
+				t.Errorf("errors = %v", errs)
+			}
+		})
+	}
+}
+
+func TestAllConversations(t *testing.T) {
+	server, client := newTestClient(t)
+	for i := range 5 {
+		chat(t, client, "", fmt.Sprintf("c%d", i))
+	}
+
+	var names []string
+	for conversation, err := range dify.AllConversations(context.Background(), client, dify.AllConversationsOption{
+		ApiKey: "app-test", User: "user-1", SortBy: "created_at", PageSize: 2,
+	}) {
+		if err != nil {
+			t.Fatalf("AllConversations() error = %v", err)
+		}
+		names = append(names, conversation.Id)
+	}
+	var want []string
+	for _, conversation := range server.Conversations("user-1") {
+		want = append(want, conversation.Id)
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") || len(names) != 5 {
+		t.Errorf("AllConversations() = %v, want %v", names, want)
+	}
+	for _, request := range server.RequestsTo(http.MethodGet, "/conversations")[1:] {
+		if request.Query.Get("last_id") == "" || request.Query.Get("limit") != "2" {
+			t.Errorf("page query = %v", request.Query)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package dify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Call 一次客户端方法调用，在中间件之间传递
+type Call struct {
+	Operation Operation   // 方法名，如 OperationChatMessage
+	ApiPath   string      // 请求路径，不含查询参数，中间件可修改
+	Option    any         // 指向方法参数的指针，如 *ChatMessageOption，中间件可修改其字段
+	Header    http.Header // 附加到 HTTP 请求的请求头，会覆盖同名请求头，如 Authorization
+}
+
+// Handler 处理一次调用，返回值为方法的返回参，如 *ChatMessageResp
+type Handler func(ctx context.Context, call *Call) (resp any, err error)
+
+// Middleware 包装 Handler，可以在调用前修改参数与请求头，在调用后检查或替换返回参，
+// 也可以不调用 next 直接返回，如命中缓存
+type Middleware func(next Handler) Handler
+
+// invoke 依次经过中间件后执行 handler，并将返回参转换为方法的返回类型
+func invoke[T any](ctx context.Context, c *Client, call *Call, handler func(ctx context.Context, call *Call) (*T, error)) (resp *T, err error) {
+	var next Handler = func(ctx context.Context, call *Call) (any, error) {
+		return handler(ctx, call)
+	}
+	for i := len(c.config.Middlewares) - 1; i >= 0; i-- {
+		next = c.config.Middlewares[i](next)
+	}
+
+	if call.Header == nil {
+		call.Header = make(http.Header)
+	}
+	result, err := next(ctx, call)
+	if result == nil {
+		return
+	}
+	resp, ok := result.(*T)
+	if !ok {
+		err = fmt.Errorf("middleware returned %T for %s, want %T", result, call.Operation, resp)
+	}
+	return
+}
+
+// callOption 取出 Call 中的方法参数
+func callOption[T any](call *Call) (option *T, err error) {
+	option, ok := call.Option.(*T)
+	if !ok || option == nil {
+		err = fmt.Errorf("invalid option %T for %s, want %T", call.Option, call.Operation, option)
+	}
+	return
+}
@@ -0,0 +1,101 @@
+package dify_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	server := difytest.NewServer()
+	defer server.Close()
+
+	var calls []string
+	trace := func(name string) dify.Middleware {
+		return func(next dify.Handler) dify.Handler {
+			return func(ctx context.Context, call *dify.Call) (any, error) {
+				calls = append(calls, name+" before "+string(call.Operation))
+				resp, err := next(ctx, call)
+				calls = append(calls, name+" after")
+				return resp, err
+			}
+		}
+	}
+	client := dify.NewClient(server.URL, dify.WithMiddleware(trace("a"), trace("b")), dify.WithMiddleware(trace("c")))
+
+	chat(t, client, "", "hi")
+	want := "a before ChatMessage,b before ChatMessage,c before ChatMessage,c after,b after,a after"
+	if got := strings.Join(calls, ","); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+}
+
+func TestMiddlewareModifiesRequest(t *testing.T) {
+	server := difytest.NewServer()
+	defer server.Close()
+
+	// 按租户替换密钥并补充输入
+	tenant := func(next dify.Handler) dify.Handler {
+		return func(ctx context.Context, call *dify.Call) (any, error) {
+			call.Header.Set("Authorization", "Bearer app-tenant")
+			if option, ok := call.Option.(*dify.ChatMessageOption); ok {
+				option.RequestBody.Inputs = map[string]interface{}{"tenant": "t-1"}
+			}
+			return next(ctx, call)
+		}
+	}
+	client := dify.NewClient(server.URL, dify.WithMiddleware(tenant))
+	chat(t, client, "", "hi")
+
+	request := server.AssertRequested(t, http.MethodPost, "/chat-messages")
+	if request.ApiKey != "app-tenant" {
+		t.Errorf("ApiKey = %q, want app-tenant", request.ApiKey)
+	}
+	var body dify.ChatMessageReq
+	if err := request.JSON(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Inputs["tenant"] != "t-1" {
+		t.Errorf("Inputs = %v", body.Inputs)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  any
+		wantErr bool
+	}{
+		{name: "cached response", result: &dify.ChatMessageResp{Answer: "cached"}},
+		{name: "wrong response type", result: &dify.StopTaskResp{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := difytest.NewServer()
+			defer server.Close()
+			cache := func(next dify.Handler) dify.Handler {
+				return func(ctx context.Context, call *dify.Call) (any, error) {
+					return tt.result, nil
+				}
+			}
+			client := dify.NewClient(server.URL, dify.WithMiddleware(cache))
+
+			resp, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+				ApiKey:      "app-test",
+				RequestBody: dify.ChatMessageReq{Query: "hi", ResponseMode: dify.ResponseModeBlocking, User: "user-1"},
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ChatMessage() error = nil, want a type mismatch")
+				}
+			} else if err != nil || resp.Answer != "cached" {
+				t.Errorf("ChatMessage() = %+v, %v, want the cached response", resp, err)
+			}
+			server.AssertNotRequested(t, http.MethodPost, "/chat-messages")
+		})
+	}
+}
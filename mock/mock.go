@@ -0,0 +1,143 @@
+// Package mock 提供 dify.ClientI 的手写 mock，用于表格驱动测试
+//
+// 每个方法对应一个函数字段，未设置的方法返回 ErrNotMocked；所有调用都会被记录：
+//
+//	client := &mock.Client{
+//		ChatMessageFunc: func(ctx context.Context, option dify.ChatMessageOption) (*dify.ChatMessageResp, error) {
+//			return &dify.ChatMessageResp{Answer: "你好"}, nil
+//		},
+//	}
+//	session := dify.NewSession(client, "app-key", "user")
+//	...
+//	calls := client.CallsTo(dify.OperationChatMessage)
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+// ErrNotMocked 调用了未设置函数字段的方法
+var ErrNotMocked = errors.New("mock: method not mocked")
+
+// Call 一次方法调用
+type Call struct {
+	Method dify.Operation // 调用的方法，如 dify.OperationChatMessage
+	Option any            // 调用时传入的 Option，如 dify.ChatMessageOption
+}
+
+// Client dify.ClientI 的 mock，零值可用，可在多个 goroutine 中使用
+type Client struct {
+	ChatMessageFunc        func(ctx context.Context, option dify.ChatMessageOption) (*dify.ChatMessageResp, error)
+	UploadFileFunc         func(ctx context.Context, option dify.UploadFileOption) (*dify.UploadFileResp, error)
+	UploadFileViaGinFunc   func(ctx context.Context, option dify.UploadFileViaGinOption) (*dify.UploadFileResp, error)
+	StopTaskFunc           func(ctx context.Context, option dify.StopTaskOption) (*dify.StopTaskResp, error)
+	GetSuggestedFunc       func(ctx context.Context, option dify.GetSuggestedOption) (*dify.GetSuggestedResp, error)
+	GetMessagesFunc        func(ctx context.Context, option dify.GetMessagesOption) (*dify.GetMessagesResp, error)
+	GetConversationsFunc   func(ctx context.Context, option dify.GetConversationsOption) (*dify.GetConversationsResp, error)
+	DeleteConversationFunc func(ctx context.Context, option dify.DeleteConversationOption) (*dify.DeleteConversationResp, error)
+	ConversationRenameFunc func(ctx context.Context, option dify.ConversationRenameOption) (*dify.ConversationRenameResp, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ dify.ClientI = (*Client)(nil)
+
+// Calls 返回全部调用记录，按调用顺序
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Call(nil), c.calls...)
+}
+
+// CallsTo 返回对某个方法的调用记录
+func (c *Client) CallsTo(method dify.Operation) []Call {
+	var calls []Call
+	for _, call := range c.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset 清空调用记录，函数字段保持不变
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = nil
+}
+
+func (c *Client) record(method dify.Operation, option any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, Call{Method: method, Option: option})
+}
+
+// invoke 记录调用并执行函数字段，未设置时返回 ErrNotMocked
+func invoke[O any, R any](ctx context.Context, c *Client, method dify.Operation, fn func(context.Context, O) (*R, error), option O) (*R, error) {
+	c.record(method, option)
+	if fn == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotMocked, method)
+	}
+	return fn(ctx, option)
+}
+
+func (c *Client) ChatMessage(ctx context.Context, option dify.ChatMessageOption) (*dify.ChatMessageResp, error) {
+	return invoke(ctx, c, dify.OperationChatMessage, c.ChatMessageFunc, option)
+}
+
+func (c *Client) UploadFile(ctx context.Context, option dify.UploadFileOption) (*dify.UploadFileResp, error) {
+	return invoke(ctx, c, dify.OperationUploadFile, c.UploadFileFunc, option)
+}
+
+func (c *Client) UploadFileViaGin(ctx context.Context, option dify.UploadFileViaGinOption) (*dify.UploadFileResp, error) {
+	return invoke(ctx, c, dify.OperationUploadFileViaGin, c.UploadFileViaGinFunc, option)
+}
+
+func (c *Client) StopTask(ctx context.Context, option dify.StopTaskOption) (*dify.StopTaskResp, error) {
+	return invoke(ctx, c, dify.OperationStopTask, c.StopTaskFunc, option)
+}
+
+func (c *Client) GetSuggested(ctx context.Context, option dify.GetSuggestedOption) (*dify.GetSuggestedResp, error) {
+	return invoke(ctx, c, dify.OperationGetSuggested, c.GetSuggestedFunc, option)
+}
+
+func (c *Client) GetMessages(ctx context.Context, option dify.GetMessagesOption) (*dify.GetMessagesResp, error) {
+	return invoke(ctx, c, dify.OperationGetMessages, c.GetMessagesFunc, option)
+}
+
+func (c *Client) GetConversations(ctx context.Context, option dify.GetConversationsOption) (*dify.GetConversationsResp, error) {
+	return invoke(ctx, c, dify.OperationGetConversations, c.GetConversationsFunc, option)
+}
+
+func (c *Client) DeleteConversation(ctx context.Context, option dify.DeleteConversationOption) (*dify.DeleteConversationResp, error) {
+	return invoke(ctx, c, dify.OperationDeleteConversation, c.DeleteConversationFunc, option)
+}
+
+func (c *Client) ConversationRename(ctx context.Context, option dify.ConversationRenameOption) (*dify.ConversationRenameResp, error) {
+	return invoke(ctx, c, dify.OperationConversationRename, c.ConversationRenameFunc, option)
+}
+
+// Events 返回依次把 events 交给 OnEvent 的 ChatMessageFunc，用于模拟流式响应
+//
+// 阻塞模式下直接返回 resp；流式模式下与客户端一致，事件发送完后返回 nil。
+func Events(resp *dify.ChatMessageResp, events ...dify.ChatMessageRespSSEData) func(ctx context.Context, option dify.ChatMessageOption) (*dify.ChatMessageResp, error) {
+	return func(ctx context.Context, option dify.ChatMessageOption) (*dify.ChatMessageResp, error) {
+		if option.OnEvent == nil {
+			return resp, nil
+		}
+		for _, event := range events {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			option.OnEvent(event)
+		}
+		return nil, nil
+	}
+}
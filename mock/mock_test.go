@@ -0,0 +1,129 @@
+package mock_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/mock"
+)
+
+func TestNotMocked(t *testing.T) {
+	client := &mock.Client{}
+	ctx := context.Background()
+	tests := []struct {
+		method dify.Operation
+		call   func() error
+	}{
+		{method: dify.OperationChatMessage, call: func() error { _, err := client.ChatMessage(ctx, dify.ChatMessageOption{}); return err }},
+		{method: dify.OperationUploadFile, call: func() error { _, err := client.UploadFile(ctx, dify.UploadFileOption{}); return err }},
+		{method: dify.OperationUploadFileViaGin, call: func() error { _, err := client.UploadFileViaGin(ctx, dify.UploadFileViaGinOption{}); return err }},
+		{method: dify.OperationStopTask, call: func() error { _, err := client.StopTask(ctx, dify.StopTaskOption{}); return err }},
+		{method: dify.OperationGetSuggested, call: func() error { _, err := client.GetSuggested(ctx, dify.GetSuggestedOption{}); return err }},
+		{method: dify.OperationGetMessages, call: func() error { _, err := client.GetMessages(ctx, dify.GetMessagesOption{}); return err }},
+		{method: dify.OperationGetConversations, call: func() error { _, err := client.GetConversations(ctx, dify.GetConversationsOption{}); return err }},
+		{method: dify.OperationDeleteConversation, call: func() error { _, err := client.DeleteConversation(ctx, dify.DeleteConversationOption{}); return err }},
+		{method: dify.OperationConversationRename, call: func() error { _, err := client.ConversationRename(ctx, dify.ConversationRenameOption{}); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.method), func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, mock.ErrNotMocked) {
+				t.Errorf("error = %v, want ErrNotMocked", err)
+			}
+			if calls := client.CallsTo(tt.method); len(calls) != 1 {
+				t.Errorf("CallsTo(%s) = %d calls, want 1", tt.method, len(calls))
+			}
+		})
+	}
+	if calls := client.Calls(); len(calls) != len(tests) {
+		t.Errorf("Calls() = %d, want %d", len(calls), len(tests))
+	}
+}
+
+func TestCallsAndReset(t *testing.T) {
+	client := &mock.Client{
+		StopTaskFunc: func(ctx context.Context, option dify.StopTaskOption) (*dify.StopTaskResp, error) {
+			return &dify.StopTaskResp{Result: "success"}, nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = client.StopTask(context.Background(), dify.StopTaskOption{TaskId: "t1"})
+		}()
+	}
+	wg.Wait()
+
+	calls := client.CallsTo(dify.OperationStopTask)
+	if len(calls) != 10 || calls[0].Option.(dify.StopTaskOption).TaskId != "t1" {
+		t.Errorf("calls = %+v", calls)
+	}
+	client.Reset()
+	if len(client.Calls()) != 0 || client.StopTaskFunc == nil {
+		t.Error("Reset() should clear calls and keep the functions")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	events := []dify.ChatMessageRespSSEData{
+		{Event: "message", Answer: "你"},
+		{Event: "message", Answer: "好"},
+		{Event: "message_end"},
+	}
+	blocking := &dify.ChatMessageResp{Answer: "你好"}
+	client := &mock.Client{ChatMessageFunc: mock.Events(blocking, events...)}
+
+	resp, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{})
+	if err != nil || resp != blocking {
+		t.Errorf("blocking ChatMessage() = %+v, %v", resp, err)
+	}
+
+	var got []string
+	resp, err = client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		OnEvent: func(ev dify.ChatMessageRespSSEData) {
+			got = append(got, ev.Event+":"+ev.Answer)
+		},
+	})
+	if err != nil || resp != nil || len(got) != 3 || got[1] != "message:好" {
+		t.Errorf("streaming ChatMessage() = %+v, %v, events = %v", resp, err, got)
+	}
+
+	// ctx 取消后不再发送剩余事件
+	ctx, cancel := context.WithCancel(context.Background())
+	got = nil
+	_, err = client.ChatMessage(ctx, dify.ChatMessageOption{
+		OnEvent: func(ev dify.ChatMessageRespSSEData) {
+			got = append(got, ev.Answer)
+			cancel()
+		},
+	})
+	if !errors.Is(err, context.Canceled) || len(got) != 1 {
+		t.Errorf("cancelled ChatMessage() error = %v, events = %v", err, got)
+	}
+}
+
+func TestSessionWithMock(t *testing.T) {
+	client := &mock.Client{
+		ChatMessageFunc: func(ctx context.Context, option dify.ChatMessageOption) (*dify.ChatMessageResp, error) {
+			return &dify.ChatMessageResp{ConversationId: "c1", MessageId: "m1", Answer: "ok"}, nil
+		},
+	}
+	session := dify.NewSession(client, "app-test", "user-1")
+	for range 2 {
+		if _, err := session.Send(context.Background(), "hi", dify.SendOption{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	calls := client.CallsTo(dify.OperationChatMessage)
+	first := calls[0].Option.(dify.ChatMessageOption).RequestBody
+	second := calls[1].Option.(dify.ChatMessageOption).RequestBody
+	if first.ConversationId != "" || second.ConversationId != "c1" || second.User != "user-1" {
+		t.Errorf("request bodies = %+v, %+v", first, second)
+	}
+}
@@ -0,0 +1,129 @@
+package dify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// Operation 客户端方法名，用于观察者和中间件区分调用
+type Operation string
+
+const (
+	OperationChatMessage        Operation = "ChatMessage"
+	OperationUploadFile         Operation = "UploadFile"
+	OperationUploadFileViaGin   Operation = "UploadFileViaGin"
+	OperationStopTask           Operation = "StopTask"
+	OperationGetSuggested       Operation = "GetSuggested"
+	OperationGetMessages        Operation = "GetMessages"
+	OperationGetConversations   Operation = "GetConversations"
+	OperationDeleteConversation Operation = "DeleteConversation"
+	OperationConversationRename Operation = "ConversationRename"
+)
+
+// Observer 观察客户端的每次 API 调用，用于接入链路追踪、指标等
+type Observer interface {
+	// CallStarted 在调用开始时执行，返回的 ctx 会用于本次调用的后续请求
+	CallStarted(ctx context.Context, info CallInfo) (context.Context, CallObserver)
+}
+
+// CallObserver 观察单次 API 调用
+type CallObserver interface {
+	// Attempt 每次向服务地址发出请求前调用，attempt 从 0 开始，大于 0 表示切换地址后的重试
+	Attempt(endpoint string, attempt int)
+	// Event 收到流式事件时调用
+	Event(ev ChatMessageRespSSEData)
+	// Finished 调用结束时调用，statusCode 为最后一次响应的 HTTP 状态码，未收到响应时为 0，
+	// resp 为方法的返回参，如 *ChatMessageResp
+	Finished(statusCode int, resp any, err error)
+}
+
+// CallInfo 一次 API 调用的信息
+type CallInfo struct {
+	Operation      Operation
+	ApiPath        string
+	App            string // 应用名，取自 ClientConfig.AppNames，未配置时为密钥的哈希，如 key-1a2b3c4d5e6f7a8b
+	ResponseMode   string // 仅 ChatMessage 有值
+	ConversationId string
+	User           string
+}
+
+type callStateKey struct{}
+
+// callState 单次调用的观察状态，通过 ctx 传递给 request
+type callState struct {
+	observers  []CallObserver
+	attempts   int
+	statusCode int
+}
+
+// startCall 通知所有观察者调用开始
+func (c *Client) startCall(ctx context.Context, info CallInfo) (context.Context, *callState) {
+	state := &callState{}
+	for _, observer := range c.config.Observers {
+		var callObserver CallObserver
+		ctx, callObserver = observer.CallStarted(ctx, info)
+		if callObserver != nil {
+			state.observers = append(state.observers, callObserver)
+		}
+	}
+	return context.WithValue(ctx, callStateKey{}, state), state
+}
+
+func callStateFromContext(ctx context.Context) *callState {
+	state, _ := ctx.Value(callStateKey{}).(*callState)
+	return state
+}
+
+func (s *callState) attempt(endpoint string) {
+	if s == nil {
+		return
+	}
+	for _, observer := range s.observers {
+		observer.Attempt(endpoint, s.attempts)
+	}
+	s.attempts++
+}
+
+func (s *callState) response(response *http.Response) {
+	if s == nil || response == nil {
+		return
+	}
+	s.statusCode = response.StatusCode
+}
+
+func (s *callState) event(ev ChatMessageRespSSEData) {
+	if s == nil {
+		return
+	}
+	for _, observer := range s.observers {
+		observer.Event(ev)
+	}
+}
+
+func (s *callState) finished(resp any, err error) {
+	if s == nil {
+		return
+	}
+	for _, observer := range s.observers {
+		observer.Finished(s.statusCode, resp, err)
+	}
+}
+
+// appName 返回密钥对应的应用名
+//
+// 未配置应用名时使用完整密钥的哈希，既不会泄露密钥，也不会让首尾相同的不同密钥
+// 在用量、额度等按应用汇总的存储中混在一起。
+func (c *Client) appName(apiKey string) string {
+	if name, ok := c.config.AppNames[apiKey]; ok {
+		return name
+	}
+	return hashApiKey(apiKey)
+}
+
+// hashApiKey 返回密钥 SHA-256 的前 8 个字节
+func hashApiKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "key-" + hex.EncodeToString(sum[:8])
+}
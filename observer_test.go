@@ -0,0 +1,135 @@
+package dify_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+// recordingObserver 按顺序记录观察到的回调
+type recordingObserver struct {
+	mu    sync.Mutex
+	calls []string
+	infos []dify.CallInfo
+}
+
+func (o *recordingObserver) CallStarted(ctx context.Context, info dify.CallInfo) (context.Context, dify.CallObserver) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.infos = append(o.infos, info)
+	o.calls = append(o.calls, "start "+string(info.Operation))
+	return ctx, o
+}
+
+func (o *recordingObserver) Attempt(endpoint string, attempt int) {
+	o.record(fmt.Sprintf("attempt %d", attempt))
+}
+
+func (o *recordingObserver) Event(ev dify.ChatMessageRespSSEData) {
+	o.record("event " + ev.Event)
+}
+
+func (o *recordingObserver) Finished(statusCode int, resp any, err error) {
+	o.record(fmt.Sprintf("finished %d %T %v", statusCode, resp, err != nil))
+}
+
+func (o *recordingObserver) record(call string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.calls = append(o.calls, call)
+}
+
+func TestObserver(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(server *difytest.Server)
+		mode  string
+		want  string
+	}{
+		{
+			name: "blocking",
+			mode: dify.ResponseModeBlocking,
+			want: "start ChatMessage|attempt 0|finished 200 *dify.ChatMessageResp false",
+		},
+		{
+			name:  "streaming",
+			setup: func(server *difytest.Server) { server.Enqueue(difytest.Reply{Chunks: []string{"a", "b"}}) },
+			mode:  dify.ResponseModeStreaming,
+			want:  "start ChatMessage|attempt 0|event message|event message|event message_end|finished 200 *dify.ChatMessageResp false",
+		},
+		{
+			name: "api error",
+			setup: func(server *difytest.Server) {
+				server.Fail(http.MethodPost, "/chat-messages", difytest.Error{Status: http.StatusBadRequest, Code: "invalid_param"})
+			},
+			mode: dify.ResponseModeBlocking,
+			want: "start ChatMessage|attempt 0|finished 400 *dify.ChatMessageResp true",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := difytest.NewServer()
+			defer server.Close()
+			if tt.setup != nil {
+				tt.setup(server)
+			}
+			observer := &recordingObserver{}
+			client := dify.NewClient(server.URL, dify.WithObserver(observer), dify.WithAppName("app-test", "客服"))
+
+			_, _ = client.ChatMessage(context.Background(), dify.ChatMessageOption{
+				ApiKey:      "app-test",
+				OnEvent:     func(dify.ChatMessageRespSSEData) {},
+				RequestBody: dify.ChatMessageReq{Query: "hi", ResponseMode: tt.mode, User: "user-1"},
+			})
+
+			if got := strings.Join(observer.calls, "|"); got != tt.want {
+				t.Errorf("calls = %s, want %s", got, tt.want)
+			}
+			info := observer.infos[0]
+			if info.App != "客服" || info.ApiPath != dify.ApiPathChatMessage || info.ResponseMode != tt.mode || info.User != "user-1" {
+				t.Errorf("CallInfo = %+v", info)
+			}
+		})
+	}
+}
+
+func TestObserverChainsContext(t *testing.T) {
+	type ctxKey struct{}
+	server := difytest.NewServer()
+	defer server.Close()
+
+	// 后一个观察者能看到前一个观察者写入 ctx 的值，返回 nil 的观察者不再收到后续回调
+	var seen []any
+	first := observerFunc(func(ctx context.Context, info dify.CallInfo) context.Context {
+		return context.WithValue(ctx, ctxKey{}, "span-1")
+	})
+	second := observerFunc(func(ctx context.Context, info dify.CallInfo) context.Context {
+		seen = append(seen, ctx.Value(ctxKey{}))
+		return ctx
+	})
+	client := dify.NewClient(server.URL, dify.WithObserver(first), dify.WithObserver(second))
+
+	_, err := client.GetConversations(context.Background(), dify.GetConversationsOption{
+		ApiKey:        "app-test",
+		RequestParams: dify.GetConversationsReq{User: "user-1"},
+	})
+	if err != nil {
+		t.Fatalf("GetConversations() error = %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "span-1" {
+		t.Errorf("second observer saw %v, want [span-1]", seen)
+	}
+}
+
+// observerFunc 只修改 ctx、不观察后续回调的观察者
+type observerFunc func(ctx context.Context, info dify.CallInfo) context.Context
+
+func (f observerFunc) CallStarted(ctx context.Context, info dify.CallInfo) (context.Context, dify.CallObserver) {
+	return f(ctx, info), nil
+}
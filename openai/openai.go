@@ -0,0 +1,502 @@
+// Package openai 以 OpenAI Chat Completions 协议对外提供 Dify 对话应用
+//
+// 只支持 OpenAI 协议的工具可以把 Dify 应用当作模型使用：
+//
+//	server := openai.NewServer(openai.ServerOption{
+//		Client: client,
+//		Apps: []openai.App{
+//			{Model: "customer-service", ApiKey: os.Getenv("DIFY_API_KEY")},
+//		},
+//	})
+//	http.ListenAndServe(":8080", server)
+//
+// 每次请求只把最后一条 user 消息作为 ChatMessageReq.Query 发送，历史由 Dify 会话保存。
+// 会话 ID 优先取自请求头 X-Dify-Conversation-Id（响应中同样返回该请求头）；
+// 未携带时根据模型、用户和此前的消息内容推导，使客户端重发完整历史时仍能继续同一会话。
+package openai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+const DefaultConversationHeader = "X-Dify-Conversation-Id"
+
+// App 对外暴露为一个模型的 Dify 应用
+type App struct {
+	Model       string                 // 模型名，对应请求中的 model
+	ApiKey      string                 // 应用的密钥
+	Inputs      map[string]interface{} // 可选，每次请求携带的应用变量
+	SystemInput string                 // 可选，将 system 消息写入该应用变量，为空时忽略 system 消息
+}
+
+// ServerOption 网关配置
+type ServerOption struct {
+	Client dify.ClientI
+	Apps   []App
+	// Authenticate 可选，校验请求并返回 Dify 的用户标识；为空时使用请求中的 user 字段，仍为空时使用 openai。
+	// /v1/models 没有请求体，req 为空的 ChatCompletionReq，只需校验 r，返回的用户标识不会被使用
+	Authenticate func(r *http.Request, req *ChatCompletionReq) (user string, err error)
+	// ConversationHeader 传递会话 ID 的请求头，默认 X-Dify-Conversation-Id
+	ConversationHeader string
+	// MaxConversations 最多记录多少个推导出的会话，默认 100000
+	MaxConversations int
+}
+
+// Server 实现 /v1/chat/completions 和 /v1/models 的 http.Handler
+type Server struct {
+	option ServerOption
+	apps   map[string]App
+	mux    *http.ServeMux
+
+	mu            sync.Mutex
+	conversations map[string]string // 消息历史摘要到 Dify 会话 ID
+}
+
+func NewServer(option ServerOption) *Server {
+	if option.ConversationHeader == "" {
+		option.ConversationHeader = DefaultConversationHeader
+	}
+	if option.MaxConversations <= 0 {
+		option.MaxConversations = 100000
+	}
+	s := &Server{
+		option:        option,
+		apps:          make(map[string]App),
+		mux:           http.NewServeMux(),
+		conversations: make(map[string]string),
+	}
+	for _, app := range option.Apps {
+		s.apps[app.Model] = app
+	}
+	s.mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	s.mux.HandleFunc("GET /v1/models", s.models)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ChatCompletionReq /v1/chat/completions 的请求参数，只解析网关用到的字段
+type ChatCompletionReq struct {
+	Model         string         `json:"model"`
+	Messages      []Message      `json:"messages"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *StreamOptions `json:"stream_options"`
+	User          string         `json:"user"`
+}
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+type Message struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// Content 消息内容，兼容字符串和 [{"type":"text","text":"..."}] 两种格式，只保留文本
+type Content string
+
+func (c *Content) UnmarshalJSON(data []byte) error {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		*c = Content(text)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if unmarshalErr := json.Unmarshal(data, &parts); unmarshalErr != nil {
+		return unmarshalErr
+	}
+	var builder strings.Builder
+	for _, part := range parts {
+		if part.Type == "text" {
+			builder.WriteString(part.Text)
+		}
+	}
+	*c = Content(builder.String())
+	return nil
+}
+
+type ChatCompletionResp struct {
+	Id      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage,omitempty"`
+}
+type Choice struct {
+	Index        int      `json:"index"`
+	Message      *Message `json:"message,omitempty"` // 非流式
+	Delta        *Delta   `json:"delta,omitempty"`   // 流式
+	FinishReason *string  `json:"finish_reason"`
+}
+type Delta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+	Refusal string `json:"refusal,omitempty"` // 已发送的回答被内容审查替换时，替换后的内容
+}
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ModelsResp struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+type Model struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func (s *Server) models(w http.ResponseWriter, r *http.Request) {
+	if s.option.Authenticate != nil {
+		if _, authErr := s.option.Authenticate(r, &ChatCompletionReq{}); authErr != nil {
+			writeError(w, http.StatusUnauthorized, "invalid_request_error", authErr.Error())
+			return
+		}
+	}
+	resp := ModelsResp{Object: "list", Data: []Model{}}
+	for _, app := range s.option.Apps {
+		resp.Data = append(resp.Data, Model{Id: app.Model, Object: "model", OwnedBy: "dify"})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req ChatCompletionReq
+	if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("decodeErr: %s", decodeErr.Error()))
+		return
+	}
+	app, ok := s.apps[req.Model]
+	if !ok {
+		writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("model %q does not exist", req.Model))
+		return
+	}
+
+	user := req.User
+	if s.option.Authenticate != nil {
+		authenticatedUser, authErr := s.option.Authenticate(r, &req)
+		if authErr != nil {
+			writeError(w, http.StatusUnauthorized, "invalid_request_error", authErr.Error())
+			return
+		}
+		user = authenticatedUser
+	}
+	if user == "" {
+		user = "openai"
+	}
+
+	// 最后一条 user 消息作为本轮提问，之前的消息用于推导会话
+	last := -1
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages must contain a user message")
+		return
+	}
+	history := req.Messages[:last]
+	query := string(req.Messages[last].Content)
+
+	conversationId := r.Header.Get(s.option.ConversationHeader)
+	if conversationId == "" {
+		conversationId = s.lookup(req.Model, user, history)
+	}
+
+	inputs := make(map[string]interface{}, len(app.Inputs)+1)
+	for k, v := range app.Inputs {
+		inputs[k] = v
+	}
+	if app.SystemInput != "" {
+		var system []string
+		for _, message := range req.Messages {
+			if message.Role == "system" || message.Role == "developer" {
+				system = append(system, string(message.Content))
+			}
+		}
+		if len(system) > 0 {
+			inputs[app.SystemInput] = strings.Join(system, "\n")
+		}
+	}
+
+	option := dify.ChatMessageOption{
+		ApiKey: app.ApiKey,
+		RequestBody: dify.ChatMessageReq{
+			Inputs:         inputs,
+			Query:          query,
+			ResponseMode:   dify.ResponseModeBlocking,
+			ConversationId: conversationId,
+			User:           user,
+		},
+	}
+	if req.Stream {
+		s.stream(w, r, &req, option, history)
+		return
+	}
+
+	resp, chatMessageErr := s.option.Client.ChatMessage(r.Context(), option)
+	if chatMessageErr != nil {
+		writeDifyError(w, chatMessageErr)
+		return
+	}
+	s.remember(req.Model, user, history, query, resp.Answer, resp.ConversationId)
+
+	stop := "stop"
+	w.Header().Set(s.option.ConversationHeader, resp.ConversationId)
+	writeJSON(w, http.StatusOK, ChatCompletionResp{
+		Id:      "chatcmpl-" + resp.MessageId,
+		Object:  "chat.completion",
+		Created: created(resp.CreatedAt),
+		Model:   req.Model,
+		Choices: []Choice{{
+			Message:      &Message{Role: "assistant", Content: Content(resp.Answer)},
+			FinishReason: &stop,
+		}},
+		Usage: usage(resp.Metadata.Usage),
+	})
+}
+
+// stream 以 chat.completion.chunk 流式返回，客户端断开时停止 Dify 端的生成
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, req *ChatCompletionReq, option dify.ChatMessageOption, history []Message) {
+	option.AutoStop = &dify.AutoStopOption{}
+	stream := dify.NewChatMessageStream(r.Context(), s.option.Client, option)
+	defer stream.Close()
+
+	// 先取得首个事件，请求失败时仍可以返回普通的错误响应
+	first, recvErr := stream.Recv()
+	if recvErr != nil {
+		if recvErr == io.EOF {
+			recvErr = errors.New("empty stream")
+		}
+		writeDifyError(w, recvErr)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.Header().Set(s.option.ConversationHeader, first.ConversationId)
+	w.WriteHeader(http.StatusOK)
+
+	chunk := ChatCompletionResp{
+		Id:      "chatcmpl-" + first.MessageId,
+		Object:  "chat.completion.chunk",
+		Created: created(first.CreatedAt),
+		Model:   req.Model,
+	}
+	write := func(choices []Choice, usage *Usage) bool {
+		chunk.Choices = choices
+		chunk.Usage = usage
+		data, _ := json.Marshal(chunk)
+		if _, writeErr := fmt.Fprintf(w, "data: %s\n\n", data); writeErr != nil {
+			return false
+		}
+		return controller.Flush() == nil
+	}
+	if !write([]Choice{{Delta: &Delta{Role: "assistant"}}}, nil) {
+		return
+	}
+
+	var answer strings.Builder
+	streamed := false // 是否已发送回答片段
+	filtered := false // 是否已因内容审查结束回答
+	ev := first
+	for {
+		switch ev.Event {
+		case "message", "agent_message":
+			if filtered {
+				break
+			}
+			answer.WriteString(ev.Answer)
+			if ev.Answer == "" {
+				break
+			}
+			streamed = true
+			if !write([]Choice{{Delta: &Delta{Content: ev.Answer}}}, nil) {
+				return
+			}
+		case "message_replace":
+			// 内容审查替换了回答，会话按替换后的回答记录
+			answer.Reset()
+			answer.WriteString(ev.Answer)
+			if !streamed {
+				// 还没有发送片段时只发送替换后的内容，与非流式一致
+				streamed = ev.Answer != ""
+				if streamed && !write([]Choice{{Delta: &Delta{Content: ev.Answer}}}, nil) {
+					return
+				}
+				break
+			}
+			// 已发送的片段无法撤回，以 content_filter 结束回答，替换后的内容放在 refusal 中，
+			// 客户端可据此丢弃已显示的片段
+			filtered = true
+			contentFilter := "content_filter"
+			if !write([]Choice{{Delta: &Delta{Refusal: ev.Answer}, FinishReason: &contentFilter}}, nil) {
+				return
+			}
+		case "message_end":
+			stop := "stop"
+			if !filtered && !write([]Choice{{Delta: &Delta{}, FinishReason: &stop}}, nil) {
+				return
+			}
+			if req.StreamOptions != nil && req.StreamOptions.IncludeUsage && !write([]Choice{}, usage(ev.Metadata.Usage)) {
+				return
+			}
+			s.remember(req.Model, option.RequestBody.User, history, option.RequestBody.Query, answer.String(), ev.ConversationId)
+		}
+
+		ev, recvErr = stream.Recv()
+		if recvErr == io.EOF {
+			break
+		}
+		if recvErr != nil {
+			if r.Context().Err() == nil {
+				data, _ := json.Marshal(errorResp(recvErr))
+				_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+			}
+			return
+		}
+	}
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	_ = controller.Flush()
+}
+
+// conversationKey 根据模型、用户和消息历史计算摘要
+func conversationKey(model string, user string, messages []Message) string {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\x00%s\x00", model, user)
+	for _, message := range messages {
+		if message.Role == "system" || message.Role == "developer" {
+			continue
+		}
+		_, _ = fmt.Fprintf(hash, "%s\x00%s\x00", message.Role, message.Content)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// lookup 返回历史消息对应的会话 ID，没有历史或未记录时返回空字符串，即新建会话
+func (s *Server) lookup(model string, user string, history []Message) string {
+	if len(history) == 0 {
+		return ""
+	}
+	key := conversationKey(model, user, history)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conversations[key]
+}
+
+// remember 记录本轮结束后的历史对应的会话 ID，客户端下次带着完整历史请求时可以继续该会话
+func (s *Server) remember(model string, user string, history []Message, query string, answer string, conversationId string) {
+	if conversationId == "" {
+		return
+	}
+	messages := make([]Message, 0, len(history)+2)
+	messages = append(messages, history...)
+	messages = append(messages, Message{Role: "user", Content: Content(query)}, Message{Role: "assistant", Content: Content(answer)})
+	key := conversationKey(model, user, messages)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.conversations[key]; !ok && len(s.conversations) >= s.option.MaxConversations {
+		// 超出上限时随机淘汰一个，被淘汰的历史会开启新会话
+		for k := range s.conversations {
+			delete(s.conversations, k)
+			break
+		}
+	}
+	s.conversations[key] = conversationId
+}
+
+// created 返回消息的创建时间，Dify 未返回时使用当前时间
+func created(createdAt int) int64 {
+	if createdAt == 0 {
+		return time.Now().Unix()
+	}
+	return int64(createdAt)
+}
+
+func usage(u dify.Usage) *Usage {
+	return &Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
+
+type ErrorResp struct {
+	Error ErrorDetail `json:"error"`
+}
+type ErrorDetail struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+func errorResp(err error) ErrorResp {
+	resp := ErrorResp{Error: ErrorDetail{Message: err.Error(), Type: "api_error"}}
+	var apiErr *dify.APIError
+	if errors.As(err, &apiErr) {
+		resp.Error.Code = apiErr.Code
+		if apiErr.Message != "" {
+			resp.Error.Message = apiErr.Message
+		}
+		if apiErr.StatusCode < http.StatusInternalServerError {
+			resp.Error.Type = "invalid_request_error"
+		}
+	}
+	if errors.Is(err, dify.ErrBudgetExceeded) {
+		resp.Error.Type = "insufficient_quota"
+	}
+	return resp
+}
+
+// writeDifyError 以 OpenAI 的错误格式返回，尽量保留 Dify 的状态码
+func writeDifyError(w http.ResponseWriter, err error) {
+	statusCode := http.StatusBadGateway
+	var apiErr *dify.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		statusCode = apiErr.StatusCode
+	case errors.Is(err, dify.ErrBudgetExceeded):
+		statusCode = http.StatusTooManyRequests
+	case errors.Is(err, context.Canceled):
+		statusCode = 499
+	}
+	writeJSON(w, statusCode, errorResp(err))
+}
+
+func writeError(w http.ResponseWriter, statusCode int, errType string, message string) {
+	writeJSON(w, statusCode, ErrorResp{Error: ErrorDetail{Message: message, Type: errType}})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+var _ http.Handler = (*Server)(nil)
@@ -0,0 +1,278 @@
+package openai_test
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+	"github.com/Davied-H/dify-go/mock"
+	"github.com/Davied-H/dify-go/openai"
+)
+
+// newGateway 启动网关，模型 assistant 对应密钥 app-test
+func newGateway(t *testing.T, client dify.ClientI) *httptest.Server {
+	t.Helper()
+	gateway := httptest.NewServer(openai.NewServer(openai.ServerOption{
+		Client: client,
+		Apps:   []openai.App{{Model: "assistant", ApiKey: "app-test", SystemInput: "system"}},
+	}))
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func post(t *testing.T, gateway *httptest.Server, body string) *http.Response {
+	t.Helper()
+	response, err := http.Post(gateway.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = response.Body.Close()
+	})
+	return response
+}
+
+func TestChatCompletions(t *testing.T) {
+	server := difytest.NewServer()
+	t.Cleanup(server.Close)
+	server.Enqueue(difytest.Reply{Answer: "你好", Usage: dify.Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3}}, difytest.Reply{Answer: "再见"})
+	gateway := newGateway(t, dify.NewClient(server.URL))
+
+	response := post(t, gateway, `{"model":"assistant","user":"u1","messages":[{"role":"system","content":"be nice"},{"role":"user","content":[{"type":"text","text":"hi"}]}]}`)
+	var resp openai.ChatCompletionResp
+	if err := json.NewDecoder(response.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || resp.Choices[0].Message.Content != "你好" || resp.Usage.TotalTokens != 3 {
+		t.Errorf("response = %d %+v", response.StatusCode, resp)
+	}
+	conversationId := response.Header.Get(openai.DefaultConversationHeader)
+	var body dify.ChatMessageReq
+	_ = server.AssertRequested(t, http.MethodPost, "/chat-messages").JSON(&body)
+	if conversationId == "" || body.Query != "hi" || body.User != "u1" || body.Inputs["system"] != "be nice" {
+		t.Errorf("conversation = %q, request body = %+v", conversationId, body)
+	}
+
+	// 带着完整历史重发时继续同一会话
+	response = post(t, gateway, `{"model":"assistant","user":"u1","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"你好"},{"role":"user","content":"bye"}]}`)
+	if got := response.Header.Get(openai.DefaultConversationHeader); got != conversationId {
+		t.Errorf("conversation = %q, want %q", got, conversationId)
+	}
+}
+
+func TestChatCompletionsErrors(t *testing.T) {
+	server := difytest.NewServer()
+	t.Cleanup(server.Close)
+	server.Fail(http.MethodPost, "/chat-messages", difytest.Error{Status: http.StatusTooManyRequests, Code: "too_many_requests", Message: "slow down"})
+	gateway := newGateway(t, dify.NewClient(server.URL))
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		code       string
+	}{
+		{name: "unknown model", body: `{"model":"gpt","messages":[{"role":"user","content":"hi"}]}`, statusCode: http.StatusNotFound},
+		{name: "no user message", body: `{"model":"assistant","messages":[{"role":"system","content":"hi"}]}`, statusCode: http.StatusBadRequest},
+		{name: "upstream error", body: `{"model":"assistant","messages":[{"role":"user","content":"hi"}]}`, statusCode: http.StatusTooManyRequests, code: "too_many_requests"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := post(t, gateway, tt.body)
+			var resp openai.ErrorResp
+			if err := json.NewDecoder(response.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != tt.statusCode || resp.Error.Code != tt.code || resp.Error.Message == "" {
+				t.Errorf("response = %d %+v", response.StatusCode, resp)
+			}
+		})
+	}
+}
+
+// readChunks 读取流式响应，返回拼接的内容和是否收到 [DONE]
+func readChunks(t *testing.T, response *http.Response) (string, *openai.Usage, bool) {
+	t.Helper()
+	var content strings.Builder
+	var usage *openai.Usage
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			return content.String(), usage, true
+		}
+		var chunk openai.ChatCompletionResp
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+		}
+	}
+	return content.String(), usage, false
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	server := difytest.NewServer()
+	t.Cleanup(server.Close)
+	server.Enqueue(difytest.Reply{Chunks: []string{"你", "好"}, Usage: dify.Usage{TotalTokens: 5}})
+	gateway := newGateway(t, dify.NewClient(server.URL))
+
+	response := post(t, gateway, `{"model":"assistant","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`)
+	content, usage, done := readChunks(t, response)
+	if content != "你好" || usage == nil || usage.TotalTokens != 5 || !done {
+		t.Errorf("content = %q, usage = %+v, done = %v", content, usage, done)
+	}
+	if response.Header.Get("Content-Type") != "text/event-stream" || response.Header.Get(openai.DefaultConversationHeader) == "" {
+		t.Errorf("headers = %v", response.Header)
+	}
+}
+
+// readChoices 读取流式响应中的所有 choice
+func readChoices(t *testing.T, response *http.Response) []openai.Choice {
+	t.Helper()
+	var choices []openai.Choice
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk openai.ChatCompletionResp
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		choices = append(choices, chunk.Choices...)
+	}
+	return choices
+}
+
+func TestChatCompletionsStreamModerated(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []dify.ChatMessageRespSSEData
+		content string
+		refusal string
+		finish  string
+	}{
+		{
+			name: "after streamed content",
+			events: []dify.ChatMessageRespSSEData{
+				{Event: "message", ConversationId: "c1", MessageId: "m1", Answer: "敏感"},
+				{Event: "message_replace", ConversationId: "c1", MessageId: "m1", Answer: "内容已屏蔽"},
+				{Event: "message_end", ConversationId: "c1", MessageId: "m1"},
+			},
+			content: "敏感",
+			refusal: "内容已屏蔽",
+			finish:  "content_filter",
+		},
+		{
+			name: "before any content",
+			events: []dify.ChatMessageRespSSEData{
+				{Event: "message", ConversationId: "c1", MessageId: "m1"},
+				{Event: "message_replace", ConversationId: "c1", MessageId: "m1", Answer: "内容已屏蔽"},
+				{Event: "message_end", ConversationId: "c1", MessageId: "m1"},
+			},
+			content: "内容已屏蔽",
+			finish:  "stop",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mock.Client{}
+			client.ChatMessageFunc = func(ctx context.Context, option dify.ChatMessageOption) (*dify.ChatMessageResp, error) {
+				if option.OnEvent == nil {
+					return &dify.ChatMessageResp{ConversationId: cmp.Or(option.RequestBody.ConversationId, "c2"), Answer: "ok"}, nil
+				}
+				return mock.Events(nil, tt.events...)(ctx, option)
+			}
+			gateway := newGateway(t, client)
+
+			// 替换后的内容只出现一次，不会接在已发送的片段之后
+			var content, refusal, finish strings.Builder
+			for _, choice := range readChoices(t, post(t, gateway, `{"model":"assistant","stream":true,"messages":[{"role":"user","content":"hi"}]}`)) {
+				content.WriteString(choice.Delta.Content)
+				refusal.WriteString(choice.Delta.Refusal)
+				if choice.FinishReason != nil {
+					finish.WriteString(*choice.FinishReason)
+				}
+			}
+			if content.String() != tt.content || refusal.String() != tt.refusal || finish.String() != tt.finish {
+				t.Errorf("content = %q, refusal = %q, finish = %q", content.String(), refusal.String(), finish.String())
+			}
+
+			// 会话按替换后的回答记录，与非流式一致
+			response := post(t, gateway, `{"model":"assistant","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"内容已屏蔽"},{"role":"user","content":"again"}]}`)
+			if got := response.Header.Get(openai.DefaultConversationHeader); got != "c1" {
+				t.Errorf("conversation = %q, want c1", got)
+			}
+		})
+	}
+}
+
+func TestModels(t *testing.T) {
+	gateway := newGateway(t, &mock.Client{})
+	response, err := http.Get(gateway.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	var resp openai.ModelsResp
+	if err := json.NewDecoder(response.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Id != "assistant" {
+		t.Errorf("models = %+v", resp)
+	}
+}
+
+func TestModelsAuthenticate(t *testing.T) {
+	gateway := httptest.NewServer(openai.NewServer(openai.ServerOption{
+		Client: &mock.Client{},
+		Apps:   []openai.App{{Model: "assistant", ApiKey: "app-test"}},
+		// 读取 req.User 的校验函数在 /v1/models 上也不能 panic
+		Authenticate: func(r *http.Request, req *openai.ChatCompletionReq) (string, error) {
+			if r.Header.Get("Authorization") != "Bearer good" {
+				return "", errors.New("invalid api key")
+			}
+			return req.User, nil
+		},
+	}))
+	t.Cleanup(gateway.Close)
+
+	tests := []struct {
+		key    string
+		status int
+	}{
+		{key: "good", status: http.StatusOK},
+		{key: "bad", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		request, _ := http.NewRequest(http.MethodGet, gateway.URL+"/v1/models", nil)
+		request.Header.Set("Authorization", "Bearer "+tt.key)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+		if response.StatusCode != tt.status {
+			t.Errorf("key %s status = %d, want %d", tt.key, response.StatusCode, tt.status)
+		}
+	}
+}
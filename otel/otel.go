@@ -0,0 +1,249 @@
+// Package otel 为 dify 客户端提供 OpenTelemetry 链路追踪与指标
+//
+// 使用方式：
+//
+//	observer, err := otel.NewObserver()
+//	client := dify.NewClient(apiUrl, dify.WithObserver(observer))
+package otel
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	otelglobal "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/Davied-H/dify-go/otel"
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+}
+
+// Option NewObserver 的配置项
+type Option func(*config)
+
+// WithTracerProvider 指定 TracerProvider，默认使用全局 TracerProvider
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// WithMeterProvider 指定 MeterProvider，默认使用全局 MeterProvider
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = provider
+	}
+}
+
+type observer struct {
+	tracer           trace.Tracer
+	duration         metric.Float64Histogram
+	timeToFirstToken metric.Float64Histogram
+	tokens           metric.Int64Counter
+	price            metric.Float64Counter
+}
+
+// NewObserver 创建 OpenTelemetry 观察者
+//
+// 每次 API 调用生成一个 span，流式调用在收到首个回答片段和 message_end 时记录事件；
+// 指标包括调用耗时、首个回答片段耗时、token 数和费用。
+func NewObserver(opts ...Option) (dify.Observer, error) {
+	c := &config{
+		tracerProvider: otelglobal.GetTracerProvider(),
+		meterProvider:  otelglobal.GetMeterProvider(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	meter := c.meterProvider.Meter(instrumentationName)
+	duration, err := meter.Float64Histogram("dify.client.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of Dify API calls"))
+	if err != nil {
+		return nil, err
+	}
+	timeToFirstToken, err := meter.Float64Histogram("dify.client.time_to_first_token",
+		metric.WithUnit("s"),
+		metric.WithDescription("Time from request start to the first streamed answer chunk"))
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := meter.Int64Counter("dify.client.tokens",
+		metric.WithUnit("{token}"),
+		metric.WithDescription("Tokens consumed, by token type"))
+	if err != nil {
+		return nil, err
+	}
+	price, err := meter.Float64Counter("dify.client.price",
+		metric.WithDescription("Total price reported by Dify, by currency"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &observer{
+		tracer:           c.tracerProvider.Tracer(instrumentationName),
+		duration:         duration,
+		timeToFirstToken: timeToFirstToken,
+		tokens:           tokens,
+		price:            price,
+	}, nil
+}
+
+func (o *observer) CallStarted(ctx context.Context, info dify.CallInfo) (context.Context, dify.CallObserver) {
+	attrs := []attribute.KeyValue{
+		attribute.String("dify.operation", string(info.Operation)),
+		attribute.String("dify.app", info.App),
+		attribute.String("dify.api_path", info.ApiPath),
+	}
+	if info.ResponseMode != "" {
+		attrs = append(attrs, attribute.String("dify.response_mode", info.ResponseMode))
+	}
+	if info.ConversationId != "" {
+		attrs = append(attrs, attribute.String("dify.conversation_id", info.ConversationId))
+	}
+
+	ctx, span := o.tracer.Start(ctx, "dify."+string(info.Operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+
+	return ctx, &callObserver{
+		observer: o,
+		ctx:      ctx,
+		span:     span,
+		info:     info,
+		start:    time.Now(),
+	}
+}
+
+type callObserver struct {
+	observer *observer
+	ctx      context.Context
+	span     trace.Span
+	info     dify.CallInfo
+	start    time.Time
+
+	mu             sync.Mutex
+	endpoint       string
+	firstToken     bool
+	usageRecorded  bool
+	conversationId string
+}
+
+func (c *callObserver) Attempt(endpoint string, attempt int) {
+	c.mu.Lock()
+	c.endpoint = endpoint
+	c.mu.Unlock()
+
+	c.span.SetAttributes(
+		attribute.String("dify.endpoint", endpoint),
+		attribute.Int("dify.retry_count", attempt),
+	)
+	if attempt > 0 {
+		c.span.AddEvent("retry", trace.WithAttributes(attribute.String("dify.endpoint", endpoint)))
+	}
+}
+
+func (c *callObserver) Event(ev dify.ChatMessageRespSSEData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conversationId == "" && c.info.ConversationId == "" && ev.ConversationId != "" {
+		c.conversationId = ev.ConversationId
+		c.span.SetAttributes(attribute.String("dify.conversation_id", ev.ConversationId))
+	}
+
+	switch ev.Event {
+	case "message", "agent_message":
+		if c.firstToken {
+			return
+		}
+		c.firstToken = true
+		elapsed := time.Since(c.start)
+		c.span.AddEvent("first_token", trace.WithAttributes(
+			attribute.Float64("dify.time_to_first_token", elapsed.Seconds())))
+		c.observer.timeToFirstToken.Record(c.ctx, elapsed.Seconds(), metric.WithAttributes(c.metricAttributes()...))
+	case "message_end":
+		usage := ev.Metadata.Usage
+		c.span.AddEvent("message_end", trace.WithAttributes(
+			attribute.String("dify.message_id", ev.MessageId),
+			attribute.Int("dify.usage.prompt_tokens", usage.PromptTokens),
+			attribute.Int("dify.usage.completion_tokens", usage.CompletionTokens),
+			attribute.Int("dify.usage.total_tokens", usage.TotalTokens),
+			attribute.String("dify.usage.total_price", usage.TotalPrice),
+			attribute.String("dify.usage.currency", usage.Currency),
+		))
+		c.recordUsage(usage)
+	}
+}
+
+func (c *callObserver) Finished(statusCode int, resp any, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if chatMessageResp, ok := resp.(*dify.ChatMessageResp); ok && chatMessageResp != nil {
+		if c.info.ConversationId == "" && chatMessageResp.ConversationId != "" {
+			c.span.SetAttributes(attribute.String("dify.conversation_id", chatMessageResp.ConversationId))
+		}
+		c.recordUsage(chatMessageResp.Metadata.Usage)
+	}
+
+	if statusCode != 0 {
+		c.span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	}
+	if err != nil {
+		c.span.RecordError(err)
+		c.span.SetStatus(codes.Error, err.Error())
+	}
+
+	attrs := c.metricAttributes()
+	attrs = append(attrs, attribute.Int("http.response.status_code", statusCode))
+	if err != nil {
+		attrs = append(attrs, attribute.Bool("error", true))
+	}
+	c.observer.duration.Record(c.ctx, time.Since(c.start).Seconds(), metric.WithAttributes(attrs...))
+	c.span.End()
+}
+
+// recordUsage 记录用量指标，每次调用只记录一次，调用方需持有锁
+func (c *callObserver) recordUsage(usage dify.Usage) {
+	if c.usageRecorded || usage.TotalTokens == 0 {
+		return
+	}
+	c.usageRecorded = true
+
+	attrs := c.metricAttributes()
+	c.observer.tokens.Add(c.ctx, int64(usage.PromptTokens),
+		metric.WithAttributes(append(attrs, attribute.String("dify.token.type", "prompt"))...))
+	c.observer.tokens.Add(c.ctx, int64(usage.CompletionTokens),
+		metric.WithAttributes(append(attrs, attribute.String("dify.token.type", "completion"))...))
+
+	if totalPrice, parseErr := strconv.ParseFloat(usage.TotalPrice, 64); parseErr == nil {
+		c.observer.price.Add(c.ctx, totalPrice,
+			metric.WithAttributes(append(attrs, attribute.String("dify.usage.currency", usage.Currency))...))
+	}
+}
+
+// metricAttributes 指标使用的低基数属性，调用方需持有锁
+func (c *callObserver) metricAttributes() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("dify.operation", string(c.info.Operation)),
+		attribute.String("dify.app", c.info.App),
+	}
+	if c.info.ResponseMode != "" {
+		attrs = append(attrs, attribute.String("dify.response_mode", c.info.ResponseMode))
+	}
+	if c.endpoint != "" {
+		attrs = append(attrs, attribute.String("dify.endpoint", c.endpoint))
+	}
+	return attrs
+}
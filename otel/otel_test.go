@@ -0,0 +1,170 @@
+package otel
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type testObserver struct {
+	spans  *tracetest.SpanRecorder
+	reader *sdkmetric.ManualReader
+	client dify.ClientI
+	server *difytest.Server
+}
+
+func newTestObserver(t *testing.T) *testObserver {
+	t.Helper()
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	observer, err := NewObserver(
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))),
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+	)
+	if err != nil {
+		t.Fatalf("NewObserver() error = %v", err)
+	}
+	server := difytest.NewServer()
+	t.Cleanup(server.Close)
+	return &testObserver{
+		spans:  spans,
+		reader: reader,
+		client: dify.NewClient(server.URL, dify.WithObserver(observer), dify.WithAppName("app-test", "客服")),
+		server: server,
+	}
+}
+
+func (o *testObserver) chat(mode string) error {
+	_, err := o.client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		ApiKey:      "app-test",
+		OnEvent:     func(dify.ChatMessageRespSSEData) {},
+		RequestBody: dify.ChatMessageReq{Query: "hi", ResponseMode: mode, User: "user-1"},
+	})
+	return err
+}
+
+// metrics 收集一次指标，返回指标名到数据的映射
+func (o *testObserver) metrics(t *testing.T) map[string]metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := o.reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+func spanAttribute(attrs []attribute.KeyValue, key string) attribute.Value {
+	for _, attr := range attrs {
+		if string(attr.Key) == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestObserverStreamingSpan(t *testing.T) {
+	o := newTestObserver(t)
+	o.server.Enqueue(difytest.Reply{Chunks: []string{"你", "好"}, Usage: dify.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5, TotalPrice: "0.01", Currency: "USD"}})
+	if err := o.chat(dify.ResponseModeStreaming); err != nil {
+		t.Fatalf("ChatMessage() error = %v", err)
+	}
+
+	spans := o.spans.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("spans = %d, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "dify.ChatMessage" {
+		t.Errorf("span name = %s", span.Name())
+	}
+	attrs := span.Attributes()
+	if got := spanAttribute(attrs, "dify.app").AsString(); got != "客服" {
+		t.Errorf("dify.app = %q", got)
+	}
+	if got := spanAttribute(attrs, "dify.conversation_id").AsString(); got == "" {
+		t.Error("dify.conversation_id is missing")
+	}
+	if got := spanAttribute(attrs, "http.response.status_code").AsInt64(); got != http.StatusOK {
+		t.Errorf("http.response.status_code = %d", got)
+	}
+	var events []string
+	for _, event := range span.Events() {
+		events = append(events, event.Name)
+	}
+	if len(events) != 2 || events[0] != "first_token" || events[1] != "message_end" {
+		t.Errorf("span events = %v, want [first_token message_end]", events)
+	}
+
+	metrics := o.metrics(t)
+	tokens := metrics["dify.client.tokens"].(metricdata.Sum[int64])
+	byType := make(map[string]int64)
+	for _, point := range tokens.DataPoints {
+		tokenType, _ := point.Attributes.Value("dify.token.type")
+		byType[tokenType.AsString()] += point.Value
+	}
+	if byType["prompt"] != 3 || byType["completion"] != 2 {
+		t.Errorf("tokens = %v, want prompt 3 completion 2", byType)
+	}
+	price := metrics["dify.client.price"].(metricdata.Sum[float64])
+	if len(price.DataPoints) != 1 || price.DataPoints[0].Value != 0.01 {
+		t.Errorf("price = %+v", price.DataPoints)
+	}
+	if ttft := metrics["dify.client.time_to_first_token"].(metricdata.Histogram[float64]); len(ttft.DataPoints) != 1 || ttft.DataPoints[0].Count != 1 {
+		t.Errorf("time_to_first_token = %+v", ttft.DataPoints)
+	}
+}
+
+func TestObserverBlockingUsageRecordedOnce(t *testing.T) {
+	o := newTestObserver(t)
+	o.server.Enqueue(difytest.Reply{Answer: "hi", Usage: dify.Usage{PromptTokens: 4, CompletionTokens: 1, TotalTokens: 5}})
+	if err := o.chat(dify.ResponseModeBlocking); err != nil {
+		t.Fatalf("ChatMessage() error = %v", err)
+	}
+
+	var total int64
+	for _, point := range o.metrics(t)["dify.client.tokens"].(metricdata.Sum[int64]).DataPoints {
+		total += point.Value
+	}
+	if total != 5 {
+		t.Errorf("tokens = %d, want 5", total)
+	}
+}
+
+func TestObserverErrorSpan(t *testing.T) {
+	o := newTestObserver(t)
+	o.server.Fail(http.MethodPost, "/chat-messages", difytest.Error{Status: http.StatusTooManyRequests, Code: "too_many_requests"})
+	if err := o.chat(dify.ResponseModeBlocking); err == nil {
+		t.Fatal("ChatMessage() error = nil, want 429")
+	}
+
+	span := o.spans.Ended()[0]
+	if span.Status().Code != codes.Error {
+		t.Errorf("span status = %v, want error", span.Status())
+	}
+	if got := spanAttribute(span.Attributes(), "http.response.status_code").AsInt64(); got != http.StatusTooManyRequests {
+		t.Errorf("http.response.status_code = %d", got)
+	}
+
+	duration := o.metrics(t)["dify.client.request.duration"].(metricdata.Histogram[float64])
+	if len(duration.DataPoints) != 1 {
+		t.Fatalf("duration points = %d, want 1", len(duration.DataPoints))
+	}
+	if failed, ok := duration.DataPoints[0].Attributes.Value("error"); !ok || !failed.AsBool() {
+		t.Errorf("duration attributes = %v, want error=true", duration.DataPoints[0].Attributes)
+	}
+}
@@ -0,0 +1,202 @@
+// Package prom 为 dify 客户端提供 Prometheus 指标
+//
+// Collector 同时实现 dify.Observer 和 prometheus.Collector：
+//
+//	collector := prom.NewCollector(prom.CollectorOption{})
+//	prometheus.MustRegister(collector)
+//	client := dify.NewClient(apiUrl, dify.WithObserver(collector))
+package prom
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CollectorOption 指标配置
+type CollectorOption struct {
+	Namespace               string    // 指标名前缀，默认 dify_client
+	DurationBuckets         []float64 // 调用耗时直方图的桶，默认 prometheus.DefBuckets
+	TimeToFirstTokenBuckets []float64 // 首个回答片段耗时直方图的桶，默认 prometheus.DefBuckets
+}
+
+// Collector 记录客户端调用次数、错误、耗时和 token 用量
+type Collector struct {
+	requests         *prometheus.CounterVec
+	errors           *prometheus.CounterVec
+	duration         *prometheus.HistogramVec
+	timeToFirstToken *prometheus.HistogramVec
+	tokens           *prometheus.CounterVec
+	price            *prometheus.CounterVec
+}
+
+var (
+	_ dify.Observer        = (*Collector)(nil)
+	_ prometheus.Collector = (*Collector)(nil)
+)
+
+func NewCollector(option CollectorOption) *Collector {
+	namespace := option.Namespace
+	if namespace == "" {
+		namespace = "dify_client"
+	}
+	durationBuckets := option.DurationBuckets
+	if durationBuckets == nil {
+		durationBuckets = prometheus.DefBuckets
+	}
+	timeToFirstTokenBuckets := option.TimeToFirstTokenBuckets
+	if timeToFirstTokenBuckets == nil {
+		timeToFirstTokenBuckets = prometheus.DefBuckets
+	}
+
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Total Dify API calls by app, operation, endpoint and HTTP status code.",
+		}, []string{"app", "operation", "endpoint", "status"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Total failed Dify API calls by app, operation and error code.",
+		}, []string{"app", "operation", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of Dify API calls, including the whole stream for streaming calls.",
+			Buckets:   durationBuckets,
+		}, []string{"app", "operation", "endpoint"}),
+		timeToFirstToken: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "time_to_first_token_seconds",
+			Help:      "Time from request start to the first streamed answer chunk.",
+			Buckets:   timeToFirstTokenBuckets,
+		}, []string{"app", "operation", "endpoint"}),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_total",
+			Help:      "Tokens consumed, by app and token type (prompt or completion).",
+		}, []string{"app", "type"}),
+		price: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "price_total",
+			Help:      "Total price reported by Dify, by app and currency.",
+		}, []string{"app", "currency"}),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.errors.Describe(ch)
+	c.duration.Describe(ch)
+	c.timeToFirstToken.Describe(ch)
+	c.tokens.Describe(ch)
+	c.price.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.errors.Collect(ch)
+	c.duration.Collect(ch)
+	c.timeToFirstToken.Collect(ch)
+	c.tokens.Collect(ch)
+	c.price.Collect(ch)
+}
+
+func (c *Collector) CallStarted(ctx context.Context, info dify.CallInfo) (context.Context, dify.CallObserver) {
+	return ctx, &callObserver{
+		collector: c,
+		info:      info,
+		start:     time.Now(),
+	}
+}
+
+type callObserver struct {
+	collector *Collector
+	info      dify.CallInfo
+	start     time.Time
+
+	mu            sync.Mutex
+	endpoint      string
+	firstToken    bool
+	usageRecorded bool
+}
+
+func (o *callObserver) Attempt(endpoint string, _ int) {
+	o.mu.Lock()
+	o.endpoint = endpoint
+	o.mu.Unlock()
+}
+
+func (o *callObserver) Event(ev dify.ChatMessageRespSSEData) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	switch ev.Event {
+	case "message", "agent_message":
+		if o.firstToken {
+			return
+		}
+		o.firstToken = true
+		o.collector.timeToFirstToken.
+			WithLabelValues(o.info.App, string(o.info.Operation), o.endpoint).
+			Observe(time.Since(o.start).Seconds())
+	case "message_end":
+		o.recordUsage(ev.Metadata.Usage)
+	}
+}
+
+func (o *callObserver) Finished(statusCode int, resp any, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if chatMessageResp, ok := resp.(*dify.ChatMessageResp); ok && chatMessageResp != nil {
+		o.recordUsage(chatMessageResp.Metadata.Usage)
+	}
+
+	operation := string(o.info.Operation)
+	o.collector.requests.WithLabelValues(o.info.App, operation, o.endpoint, strconv.Itoa(statusCode)).Inc()
+	o.collector.duration.WithLabelValues(o.info.App, operation, o.endpoint).Observe(time.Since(o.start).Seconds())
+	if err != nil {
+		o.collector.errors.WithLabelValues(o.info.App, operation, errorCode(err)).Inc()
+	}
+}
+
+// recordUsage 记录 token 与费用，每次调用只记录一次，调用方需持有锁
+func (o *callObserver) recordUsage(usage dify.Usage) {
+	if o.usageRecorded || usage.TotalTokens == 0 {
+		return
+	}
+	o.usageRecorded = true
+
+	o.collector.tokens.WithLabelValues(o.info.App, "prompt").Add(float64(usage.PromptTokens))
+	o.collector.tokens.WithLabelValues(o.info.App, "completion").Add(float64(usage.CompletionTokens))
+	if totalPrice, parseErr := strconv.ParseFloat(usage.TotalPrice, 64); parseErr == nil {
+		o.collector.price.WithLabelValues(o.info.App, usage.Currency).Add(totalPrice)
+	}
+}
+
+// errorCode 将错误归类为低基数的错误码
+func errorCode(err error) string {
+	var apiErr *dify.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		if apiErr.Code != "" {
+			return apiErr.Code
+		}
+		return "http_" + strconv.Itoa(apiErr.StatusCode)
+	case errors.Is(err, dify.ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, dify.ErrRateLimitDeadline):
+		return "deadline_exceeded"
+	default:
+		return "client_error"
+	}
+}
@@ -0,0 +1,112 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestCollector(t *testing.T) (*Collector, *difytest.Server, dify.ClientI) {
+	t.Helper()
+	collector := NewCollector(CollectorOption{})
+	server := difytest.NewServer()
+	t.Cleanup(server.Close)
+	return collector, server, dify.NewClient(server.URL, dify.WithObserver(collector), dify.WithAppName("app-test", "support"))
+}
+
+func chat(client dify.ClientI, mode string) error {
+	_, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		ApiKey:      "app-test",
+		OnEvent:     func(dify.ChatMessageRespSSEData) {},
+		RequestBody: dify.ChatMessageReq{Query: "hi", ResponseMode: mode, User: "user-1"},
+	})
+	return err
+}
+
+func TestCollectorStreaming(t *testing.T) {
+	collector, server, client := newTestCollector(t)
+	server.Enqueue(difytest.Reply{Chunks: []string{"a", "b"}, Usage: dify.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5, TotalPrice: "0.5", Currency: "USD"}})
+	if err := chat(client, dify.ResponseModeStreaming); err != nil {
+		t.Fatalf("ChatMessage() error = %v", err)
+	}
+
+	want := fmt.Sprintf(`
+# HELP dify_client_requests_total Total Dify API calls by app, operation, endpoint and HTTP status code.
+# TYPE dify_client_requests_total counter
+dify_client_requests_total{app="support",endpoint=%q,operation="ChatMessage",status="200"} 1
+# HELP dify_client_tokens_total Tokens consumed, by app and token type (prompt or completion).
+# TYPE dify_client_tokens_total counter
+dify_client_tokens_total{app="support",type="completion"} 2
+dify_client_tokens_total{app="support",type="prompt"} 3
+# HELP dify_client_price_total Total price reported by Dify, by app and currency.
+# TYPE dify_client_price_total counter
+dify_client_price_total{app="support",currency="USD"} 0.5
+`, server.URL)
+	err := testutil.CollectAndCompare(collector, strings.NewReader(want),
+		"dify_client_requests_total", "dify_client_tokens_total", "dify_client_price_total")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(collector, "dify_client_time_to_first_token_seconds"); n != 1 {
+		t.Errorf("time_to_first_token series = %d, want 1", n)
+	}
+	if n := testutil.CollectAndCount(collector, "dify_client_errors_total"); n != 0 {
+		t.Errorf("errors series = %d, want 0", n)
+	}
+}
+
+func TestCollectorBlockingUsageRecordedOnce(t *testing.T) {
+	collector, server, client := newTestCollector(t)
+	server.Enqueue(difytest.Reply{Answer: "hi", Usage: dify.Usage{PromptTokens: 4, CompletionTokens: 1, TotalTokens: 5}})
+	if err := chat(client, dify.ResponseModeBlocking); err != nil {
+		t.Fatalf("ChatMessage() error = %v", err)
+	}
+
+	if got := testutil.ToFloat64(collector.tokens.WithLabelValues("support", "prompt")); got != 4 {
+		t.Errorf("prompt tokens = %v, want 4", got)
+	}
+	if n := testutil.CollectAndCount(collector, "dify_client_time_to_first_token_seconds"); n != 0 {
+		t.Errorf("time_to_first_token series = %d, want 0 for blocking calls", n)
+	}
+}
+
+func TestCollectorErrors(t *testing.T) {
+	collector, server, client := newTestCollector(t)
+	server.Fail(http.MethodPost, "/chat-messages", difytest.Error{Status: http.StatusTooManyRequests, Code: "too_many_requests"})
+	if err := chat(client, dify.ResponseModeBlocking); err == nil {
+		t.Fatal("ChatMessage() error = nil, want 429")
+	}
+
+	if got := testutil.ToFloat64(collector.errors.WithLabelValues("support", "ChatMessage", "too_many_requests")); got != 1 {
+		t.Errorf("errors_total{code=too_many_requests} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(collector.requests.WithLabelValues("support", "ChatMessage", server.URL, "429")); got != 1 {
+		t.Errorf("requests_total{status=429} = %v, want 1", got)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: &dify.APIError{StatusCode: http.StatusBadRequest, Code: "invalid_param"}, want: "invalid_param"},
+		{err: fmt.Errorf("wrapped: %w", &dify.APIError{StatusCode: http.StatusBadGateway}), want: "http_502"},
+		{err: fmt.Errorf("circuitBreakerErr: %w", dify.ErrCircuitOpen), want: "circuit_open"},
+		{err: context.Canceled, want: "canceled"},
+		{err: fmt.Errorf("rateLimitErr: %w", dify.ErrRateLimitDeadline), want: "deadline_exceeded"},
+		{err: errors.New("unmarshalErr: unexpected EOF"), want: "client_error"},
+	}
+	for _, tt := range tests {
+		if got := errorCode(tt.err); got != tt.want {
+			t.Errorf("errorCode(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// PurgeFilter PurgeConversations 的筛选条件，多个条件同时满足的会话才会删除
+//
+// OlderThan 和 NamePattern 至少设置一个，或显式设置 All 清理全部会话。
+type PurgeFilter struct {
+	ApiKey      string         `validate:"required"`
+	User        string         `validate:"required"` // Dify 按用户列出会话，每次只能清理一个用户
+	OlderThan   time.Duration  // 可选，最后更新时间早于此时长之前的会话
+	NamePattern *regexp.Regexp // 可选，会话名匹配的会话
+	All         bool           // 未设置 OlderThan 和 NamePattern 时必须为 true，表示确实要清理用户的全部会话
+	Concurrency int            // 同时进行的删除数，默认 4
+	DryRun      bool           // 只列出将要删除的会话，不实际删除
+}
+
+// PurgeFailure 删除失败的会话及原因
+type PurgeFailure struct {
+	ConversationId string
+	Reason         string
+	Err            error
+}
+
+// PurgeReport 清理结果
+type PurgeReport struct {
+	DryRun  bool
+	Matched []string       // 符合条件的会话
+	Deleted []string       // 已删除的会话，DryRun 时为空
+	Failed  []PurgeFailure // 删除失败的会话
+}
+
+// PurgeConversations 按用户、时间和会话名清理会话，用于执行数据保留策略
+//
+// 先列出全部符合条件的会话再并发删除，避免删除过程影响翻页。
+// ctx 被取消时不再发起新的删除，已完成的部分记录在返回的报告中。
+func PurgeConversations(ctx context.Context, client ConversationManager, filter PurgeFilter) (report *PurgeReport, err error) {
+	// 校验参数
+	validate := validator.New()
+	validateErr := validate.Struct(filter)
+	if validateErr != nil {
+		err = errors.New(fmt.Sprintf("validateErr: %s", validateErr.Error()))
+		return
+	}
+	// 避免漏填条件时误删用户的全部会话
+	if filter.OlderThan <= 0 && filter.NamePattern == nil && !filter.All {
+		err = errors.New("validateErr: PurgeFilter requires OlderThan, NamePattern or All")
+		return
+	}
+	concurrency := filter.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	report = &PurgeReport{DryRun: filter.DryRun}
+	var cutoff time.Time
+	if filter.OlderThan > 0 {
+		cutoff = time.Now().Add(-filter.OlderThan)
+	}
+
+	// 按更新时间正序列出，遇到不够旧的会话即可停止
+	for conversation, conversationErr := range AllConversations(ctx, client, AllConversationsOption{
+		ApiKey:   filter.ApiKey,
+		User:     filter.User,
+		SortBy:   "updated_at",
+		PageSize: 100,
+	}) {
+		if conversationErr != nil {
+			err = fmt.Errorf("getConversationsErr: %w", conversationErr)
+			return
+		}
+		if !cutoff.IsZero() && !time.Unix(int64(conversation.UpdatedAt), 0).Before(cutoff) {
+			break
+		}
+		if filter.NamePattern != nil && !filter.NamePattern.MatchString(conversation.Name) {
+			continue
+		}
+		report.Matched = append(report.Matched, conversation.Id)
+	}
+	if filter.DryRun {
+		return
+	}
+
+	var mu sync.Mutex
+	var wait sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	for _, conversationId := range report.Matched {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			defer func() {
+				<-semaphore
+			}()
+
+			_, deleteErr := client.DeleteConversation(ctx, DeleteConversationOption{
+				ConversationId: conversationId,
+				ApiKey:         filter.ApiKey,
+				RequestBody: DeleteConversationReq{
+					User: filter.User,
+				},
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			if deleteErr != nil {
+				report.Failed = append(report.Failed, PurgeFailure{
+					ConversationId: conversationId,
+					Reason:         purgeFailureReason(deleteErr),
+					Err:            deleteErr,
+				})
+				return
+			}
+			report.Deleted = append(report.Deleted, conversationId)
+		}()
+	}
+	wait.Wait()
+
+	slices.Sort(report.Deleted)
+	slices.SortFunc(report.Failed, func(a, b PurgeFailure) int {
+		return strings.Compare(a.ConversationId, b.ConversationId)
+	})
+	err = ctx.Err()
+	return
+}
+
+// purgeFailureReason 返回便于阅读的失败原因，Dify 返回的错误使用其错误码
+func purgeFailureReason(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Code != "" {
+			return apiErr.Code
+		}
+		return fmt.Sprintf("http %d", apiErr.StatusCode)
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return "canceled"
+	}
+	return err.Error()
+}
@@ -0,0 +1,156 @@
+package dify_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/mock"
+)
+
+// newPurgeClient 返回按更新时间正序列出 conversations 的 mock，删除 failIds 中的会话时返回 404
+func newPurgeClient(conversations []dify.Conversation, failIds ...string) *mock.Client {
+	return &mock.Client{
+		GetConversationsFunc: func(ctx context.Context, option dify.GetConversationsOption) (*dify.GetConversationsResp, error) {
+			return &dify.GetConversationsResp{Limit: option.RequestParams.Limit, Data: conversations}, nil
+		},
+		DeleteConversationFunc: func(ctx context.Context, option dify.DeleteConversationOption) (*dify.DeleteConversationResp, error) {
+			if slices.Contains(failIds, option.ConversationId) {
+				return nil, &dify.APIError{StatusCode: http.StatusNotFound, Code: "not_found", Message: "Conversation Not Exists."}
+			}
+			return &dify.DeleteConversationResp{Result: "success"}, nil
+		},
+	}
+}
+
+// deletedIds 返回 mock 收到的删除请求中的会话 ID
+func deletedIds(client *mock.Client) []string {
+	var ids []string
+	for _, call := range client.CallsTo(dify.OperationDeleteConversation) {
+		ids = append(ids, call.Option.(dify.DeleteConversationOption).ConversationId)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestPurgeConversations(t *testing.T) {
+	now := time.Now()
+	conversations := []dify.Conversation{
+		{Id: "c1", Name: "测试 1", UpdatedAt: int(now.Add(-72 * time.Hour).Unix())},
+		{Id: "c2", Name: "订单", UpdatedAt: int(now.Add(-48 * time.Hour).Unix())},
+		{Id: "c3", Name: "测试 3", UpdatedAt: int(now.Add(-time.Hour).Unix())},
+	}
+	tests := []struct {
+		name    string
+		filter  dify.PurgeFilter
+		matched string
+		deleted string
+		failed  string
+	}{
+		{name: "older than", filter: dify.PurgeFilter{OlderThan: 24 * time.Hour}, matched: "c1,c2", deleted: "c1,c2"},
+		{name: "name pattern", filter: dify.PurgeFilter{NamePattern: regexp.MustCompile(`^测试`)}, matched: "c1,c3", deleted: "c1,c3"},
+		{name: "both", filter: dify.PurgeFilter{OlderThan: 24 * time.Hour, NamePattern: regexp.MustCompile(`^测试`)}, matched: "c1", deleted: "c1"},
+		{name: "all", filter: dify.PurgeFilter{All: true}, matched: "c1,c2,c3", deleted: "c1,c2,c3"},
+		{name: "dry run", filter: dify.PurgeFilter{All: true, DryRun: true}, matched: "c1,c2,c3"},
+		{name: "failures", filter: dify.PurgeFilter{All: true}, matched: "c1,c2,c3", deleted: "c1,c3", failed: "c2:not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newPurgeClient(conversations, "c2")
+			if tt.failed == "" {
+				client = newPurgeClient(conversations)
+			}
+			tt.filter.ApiKey, tt.filter.User = "app-test", "user-1"
+			report, err := dify.PurgeConversations(context.Background(), client, tt.filter)
+			if err != nil {
+				t.Fatalf("PurgeConversations() error = %v", err)
+			}
+			var failed []string
+			for _, failure := range report.Failed {
+				failed = append(failed, failure.ConversationId+":"+failure.Reason)
+			}
+			if strings.Join(report.Matched, ",") != tt.matched || strings.Join(report.Deleted, ",") != tt.deleted || strings.Join(failed, ",") != tt.failed {
+				t.Errorf("report = %+v", report)
+			}
+			if report.DryRun != tt.filter.DryRun {
+				t.Errorf("DryRun = %v", report.DryRun)
+			}
+			if tt.filter.DryRun && len(client.CallsTo(dify.OperationDeleteConversation)) != 0 {
+				t.Error("dry run deleted conversations")
+			}
+		})
+	}
+}
+
+func TestPurgeConversationsRequiresCriteria(t *testing.T) {
+	client := newPurgeClient([]dify.Conversation{{Id: "c1"}})
+	_, err := dify.PurgeConversations(context.Background(), client, dify.PurgeFilter{ApiKey: "app-test", User: "user-1"})
+	if err == nil || !strings.HasPrefix(err.Error(), "validateErr") {
+		t.Errorf("PurgeConversations() error = %v, want validateErr", err)
+	}
+	if calls := client.Calls(); len(calls) != 0 {
+		t.Errorf("calls = %+v, want none", calls)
+	}
+}
+
+func TestPurgeConversationsConcurrency(t *testing.T) {
+	var conversations []dify.Conversation
+	for i := range 12 {
+		conversations = append(conversations, dify.Conversation{Id: fmt.Sprintf("c%02d", i)})
+	}
+	client := newPurgeClient(conversations)
+	var inFlight, maxInFlight atomic.Int32
+	client.DeleteConversationFunc = func(ctx context.Context, option dify.DeleteConversationOption) (*dify.DeleteConversationResp, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			current := maxInFlight.Load()
+			if n <= current || maxInFlight.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return &dify.DeleteConversationResp{Result: "success"}, nil
+	}
+
+	report, err := dify.PurgeConversations(context.Background(), client, dify.PurgeFilter{ApiKey: "app-test", User: "user-1", All: true, Concurrency: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Deleted) != 12 || !slices.IsSorted(report.Deleted) {
+		t.Errorf("Deleted = %v", report.Deleted)
+	}
+	if got := maxInFlight.Load(); got > 3 || got < 2 {
+		t.Errorf("max concurrent deletes = %d, want 2..3", got)
+	}
+}
+
+func TestPurgeConversationsCancelled(t *testing.T) {
+	var conversations []dify.Conversation
+	for i := range 10 {
+		conversations = append(conversations, dify.Conversation{Id: fmt.Sprintf("c%d", i)})
+	}
+	client := newPurgeClient(conversations)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.DeleteConversationFunc = func(ctx context.Context, option dify.DeleteConversationOption) (*dify.DeleteConversationResp, error) {
+		cancel()
+		return &dify.DeleteConversationResp{Result: "success"}, nil
+	}
+
+	report, err := dify.PurgeConversations(ctx, client, dify.PurgeFilter{ApiKey: "app-test", User: "user-1", All: true, Concurrency: 1})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("PurgeConversations() error = %v, want context.Canceled", err)
+	}
+	if len(report.Matched) != 10 || len(report.Deleted) != 1 || len(deletedIds(client)) != 1 {
+		t.Errorf("report = %+v, deletes = %v", report, deletedIds(client))
+	}
+}
@@ -0,0 +1,222 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit 一类请求的限流配置
+type RateLimit struct {
+	RequestsPerSecond float64 // 每秒允许发起的请求数，0 表示不限速
+	Burst             int     // 令牌桶容量，默认为 1
+	MaxInFlight       int     // 同时进行中的请求上限，0 表示不限制；流式请求在响应读完或关闭前都计入
+}
+
+// RateLimitRule 单个密钥的限流规则，流式与阻塞请求分别计算
+type RateLimitRule struct {
+	Blocking  RateLimit
+	Streaming RateLimit
+}
+
+// RateLimitConfig 客户端限流配置
+type RateLimitConfig struct {
+	Default   RateLimitRule            // 未单独配置的密钥使用的规则
+	PerApiKey map[string]RateLimitRule // 按密钥单独配置的规则
+	OnWait    func(info RateLimitWait) // 可选，每次限流等待结束后回调，可用于打日志或上报指标
+}
+
+// RateLimitWait 一次限流等待的信息
+type RateLimitWait struct {
+	ApiKey    string        // 本次请求使用的密钥
+	ApiPath   string        // 请求路径
+	Streaming bool          // 是否为流式请求
+	Wait      time.Duration // 在令牌桶和并发上限上等待的总时长
+	Err       error         // 等待失败的原因，如 ctx 被取消或截止时间不足
+}
+
+var ErrRateLimitDeadline = errors.New("rate limit wait exceeds context deadline")
+
+type rateLimiter struct {
+	config RateLimitConfig
+	mu     sync.Mutex
+	states map[rateLimitKey]*rateLimitState
+}
+
+type rateLimitKey struct {
+	apiKey    string
+	streaming bool
+}
+
+type rateLimitState struct {
+	bucket   *tokenBucket
+	inFlight chan struct{}
+}
+
+func newRateLimiter(config *RateLimitConfig) *rateLimiter {
+	if config == nil {
+		return nil
+	}
+	return &rateLimiter{
+		config: *config,
+		states: make(map[rateLimitKey]*rateLimitState),
+	}
+}
+
+func (l *rateLimiter) state(apiKey string, streaming bool) *rateLimitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := rateLimitKey{apiKey: apiKey, streaming: streaming}
+	if state, ok := l.states[key]; ok {
+		return state
+	}
+
+	rule, ok := l.config.PerApiKey[apiKey]
+	if !ok {
+		rule = l.config.Default
+	}
+	limit := rule.Blocking
+	if streaming {
+		limit = rule.Streaming
+	}
+
+	state := &rateLimitState{}
+	if limit.RequestsPerSecond > 0 {
+		state.bucket = newTokenBucket(limit.RequestsPerSecond, limit.Burst)
+	}
+	if limit.MaxInFlight > 0 {
+		state.inFlight = make(chan struct{}, limit.MaxInFlight)
+	}
+	l.states[key] = state
+	return state
+}
+
+// wait 阻塞直到可以发起请求，返回的 release 必须在请求结束后调用
+func (l *rateLimiter) wait(ctx context.Context, apiKey string, apiPath string, streaming bool) (release func(), err error) {
+	release = func() {}
+	if l == nil {
+		return
+	}
+
+	state := l.state(apiKey, streaming)
+	start := time.Now()
+	defer func() {
+		if l.config.OnWait != nil {
+			l.config.OnWait(RateLimitWait{
+				ApiKey:    apiKey,
+				ApiPath:   apiPath,
+				Streaming: streaming,
+				Wait:      time.Since(start),
+				Err:       err,
+			})
+		}
+	}()
+
+	if state.bucket != nil {
+		if err = state.bucket.wait(ctx); err != nil {
+			return
+		}
+	}
+
+	if state.inFlight != nil {
+		select {
+		case state.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+		var once sync.Once
+		release = func() {
+			once.Do(func() { <-state.inFlight })
+		}
+	}
+	return
+}
+
+// tokenBucket 令牌桶，tokens 可以为负数表示已被预订的令牌
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve 预订一个令牌，返回需要等待的时长
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel 归还预订的令牌
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+	b.mu.Unlock()
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	now := time.Now()
+	delay := b.reserve(now)
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		b.cancel()
+		return fmt.Errorf("%w: need to wait %s", ErrRateLimitDeadline, delay)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// releaseOnCloseBody 响应体读完或关闭时释放并发名额
+type releaseOnCloseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseOnCloseBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return
+}
+
+func (b *releaseOnCloseBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,138 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	start := time.Now()
+	bucket := newTokenBucket(10, 2)
+	bucket.last = start
+
+	tests := []struct {
+		name string
+		at   time.Duration
+		want time.Duration
+	}{
+		{name: "first token from burst", at: 0, want: 0},
+		{name: "second token from burst", at: 0, want: 0},
+		{name: "empty bucket waits one interval", at: 0, want: 100 * time.Millisecond},
+		{name: "reserved tokens queue up", at: 0, want: 200 * time.Millisecond},
+		{name: "refill pays back reservations", at: 300 * time.Millisecond, want: 0},
+		{name: "refill is capped at burst", at: time.Hour, want: 0},
+		{name: "second token after long idle", at: time.Hour, want: 0},
+		{name: "third token after long idle", at: time.Hour, want: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := bucket.reserve(start.Add(tt.at)); got.Round(time.Millisecond) != tt.want {
+			t.Errorf("%s: reserve() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTokenBucketDeadline(t *testing.T) {
+	bucket := newTokenBucket(1, 1)
+	if err := bucket.wait(context.Background()); err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+
+	// 截止时间不足以等到令牌时立即返回，并归还预订的令牌
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := bucket.wait(ctx); !errors.Is(err, ErrRateLimitDeadline) {
+		t.Fatalf("wait() error = %v, want ErrRateLimitDeadline", err)
+	}
+	if delay := bucket.reserve(time.Now()); delay > time.Second {
+		t.Errorf("reserve() after cancelled wait = %s, want at most 1s", delay)
+	}
+}
+
+func TestRateLimiterRules(t *testing.T) {
+	var waits []RateLimitWait
+	limiter := newRateLimiter(&RateLimitConfig{
+		Default: RateLimitRule{
+			Blocking: RateLimit{MaxInFlight: 1},
+		},
+		PerApiKey: map[string]RateLimitRule{
+			"app-vip": {Blocking: RateLimit{MaxInFlight: 2}},
+		},
+		OnWait: func(info RateLimitWait) {
+			waits = append(waits, info)
+		},
+	})
+
+	tests := []struct {
+		name      string
+		apiKey    string
+		streaming bool
+		want      int // 不阻塞时可以同时持有的名额
+	}{
+		{name: "default rule", apiKey: "app-a", want: 1},
+		{name: "per key rule", apiKey: "app-vip", want: 2},
+		{name: "streaming is unlimited", apiKey: "app-a", streaming: true, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < tt.want; i++ {
+				if _, err := limiter.wait(context.Background(), tt.apiKey, "/chat-messages", tt.streaming); err != nil {
+					t.Fatalf("wait() #%d error = %v", i, err)
+				}
+			}
+			if tt.want >= 3 {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			if _, err := limiter.wait(ctx, tt.apiKey, "/chat-messages", tt.streaming); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("wait() over the cap error = %v, want DeadlineExceeded", err)
+			}
+		})
+	}
+
+	last := waits[len(waits)-1]
+	if last.ApiKey != "app-a" || !last.Streaming || last.ApiPath != "/chat-messages" || last.Err != nil {
+		t.Errorf("last OnWait = %+v", last)
+	}
+}
+
+func TestRateLimiterInFlightReleasedOnBodyClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"result":"success"}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithConfig(ClientConfig{
+		ApiBaseUrl: server.URL,
+		HttpClient: server.Client(),
+		RateLimit: &RateLimitConfig{
+			Default: RateLimitRule{Blocking: RateLimit{MaxInFlight: 1}},
+		},
+	}).(*Client)
+
+	// 响应体未关闭时名额一直被占用
+	response, err := client.request(context.Background(), requestOption{Method: http.MethodGet, ApiPath: "/info", ApiKey: "app-a"})
+	if err != nil {
+		t.Fatalf("request() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.request(ctx, requestOption{Method: http.MethodGet, ApiPath: "/info", ApiKey: "app-a"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second request() error = %v, want DeadlineExceeded", err)
+	}
+
+	_ = response.Body.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		_, err := client.StopTask(ctx, StopTaskOption{ApiKey: "app-a", TaskId: "task-1", RequestBody: StopTaskReq{User: "user-1"}})
+		if err != nil {
+			t.Fatalf("StopTask() #%d error = %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// RelayOption 将流式回答转发给浏览器的配置
+type RelayOption struct {
+	Filter      func(ev ChatMessageRespSSEData) bool                   // 可选，返回 false 的事件不转发，如隐藏 node_started 等内部节点事件
+	Rewrite     func(ev ChatMessageRespSSEData) ChatMessageRespSSEData // 可选，转发前改写事件字段
+	HideTaskId  bool                                                   // 不向浏览器暴露任务 ID，停止任务由服务端完成
+	Heartbeat   time.Duration                                          // 心跳间隔，默认 15 秒，小于 0 时不发送
+	StopTimeout time.Duration                                          // 浏览器断开后 StopTask 的超时，默认 5 秒
+	OnStop      func(resp *StopTaskResp, err error)                    // 可选，报告断开后停止任务的结果
+}
+
+// RelayChatMessageStream 以 text/event-stream 格式将 stream 的事件写入 w，每个事件写入后立即刷新
+//
+// 事件格式与 Dify 一致（data: {json}），心跳为 SSE 注释行，浏览器 EventSource 会忽略。
+// 浏览器断开时关闭与 Dify 的连接，并在回答未结束时调用 StopTask。
+// 上游出错时先写入一个 error 事件再返回错误；浏览器断开时返回 r.Context().Err()。
+func RelayChatMessageStream(w http.ResponseWriter, r *http.Request, stream *ChatMessageStream, option RelayOption) error {
+	defer stream.Close()
+
+	heartbeat := option.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = 15 * time.Second
+	}
+
+	controller := http.NewResponseController(w)
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if flushErr := controller.Flush(); flushErr != nil {
+		return fmt.Errorf("flushErr: %w", flushErr)
+	}
+
+	var ticker <-chan time.Time
+	if heartbeat > 0 {
+		t := time.NewTicker(heartbeat)
+		defer t.Stop()
+		ticker = t.C
+	}
+
+	// Recv 会阻塞，在后台读取事件，以便同时处理心跳和浏览器断开
+	received := make(chan relayReceived)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			ev, recvErr := stream.Recv()
+			select {
+			case received <- relayReceived{ev: ev, err: recvErr}:
+			case <-stop:
+				return
+			}
+			if recvErr != nil {
+				return
+			}
+		}
+	}()
+
+	var progress streamProgress
+	for {
+		select {
+		case <-r.Context().Done():
+			stream.Close()
+			if !progress.finished && progress.taskId != "" {
+				relayStop(r.Context(), stream, option)
+			}
+			return r.Context().Err()
+
+		case <-ticker:
+			if _, writeErr := fmt.Fprint(w, ": ping\n\n"); writeErr != nil {
+				return fmt.Errorf("writeErr: %w", writeErr)
+			}
+			if flushErr := controller.Flush(); flushErr != nil {
+				return fmt.Errorf("flushErr: %w", flushErr)
+			}
+
+		case item := <-received:
+			if errors.Is(item.err, io.EOF) {
+				return nil
+			}
+			if item.err != nil {
+				if r.Context().Err() == nil {
+					_ = writeRelayError(w, item.err)
+					_ = controller.Flush()
+				}
+				return item.err
+			}
+			ev := item.ev
+			progress.event(ev)
+
+			if option.Filter != nil && !option.Filter(ev) {
+				continue
+			}
+			if option.Rewrite != nil {
+				ev = option.Rewrite(ev)
+			}
+			if option.HideTaskId {
+				ev.TaskId = ""
+			}
+			data, marshalErr := json.Marshal(newRelayEvent(ev))
+			if marshalErr != nil {
+				return fmt.Errorf("marshalErr: %w", marshalErr)
+			}
+			if _, writeErr := fmt.Fprintf(w, "data: %s\n\n", data); writeErr != nil {
+				return fmt.Errorf("writeErr: %w", writeErr)
+			}
+			if flushErr := controller.Flush(); flushErr != nil {
+				return fmt.Errorf("flushErr: %w", flushErr)
+			}
+		}
+	}
+}
+
+// relayReceived 后台读取到的一个事件或流结束的原因
+type relayReceived struct {
+	ev  ChatMessageRespSSEData
+	err error
+}
+
+// relayEvent 转发给浏览器的事件，与 Dify 一致，只在事件携带时输出 metadata 和 data
+type relayEvent struct {
+	ChatMessageRespSSEData
+	Metadata *ChatMessageMetadata `json:"metadata,omitempty"`
+	Data     *WorkflowEventData   `json:"data,omitempty"`
+}
+
+func newRelayEvent(ev ChatMessageRespSSEData) relayEvent {
+	wire := relayEvent{ChatMessageRespSSEData: ev}
+	if ev.Event == "message_end" || !reflect.ValueOf(ev.Metadata).IsZero() {
+		wire.Metadata = &ev.Metadata
+	}
+	if !reflect.ValueOf(ev.Data).IsZero() {
+		wire.Data = &ev.Data
+	}
+	return wire
+}
+
+// NewRelayHandler 返回转发流式回答的 http.Handler，open 根据请求发起流，
+// 通常使用 NewChatMessageStream(r.Context(), client, option)
+func NewRelayHandler(open func(r *http.Request) (*ChatMessageStream, error), option RelayOption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream, openErr := open(r)
+		if openErr != nil {
+			statusCode := http.StatusBadRequest
+			var apiErr *APIError
+			if errors.As(openErr, &apiErr) {
+				statusCode = apiErr.StatusCode
+			}
+			http.Error(w, openErr.Error(), statusCode)
+			return
+		}
+		relayErr := RelayChatMessageStream(w, r, stream, option)
+		if relayErr != nil && r.Context().Err() == nil {
+			fmt.Printf("relayErr: %s\n", relayErr.Error())
+		}
+	})
+}
+
+// relayStop 浏览器断开后停止 Dify 端的生成
+func relayStop(ctx context.Context, stream *ChatMessageStream, option RelayOption) {
+	timeout := option.StopTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	resp, stopErr := stream.Stop(stopCtx)
+	if option.OnStop != nil {
+		option.OnStop(resp, stopErr)
+	}
+}
+
+// writeRelayError 写入 error 事件，APIError 保留 Dify 的状态码和错误码
+func writeRelayError(w http.ResponseWriter, err error) error {
+	ev := struct {
+		Event   string `json:"event"`
+		Status  int    `json:"status"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{
+		Event:   "error",
+		Status:  http.StatusInternalServerError,
+		Message: err.Error(),
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		ev.Status = apiErr.StatusCode
+		ev.Code = apiErr.Code
+		if apiErr.Message != "" {
+			ev.Message = apiErr.Message
+		}
+	}
+	data, _ := json.Marshal(ev)
+	_, writeErr := fmt.Fprintf(w, "data: %s\n\n", data)
+	return writeErr
+}
@@ -0,0 +1,180 @@
+package dify_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+	"github.com/Davied-H/dify-go/mock"
+)
+
+// newRelayServer 启动转发服务，每个请求以 query 参数 q 向 difytest 发起流式对话
+func newRelayServer(t *testing.T, client dify.ClientI, option dify.RelayOption) *httptest.Server {
+	t.Helper()
+	relay := httptest.NewServer(dify.NewRelayHandler(func(r *http.Request) (*dify.ChatMessageStream, error) {
+		return dify.NewChatMessageStream(r.Context(), client, streamOption(r.URL.Query().Get("q"))), nil
+	}, option))
+	t.Cleanup(relay.Close)
+	return relay
+}
+
+// readRelay 读取转发的 data 行，每行解析为 JSON 对象
+func readRelay(t *testing.T, body *bufio.Reader, n int) []map[string]json.RawMessage {
+	t.Helper()
+	var events []map[string]json.RawMessage
+	for len(events) < n {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read relay after %d events: %v", len(events), err)
+		}
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok {
+			continue
+		}
+		var ev map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestRelay(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Enqueue(difytest.Reply{Chunks: []string{"a", "b"}, Usage: dify.Usage{TotalTokens: 3}})
+	relay := newRelayServer(t, client, dify.RelayOption{
+		HideTaskId: true,
+		Filter: func(ev dify.ChatMessageRespSSEData) bool {
+			return ev.Answer != "b"
+		},
+	})
+
+	response, err := http.Get(relay.URL + "?q=hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Content-Type = %q", response.Header.Get("Content-Type"))
+	}
+
+	events := readRelay(t, bufio.NewReader(response.Body), 2)
+	message, end := events[0], events[1]
+	if string(message["event"]) != `"message"` || string(message["answer"]) != `"a"` {
+		t.Errorf("first event = %v", message)
+	}
+	// 非 message_end 事件不携带空的 metadata 和 data
+	for _, key := range []string{"metadata", "data"} {
+		if _, ok := message[key]; ok {
+			t.Errorf("message event has %s: %s", key, message[key])
+		}
+	}
+	if string(end["event"]) != `"message_end"` || !strings.Contains(string(end["metadata"]), `"total_tokens":3`) {
+		t.Errorf("message_end = %v", end)
+	}
+	if string(message["task_id"]) != `""` {
+		t.Errorf("task_id = %s, want hidden", message["task_id"])
+	}
+}
+
+func TestRelayWorkflowEvents(t *testing.T) {
+	client := &mock.Client{ChatMessageFunc: mock.Events(nil,
+		dify.ChatMessageRespSSEData{Event: "node_started", Data: dify.WorkflowEventData{Title: "检索", NodeType: "knowledge-retrieval"}},
+		dify.ChatMessageRespSSEData{Event: "message", Answer: "a"},
+		dify.ChatMessageRespSSEData{Event: "message_end"},
+	)}
+	relay := newRelayServer(t, client, dify.RelayOption{})
+
+	response, err := http.Get(relay.URL + "?q=hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	events := readRelay(t, bufio.NewReader(response.Body), 3)
+	node, message, end := events[0], events[1], events[2]
+	if !strings.Contains(string(node["data"]), `"title":"检索"`) {
+		t.Errorf("node_started data = %s", node["data"])
+	}
+	if _, ok := node["metadata"]; ok {
+		t.Errorf("node_started has metadata: %s", node["metadata"])
+	}
+	if _, ok := message["data"]; ok {
+		t.Errorf("message has data: %s", message["data"])
+	}
+	// message_end 即使用量为空也保留 metadata，与 Dify 的格式一致
+	if _, ok := end["metadata"]; !ok {
+		t.Errorf("message_end = %v, want metadata", end)
+	}
+}
+
+func TestRelayUpstreamError(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Fail(http.MethodPost, "/chat-messages", difytest.Error{Status: http.StatusTooManyRequests, Code: "too_many_requests", Message: "slow down"})
+	relay := newRelayServer(t, client, dify.RelayOption{})
+
+	response, err := http.Get(relay.URL + "?q=hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	ev := readRelay(t, bufio.NewReader(response.Body), 1)[0]
+	if string(ev["event"]) != `"error"` || string(ev["status"]) != "429" || string(ev["code"]) != `"too_many_requests"` || string(ev["message"]) != `"slow down"` {
+		t.Errorf("error event = %v", ev)
+	}
+}
+
+func TestRelayStopsTaskWhenBrowserDisconnects(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Enqueue(difytest.Reply{Chunks: []string{"a", "b", "c"}, Delay: 50 * time.Millisecond})
+	stopped := make(chan error, 1)
+	relay := newRelayServer(t, client, dify.RelayOption{
+		OnStop: func(resp *dify.StopTaskResp, err error) {
+			stopped <- err
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, relay.URL+"?q=hi", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	readRelay(t, bufio.NewReader(response.Body), 1)
+	cancel()
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("StopTask error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not stopped after the browser disconnected")
+	}
+	var stops int
+	for _, request := range server.Requests() {
+		if strings.HasSuffix(request.Path, "/stop") {
+			stops++
+		}
+	}
+	if stops != 1 {
+		t.Errorf("stop requests = %d, want 1", stops)
+	}
+}
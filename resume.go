@@ -0,0 +1,148 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrStreamInterrupted = errors.New("stream interrupted before message_end")
+
+// ResumeOption 流式连接中断后找回完整回答
+//
+// 连接在 message_end 之前断开时，Dify 端通常仍会完成生成。客户端轮询 GetMessages，
+// 找到本条消息且回答不再变化后，以合成事件补发缺失的部分：已输出内容是最终回答的前缀时补发
+// message 事件，否则补发 message_replace 事件，最后补发 message_end 事件。
+// 合成事件的 Synthetic 为 true。会话历史不返回用量，补发的 message_end 不携带用量：
+// 找回的消息以 UsageSourceResumed 和空的 Usage 记录到 UsageRecorder，BudgetPolicy 也不会扣减其额度；
+// 断流前已收到 workflow_finished 时仍记录其中的 token 数。
+type ResumeOption struct {
+	Interval time.Duration // 轮询间隔，默认 1 秒
+	Timeout  time.Duration // 最长等待时间，默认 60 秒
+}
+
+// resume 轮询会话历史，返回补齐回答所需的合成事件
+func (c *Client) resume(ctx context.Context, option *ChatMessageOption, progress *streamProgress) (events []ChatMessageRespSSEData, err error) {
+	if progress.conversationId == "" || progress.messageId == "" {
+		err = fmt.Errorf("%w: message id has not been received", ErrStreamInterrupted)
+		return
+	}
+
+	interval := option.Resume.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	timeout := option.Resume.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Dify 在生成结束后才写入回答，连续两次取得相同的非空回答视为已完成
+	var answer string
+	var lastErr error
+	found := false
+	for {
+		resp, getMessagesErr := c.GetMessages(ctx, GetMessagesOption{
+			ApiKey: option.ApiKey,
+			RequestParams: GetMessagesReq{
+				ConversationId: progress.conversationId,
+				User:           option.RequestBody.User,
+			},
+		})
+		lastErr = getMessagesErr
+		if getMessagesErr == nil {
+			for _, message := range resp.Data {
+				if message.Id != progress.messageId {
+					continue
+				}
+				if found && message.Answer != "" && message.Answer == answer {
+					return progress.complete(answer, message.RetrieverResources), nil
+				}
+				found = true
+				answer = message.Answer
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			err = fmt.Errorf("%w: resumeErr: %w", ErrStreamInterrupted, lastErr)
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// streamProgress 记录流式回答的进度，用于判断取消时是否需要停止任务，以及断流后补齐回答
+type streamProgress struct {
+	taskId         string
+	conversationId string
+	messageId      string
+	createdAt      int
+	answer         strings.Builder
+	finished       bool
+}
+
+func (p *streamProgress) event(ev ChatMessageRespSSEData) {
+	if p.taskId == "" {
+		p.taskId = ev.TaskId
+	}
+	if p.conversationId == "" {
+		p.conversationId = ev.ConversationId
+	}
+	if p.messageId == "" {
+		p.messageId = ev.MessageId
+	}
+	if p.createdAt == 0 {
+		p.createdAt = ev.CreatedAt
+	}
+	switch ev.Event {
+	case "message", "agent_message":
+		p.answer.WriteString(ev.Answer)
+	case "message_replace":
+		p.answer.Reset()
+		p.answer.WriteString(ev.Answer)
+	case "message_end", "error":
+		// 对话流应用在 workflow_finished 之后还会发送 message_end，此时回答仍可能未完整送达
+		p.finished = true
+	}
+}
+
+// complete 返回从已输出内容补齐到最终回答的合成事件
+func (p *streamProgress) complete(answer string, resources []RetrieverResource) []ChatMessageRespSSEData {
+	base := ChatMessageRespSSEData{
+		ConversationId: p.conversationId,
+		MessageId:      p.messageId,
+		CreatedAt:      p.createdAt,
+		TaskId:         p.taskId,
+		Id:             p.messageId,
+		Synthetic:      true,
+	}
+
+	var events []ChatMessageRespSSEData
+	delivered := p.answer.String()
+	if suffix, ok := strings.CutPrefix(answer, delivered); ok {
+		if suffix != "" {
+			ev := base
+			ev.Event = "message"
+			ev.Answer = suffix
+			events = append(events, ev)
+		}
+	} else {
+		ev := base
+		ev.Event = "message_replace"
+		ev.Answer = answer
+		events = append(events, ev)
+	}
+
+	end := base
+	end.Event = "message_end"
+	end.Metadata.RetrieverResources = resources
+	return append(events, end)
+}
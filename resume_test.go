@@ -0,0 +1,178 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newResumeServer 返回一个发送 events 后直接结束流的服务，会话历史中消息 m1 的回答为 answer
+func newResumeServer(t *testing.T, events []ChatMessageRespSSEData, answer string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var historyRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chat-messages":
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, ev := range events {
+				ev.TaskId, ev.ConversationId, ev.MessageId = "t1", "c1", "m1"
+				data, _ := json.Marshal(ev)
+				_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+			}
+		case "/messages":
+			historyRequests.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"data":[{"id":"m1","conversation_id":"c1","answer":%q}]}`, answer)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &historyRequests
+}
+
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []ChatMessageRespSSEData
+		answer  string
+		want    string
+		history bool
+	}{
+		{
+			name:    "missing suffix",
+			events:  []ChatMessageRespSSEData{{Event: "message", Answer: "ab"}},
+			answer:  "abcd",
+			want:    "message:ab,message:cd*,message_end:*",
+			history: true,
+		},
+		{
+			name:    "rewritten answer",
+			events:  []ChatMessageRespSSEData{{Event: "message", Answer: "ab"}},
+			answer:  "xyz",
+			want:    "message:ab,message_replace:xyz*,message_end:*",
+			history: true,
+		},
+		{
+			name:    "workflow finished without message_end",
+			events:  []ChatMessageRespSSEData{{Event: "workflow_started"}, {Event: "message", Answer: "ab"}, {Event: "workflow_finished"}},
+			answer:  "abc",
+			want:    "workflow_started:,message:ab,workflow_finished:,message:c*,message_end:*",
+			history: true,
+		},
+		{
+			name:   "message_end",
+			events: []ChatMessageRespSSEData{{Event: "message", Answer: "ab"}, {Event: "message_end"}},
+			answer: "abc",
+			want:   "message:ab,message_end:",
+		},
+		{
+			name:   "error event",
+			events: []ChatMessageRespSSEData{{Event: "message", Answer: "ab"}, {Event: "error"}},
+			answer: "abc",
+			want:   "message:ab,error:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, historyRequests := newResumeServer(t, tt.events, tt.answer)
+			client := NewClient(server.URL)
+
+			var got []string
+			_, err := client.ChatMessage(context.Background(), ChatMessageOption{
+				ApiKey: "app-test",
+				OnEvent: func(ev ChatMessageRespSSEData) {
+					name := ev.Event + ":" + ev.Answer
+					if ev.Synthetic {
+						name += "*"
+					}
+					got = append(got, name)
+				},
+				Resume:      &ResumeOption{Interval: time.Millisecond},
+				RequestBody: ChatMessageReq{Query: "hi", ResponseMode: ResponseModeStreaming, User: "user-1"},
+			})
+			if err != nil {
+				t.Fatalf("ChatMessage() error = %v", err)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("events = %s, want %s", strings.Join(got, ","), tt.want)
+			}
+			if requested := historyRequests.Load() > 0; requested != tt.history {
+				t.Errorf("history requested = %v, want %v", requested, tt.history)
+			}
+		})
+	}
+}
+
+// usageRecords 记录收到的用量
+type usageRecords struct {
+	mu      sync.Mutex
+	records []UsageRecord
+}
+
+func (r *usageRecords) RecordUsage(_ context.Context, record UsageRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+	return nil
+}
+
+func TestResumeUsage(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []ChatMessageRespSSEData
+		source string
+	}{
+		{name: "message", events: []ChatMessageRespSSEData{{Event: "message", Answer: "ab"}}, source: UsageSourceResumed},
+		{name: "workflow finished", events: []ChatMessageRespSSEData{{Event: "message", Answer: "ab"}, {Event: "workflow_finished"}}, source: UsageSourceWorkflowFinished},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newResumeServer(t, tt.events, "abc")
+			recorder := &usageRecords{}
+			client := NewClient(server.URL, WithUsageRecorder(recorder))
+
+			_, err := client.ChatMessage(context.Background(), ChatMessageOption{
+				ApiKey:      "app-test",
+				OnEvent:     func(ChatMessageRespSSEData) {},
+				Resume:      &ResumeOption{Interval: time.Millisecond},
+				RequestBody: ChatMessageReq{Query: "hi", ResponseMode: ResponseModeStreaming, User: "user-1"},
+			})
+			if err != nil {
+				t.Fatalf("ChatMessage() error = %v", err)
+			}
+			// 找回的回答也要让用量记录器看到，每条消息只记录一次
+			if len(recorder.records) != 1 {
+				t.Fatalf("records = %+v, want 1", recorder.records)
+			}
+			record := recorder.records[0]
+			if record.Source != tt.source || record.MessageId != "m1" || record.ConversationId != "c1" || record.User != "user-1" {
+				t.Errorf("record = %+v, want source %s", record, tt.source)
+			}
+		})
+	}
+}
+
+func TestResumeTimeout(t *testing.T) {
+	// 会话历史中的回答一直为空，视为尚未生成完毕
+	server, _ := newResumeServer(t, []ChatMessageRespSSEData{{Event: "message", Answer: "ab"}}, "")
+	client := NewClient(server.URL)
+
+	_, err := client.ChatMessage(context.Background(), ChatMessageOption{
+		ApiKey:      "app-test",
+		OnEvent:     func(ChatMessageRespSSEData) {},
+		Resume:      &ResumeOption{Interval: time.Millisecond, Timeout: 20 * time.Millisecond},
+		RequestBody: ChatMessageReq{Query: "hi", ResponseMode: ResponseModeStreaming, User: "user-1"},
+	})
+	if !errors.Is(err, ErrStreamInterrupted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ChatMessage() error = %v, want ErrStreamInterrupted after the deadline", err)
+	}
+}
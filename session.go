@@ -0,0 +1,227 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrNoConversation = errors.New("session has no conversation yet")
+
+// SendOption Session.Send 的可选参数
+type SendOption struct {
+	Inputs   map[string]interface{}          // App 定义的各变量值
+	OnEvent  func(ev ChatMessageRespSSEData) // 设置后使用流式模式，Send 仍返回汇总后的完整回答
+	AutoStop *AutoStopOption                 // 仅流式模式
+	Resume   *ResumeOption                   // 仅流式模式
+}
+
+// Session 一个用户在一个应用中的连续会话，自动在多轮对话间传递 ConversationId
+//
+// 同一 Session 的 Send 依次执行，进行中时可以调用 Stop 停止当前回答。
+//
+//	session := dify.NewSession(client, os.Getenv("DIFY_API_KEY"), "user_id")
+//	resp, err := session.Send(ctx, "你好", dify.SendOption{})
+//	resp, err = session.Send(ctx, "继续", dify.SendOption{})
+type Session struct {
+	client ClientI
+	apiKey string
+	user   string
+
+	sendMu sync.Mutex // 保证多轮对话依次进行
+
+	mu             sync.Mutex
+	conversationId string
+	messageId      string
+	taskId         string
+
+	store  SessionStore  // 可选，由 NewStoredSession 设置
+	record SessionRecord // 写回 store 的记录，由 mu 保护
+}
+
+func NewSession(client ClientI, apiKey string, user string) *Session {
+	return &Session{
+		client: client,
+		apiKey: apiKey,
+		user:   user,
+	}
+}
+
+// Send 发送一轮对话，首轮对话创建会话，之后的对话继续该会话
+func (s *Session) Send(ctx context.Context, query string, option SendOption) (*ChatMessageResp, error) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	chatMessageOption := ChatMessageOption{
+		ApiKey: s.apiKey,
+		RequestBody: ChatMessageReq{
+			Inputs:         option.Inputs,
+			Query:          query,
+			ResponseMode:   ResponseModeBlocking,
+			ConversationId: s.ConversationId(),
+			User:           s.user,
+		},
+	}
+	if option.OnEvent == nil {
+		resp, err := s.client.ChatMessage(ctx, chatMessageOption)
+		if err != nil {
+			return nil, err
+		}
+		s.update(resp.ConversationId, resp.MessageId, resp.TaskId)
+		s.save(ctx, "")
+		return resp, nil
+	}
+
+	// 流式模式下收到首个事件即记录任务 ID，使 Stop 可以停止进行中的回答
+	acc := NewAccumulator()
+	chatMessageOption.RequestBody.ResponseMode = ResponseModeStreaming
+	chatMessageOption.AutoStop = option.AutoStop
+	chatMessageOption.Resume = option.Resume
+	chatMessageOption.OnEvent = acc.Wrap(func(ev ChatMessageRespSSEData) {
+		s.update(ev.ConversationId, ev.MessageId, ev.TaskId)
+		option.OnEvent(ev)
+	})
+	_, err := s.client.ChatMessage(ctx, chatMessageOption)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.save(ctx, "")
+	return acc.Result(), nil
+}
+
+// save 将会话写回 store，title 为空时保留原标题；写入失败不影响对话结果
+func (s *Session) save(ctx context.Context, title string) {
+	if s.store == nil {
+		return
+	}
+	s.mu.Lock()
+	s.record.ConversationId = s.conversationId
+	s.record.LastActiveAt = time.Now()
+	if title != "" {
+		s.record.Title = title
+	}
+	record := s.record
+	s.mu.Unlock()
+
+	putErr := s.store.Put(context.WithoutCancel(ctx), record)
+	if putErr != nil {
+		fmt.Printf("sessionStorePutErr: %s\n", putErr.Error())
+	}
+}
+
+// Record 返回会话的存储记录，仅 NewStoredSession 创建的会话有值
+func (s *Session) Record() SessionRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.record
+}
+
+// update 记录最新一轮对话的 ID，空值不覆盖
+func (s *Session) update(conversationId string, messageId string, taskId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if conversationId != "" {
+		s.conversationId = conversationId
+	}
+	if messageId != "" {
+		s.messageId = messageId
+	}
+	if taskId != "" {
+		s.taskId = taskId
+	}
+}
+
+// ConversationId 返回会话 ID，首轮对话前为空
+func (s *Session) ConversationId() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conversationId
+}
+
+// LastMessageId 返回最近一轮对话的消息 ID
+func (s *Session) LastMessageId() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messageId
+}
+
+// LastTaskId 返回最近一轮对话的任务 ID
+func (s *Session) LastTaskId() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.taskId
+}
+
+// Stop 停止最近一轮对话的回答
+func (s *Session) Stop(ctx context.Context) (*StopTaskResp, error) {
+	taskId := s.LastTaskId()
+	if taskId == "" {
+		return nil, errors.New("task id has not been received yet")
+	}
+	return s.client.StopTask(ctx, StopTaskOption{
+		ApiKey: s.apiKey,
+		TaskId: taskId,
+		RequestBody: StopTaskReq{
+			User: s.user,
+		},
+	})
+}
+
+// Suggested 获取最近一轮对话的建议问题
+func (s *Session) Suggested(ctx context.Context) (*GetSuggestedResp, error) {
+	messageId := s.LastMessageId()
+	if messageId == "" {
+		return nil, ErrNoConversation
+	}
+	return s.client.GetSuggested(ctx, GetSuggestedOption{
+		ApiKey:    s.apiKey,
+		MessageId: messageId,
+		RequestParams: GetSuggestedReq{
+			User: s.user,
+		},
+	})
+}
+
+// History 获取会话历史消息，firstId 为空时返回最近的 limit 条
+func (s *Session) History(ctx context.Context, firstId string, limit int) (*GetMessagesResp, error) {
+	conversationId := s.ConversationId()
+	if conversationId == "" {
+		return nil, ErrNoConversation
+	}
+	return s.client.GetMessages(ctx, GetMessagesOption{
+		ApiKey: s.apiKey,
+		RequestParams: GetMessagesReq{
+			ConversationId: conversationId,
+			User:           s.user,
+			FirstId:        firstId,
+			Limit:          limit,
+		},
+	})
+}
+
+// Rename 重命名会话，name 为空时由 Dify 自动生成标题
+func (s *Session) Rename(ctx context.Context, name string) (*ConversationRenameResp, error) {
+	conversationId := s.ConversationId()
+	if conversationId == "" {
+		return nil, ErrNoConversation
+	}
+	resp, err := s.client.ConversationRename(ctx, ConversationRenameOption{
+		ConversationId: conversationId,
+		ApiKey:         s.apiKey,
+		RequestBody: ConversationRenameReq{
+			Name:         name,
+			AutoGenerate: name == "",
+			User:         s.user,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.save(ctx, resp.Name)
+	return resp, nil
+}
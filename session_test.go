@@ -0,0 +1,156 @@
+package dify_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+func TestSessionThreadsConversation(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Enqueue(difytest.Reply{Answer: "一", Suggested: []string{"然后呢"}}, difytest.Reply{Answer: "二", Suggested: []string{"还有吗"}})
+	session := dify.NewSession(client, "app-test", "user-1")
+
+	first, err := session.Send(context.Background(), "first", dify.SendOption{Inputs: map[string]interface{}{"k": "v"}})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	second, err := session.Send(context.Background(), "second", dify.SendOption{})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if first.ConversationId == "" || second.ConversationId != first.ConversationId || session.ConversationId() != first.ConversationId {
+		t.Errorf("conversations = %s, %s, session %s", first.ConversationId, second.ConversationId, session.ConversationId())
+	}
+	if session.LastMessageId() != second.MessageId || session.LastTaskId() != second.TaskId {
+		t.Errorf("last ids = %s %s, want %s %s", session.LastMessageId(), session.LastTaskId(), second.MessageId, second.TaskId)
+	}
+
+	suggested, err := session.Suggested(context.Background())
+	if err != nil || len(suggested.Data) != 1 || suggested.Data[0] != "还有吗" {
+		t.Errorf("Suggested() = %+v, %v", suggested, err)
+	}
+	history, err := session.History(context.Background(), "", 20)
+	if err != nil || len(history.Data) != 2 || history.Data[0].Answer != "一" || history.Data[1].Answer != "二" {
+		t.Errorf("History() = %+v, %v", history, err)
+	}
+	renamed, err := session.Rename(context.Background(), "")
+	if err != nil || renamed.Name != "first" {
+		t.Errorf("Rename() = %+v, %v", renamed, err)
+	}
+	if conversations := server.Conversations("user-1"); len(conversations) != 1 || conversations[0].Name != "first" {
+		t.Errorf("server conversations = %+v", conversations)
+	}
+}
+
+func TestSessionStreaming(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Enqueue(difytest.Reply{Chunks: []string{"a", "b", "c", "d"}, Delay: 20 * time.Millisecond})
+	session := dify.NewSession(client, "app-test", "user-1")
+
+	// 首个片段到达后即可停止进行中的回答
+	var stopped *dify.StopTaskResp
+	var stopErr error
+	resp, err := session.Send(context.Background(), "hi", dify.SendOption{
+		OnEvent: func(ev dify.ChatMessageRespSSEData) {
+			if ev.Event == "message" && stopped == nil && stopErr == nil {
+				stopped, stopErr = session.Stop(context.Background())
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if stopErr != nil || stopped.Result != "success" {
+		t.Errorf("Stop() = %+v, %v", stopped, stopErr)
+	}
+	if resp.Answer == "" || len(resp.Answer) >= 4 || resp.ConversationId != session.ConversationId() {
+		t.Errorf("Send() = %+v, want a partial answer", resp)
+	}
+	request := server.AssertRequested(t, http.MethodPost, "/chat-messages/"+session.LastTaskId()+"/stop")
+	var body dify.StopTaskReq
+	if err := request.JSON(&body); err != nil || body.User != "user-1" {
+		t.Errorf("stop body = %+v, %v", body, err)
+	}
+}
+
+func TestSessionWithoutConversation(t *testing.T) {
+	server, client := newTestClient(t)
+	session := dify.NewSession(client, "app-test", "user-1")
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "Suggested", call: func() error { _, err := session.Suggested(context.Background()); return err }},
+		{name: "History", call: func() error { _, err := session.History(context.Background(), "", 20); return err }},
+		{name: "Rename", call: func() error { _, err := session.Rename(context.Background(), "x"); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, dify.ErrNoConversation) {
+				t.Errorf("%s() error = %v, want ErrNoConversation", tt.name, err)
+			}
+		})
+	}
+	if _, err := session.Stop(context.Background()); err == nil {
+		t.Error("Stop() error = nil before any task")
+	}
+	if requests := server.Requests(); len(requests) != 0 {
+		t.Errorf("requests = %+v, want none", requests)
+	}
+}
+
+func TestSessionSendFailureKeepsConversation(t *testing.T) {
+	server, client := newTestClient(t)
+	session := dify.NewSession(client, "app-test", "user-1")
+	first, err := session.Send(context.Background(), "first", dify.SendOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Enqueue(difytest.Reply{Error: &difytest.Error{Status: http.StatusBadRequest, Code: "invalid_param", Message: "bad"}})
+	if _, err := session.Send(context.Background(), "second", dify.SendOption{}); err == nil {
+		t.Fatal("Send() error = nil, want invalid_param")
+	}
+	if session.ConversationId() != first.ConversationId || session.LastMessageId() != first.MessageId {
+		t.Errorf("session ids changed after a failed send: %s %s", session.ConversationId(), session.LastMessageId())
+	}
+}
+
+func TestSessionConcurrentSends(t *testing.T) {
+	server, client := newTestClient(t)
+	session := dify.NewSession(client, "app-test", "user-1")
+
+	var wg sync.WaitGroup
+	for i := range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := session.Send(context.Background(), fmt.Sprintf("q%d", i), dify.SendOption{}); err != nil {
+				t.Errorf("Send() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 各轮依次执行，全部落在同一会话中
+	conversations := server.Conversations("user-1")
+	if len(conversations) != 1 {
+		t.Fatalf("conversations = %d, want 1", len(conversations))
+	}
+	var queries []string
+	for _, message := range server.Messages(conversations[0].Id) {
+		queries = append(queries, message.Query)
+	}
+	if len(queries) != 5 {
+		t.Errorf("messages = %v", queries)
+	}
+}
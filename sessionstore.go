@@ -0,0 +1,227 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionRecord 业务会话线程与 Dify 会话的对应关系
+type SessionRecord struct {
+	ThreadId       string    `json:"thread_id"` // 业务侧的会话线程 ID
+	App            string    `json:"app"`       // 应用名
+	User           string    `json:"user"`
+	ConversationId string    `json:"conversation_id"` // 首轮对话前为空
+	Title          string    `json:"title"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastActiveAt   time.Time `json:"last_active_at"`
+}
+
+// expired 判断记录在 ttl 内是否未活跃，ttl 为 0 表示不过期
+func (r SessionRecord) expired(ttl time.Duration, now time.Time) bool {
+	return ttl > 0 && now.Sub(r.LastActiveAt) > ttl
+}
+
+// SessionStore 保存会话线程与 Dify 会话的对应关系，使 Session 可以在重启后或其他节点上恢复
+type SessionStore interface {
+	// Get 返回线程的记录，不存在或已过期时返回 ErrSessionNotFound
+	Get(ctx context.Context, threadId string) (SessionRecord, error)
+	// Put 保存记录，已存在时覆盖
+	Put(ctx context.Context, record SessionRecord) error
+	Delete(ctx context.Context, threadId string) error
+}
+
+// NewStoredSession 恢复 record.ThreadId 对应的会话，不存在或已过期时新建
+//
+// record 需要提供 ThreadId、App 和 User，Title 可选；之后每轮对话和重命名都会写回 store。
+// 已存在的线程属于其他用户或其他应用时返回错误，避免在错误的应用下继续该会话。
+func NewStoredSession(ctx context.Context, client ClientI, store SessionStore, apiKey string, record SessionRecord) (*Session, error) {
+	stored, getErr := store.Get(ctx, record.ThreadId)
+	switch {
+	case getErr == nil:
+		if stored.User != record.User {
+			return nil, fmt.Errorf("thread %s belongs to another user", record.ThreadId)
+		}
+		if stored.App != record.App {
+			return nil, fmt.Errorf("thread %s belongs to another app", record.ThreadId)
+		}
+		record = stored
+	case errors.Is(getErr, ErrSessionNotFound):
+		now := time.Now()
+		record.ConversationId = ""
+		record.CreatedAt = now
+		record.LastActiveAt = now
+	default:
+		return nil, fmt.Errorf("sessionStoreGetErr: %w", getErr)
+	}
+
+	session := NewSession(client, apiKey, record.User)
+	session.conversationId = record.ConversationId
+	session.store = store
+	session.record = record
+	return session, nil
+}
+
+// MemorySessionStore 进程内的会话存储，适用于单实例部署和测试
+type MemorySessionStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	records map[string]SessionRecord
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+// NewMemorySessionStore ttl 为会话最后活跃后的保留时间，0 表示不过期
+func NewMemorySessionStore(ttl time.Duration) *MemorySessionStore {
+	return &MemorySessionStore{
+		ttl:     ttl,
+		records: make(map[string]SessionRecord),
+	}
+}
+
+func (s *MemorySessionStore) Get(_ context.Context, threadId string) (SessionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[threadId]
+	if !ok || record.expired(s.ttl, time.Now()) {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+	return record, nil
+}
+
+func (s *MemorySessionStore) Put(_ context.Context, record SessionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for threadId, stored := range s.records {
+		if stored.expired(s.ttl, now) {
+			delete(s.records, threadId)
+		}
+	}
+	s.records[record.ThreadId] = record
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(_ context.Context, threadId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, threadId)
+	return nil
+}
+
+// FileSessionStore 将会话保存到一个 JSON 文件，适用于单实例部署，重启后可以恢复
+//
+// 每次写入都会重写整个文件（先写临时文件再重命名），不适合大量会话或多个进程共享同一文件。
+type FileSessionStore struct {
+	path string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	records map[string]SessionRecord // 首次访问时从文件加载
+}
+
+var _ SessionStore = (*FileSessionStore)(nil)
+
+// NewFileSessionStore ttl 为会话最后活跃后的保留时间，0 表示不过期
+func NewFileSessionStore(path string, ttl time.Duration) *FileSessionStore {
+	return &FileSessionStore{
+		path: path,
+		ttl:  ttl,
+	}
+}
+
+// load 加载文件，调用方需持有锁
+func (s *FileSessionStore) load() error {
+	if s.records != nil {
+		return nil
+	}
+	records := make(map[string]SessionRecord)
+	data, readErr := os.ReadFile(s.path)
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return fmt.Errorf("readFileErr: %w", readErr)
+	}
+	if len(data) > 0 {
+		if unmarshalErr := json.Unmarshal(data, &records); unmarshalErr != nil {
+			return fmt.Errorf("unmarshalErr: %w", unmarshalErr)
+		}
+	}
+	s.records = records
+	return nil
+}
+
+// save 清理过期记录并写入文件，调用方需持有锁
+func (s *FileSessionStore) save() error {
+	now := time.Now()
+	for threadId, record := range s.records {
+		if record.expired(s.ttl, now) {
+			delete(s.records, threadId)
+		}
+	}
+	data, marshalErr := json.MarshalIndent(s.records, "", "  ")
+	if marshalErr != nil {
+		return fmt.Errorf("marshalErr: %w", marshalErr)
+	}
+
+	tmp, createErr := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if createErr != nil {
+		return fmt.Errorf("createTempErr: %w", createErr)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, writeErr := tmp.Write(data); writeErr != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writeErr: %w", writeErr)
+	}
+	if closeErr := tmp.Close(); closeErr != nil {
+		return fmt.Errorf("closeErr: %w", closeErr)
+	}
+	if renameErr := os.Rename(tmp.Name(), s.path); renameErr != nil {
+		return fmt.Errorf("renameErr: %w", renameErr)
+	}
+	return nil
+}
+
+func (s *FileSessionStore) Get(_ context.Context, threadId string) (SessionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loadErr := s.load(); loadErr != nil {
+		return SessionRecord{}, loadErr
+	}
+	record, ok := s.records[threadId]
+	if !ok || record.expired(s.ttl, time.Now()) {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+	return record, nil
+}
+
+func (s *FileSessionStore) Put(_ context.Context, record SessionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loadErr := s.load(); loadErr != nil {
+		return loadErr
+	}
+	s.records[record.ThreadId] = record
+	return s.save()
+}
+
+func (s *FileSessionStore) Delete(_ context.Context, threadId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loadErr := s.load(); loadErr != nil {
+		return loadErr
+	}
+	if _, ok := s.records[threadId]; !ok {
+		return nil
+	}
+	delete(s.records, threadId)
+	return s.save()
+}
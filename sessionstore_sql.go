@@ -0,0 +1,127 @@
+package dify
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLSessionStoreOption SQLSessionStore 配置
+type SQLSessionStoreOption struct {
+	Table       string           // 表名，默认 dify_sessions，需为可信的常量
+	Placeholder func(int) string // 第 n 个参数的占位符（从 1 开始），默认 ?，PostgreSQL 使用 PostgresPlaceholder
+	TTL         time.Duration    // 会话最后活跃后的保留时间，0 表示不过期
+}
+
+// SQLSessionStore 将会话保存到 database/sql 数据库，多个节点共享
+type SQLSessionStore struct {
+	db          *sql.DB
+	table       string
+	placeholder func(int) string
+	ttl         time.Duration
+}
+
+var _ SessionStore = (*SQLSessionStore)(nil)
+
+func NewSQLSessionStore(db *sql.DB, option SQLSessionStoreOption) *SQLSessionStore {
+	store := &SQLSessionStore{
+		db:          db,
+		table:       option.Table,
+		placeholder: option.Placeholder,
+		ttl:         option.TTL,
+	}
+	if store.table == "" {
+		store.table = "dify_sessions"
+	}
+	if store.placeholder == nil {
+		store.placeholder = func(int) string { return "?" }
+	}
+	return store
+}
+
+// CreateTable 创建会话表，已存在时不做处理
+func (s *SQLSessionStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	thread_id VARCHAR(255) NOT NULL PRIMARY KEY,
+	app VARCHAR(255) NOT NULL,
+	user_id VARCHAR(255) NOT NULL,
+	conversation_id VARCHAR(64) NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	last_active_at TIMESTAMP NOT NULL
+)`, s.table))
+	return err
+}
+
+func (s *SQLSessionStore) Get(ctx context.Context, threadId string) (record SessionRecord, err error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT thread_id, app, user_id, conversation_id, title, created_at, last_active_at FROM %s WHERE thread_id = %s",
+		s.table, s.placeholder(1)), threadId)
+	scanErr := row.Scan(&record.ThreadId, &record.App, &record.User, &record.ConversationId, &record.Title, &record.CreatedAt, &record.LastActiveAt)
+	if errors.Is(scanErr, sql.ErrNoRows) {
+		err = ErrSessionNotFound
+		return
+	}
+	if scanErr != nil {
+		err = fmt.Errorf("scanErr: %w", scanErr)
+		return
+	}
+	if record.expired(s.ttl, time.Now()) {
+		record = SessionRecord{}
+		err = ErrSessionNotFound
+	}
+	return
+}
+
+// Put 先更新，记录不存在时再插入
+func (s *SQLSessionStore) Put(ctx context.Context, record SessionRecord) error {
+	result, updateErr := s.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET app = %s, user_id = %s, conversation_id = %s, title = %s, created_at = %s, last_active_at = %s WHERE thread_id = %s",
+		s.table, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4), s.placeholder(5), s.placeholder(6), s.placeholder(7)),
+		record.App, record.User, record.ConversationId, record.Title, record.CreatedAt, record.LastActiveAt, record.ThreadId)
+	if updateErr != nil {
+		return fmt.Errorf("updateErr: %w", updateErr)
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return nil
+	}
+
+	columns := []string{"thread_id", "app", "user_id", "conversation_id", "title", "created_at", "last_active_at"}
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		placeholders[i] = s.placeholder(i + 1)
+	}
+	_, insertErr := s.db.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", s.table, strings.Join(columns, ", "), strings.Join(placeholders, ", ")),
+		record.ThreadId, record.App, record.User, record.ConversationId, record.Title, record.CreatedAt, record.LastActiveAt)
+	if insertErr != nil {
+		// MySQL 在值未变化时 UPDATE 的影响行数为 0，此时记录已存在，插入会主键冲突
+		var exists int
+		row := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE thread_id = %s", s.table, s.placeholder(1)), record.ThreadId)
+		if row.Scan(&exists) == nil && exists > 0 {
+			return nil
+		}
+		return fmt.Errorf("insertErr: %w", insertErr)
+	}
+	return nil
+}
+
+func (s *SQLSessionStore) Delete(ctx context.Context, threadId string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE thread_id = %s", s.table, s.placeholder(1)), threadId)
+	return err
+}
+
+// DeleteExpired 删除过期的会话，返回删除的条数，TTL 为 0 时不做处理
+func (s *SQLSessionStore) DeleteExpired(ctx context.Context) (int64, error) {
+	if s.ttl <= 0 {
+		return 0, nil
+	}
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE last_active_at < %s", s.table, s.placeholder(1)), time.Now().Add(-s.ttl))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,125 @@
+package dify_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+func TestSessionStores(t *testing.T) {
+	stores := []struct {
+		name string
+		new  func(t *testing.T, ttl time.Duration) dify.SessionStore
+	}{
+		{name: "memory", new: func(t *testing.T, ttl time.Duration) dify.SessionStore {
+			return dify.NewMemorySessionStore(ttl)
+		}},
+		{name: "file", new: func(t *testing.T, ttl time.Duration) dify.SessionStore {
+			return dify.NewFileSessionStore(filepath.Join(t.TempDir(), "sessions.json"), ttl)
+		}},
+	}
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.new(t, time.Hour)
+			if _, err := store.Get(ctx, "t1"); !errors.Is(err, dify.ErrSessionNotFound) {
+				t.Fatalf("Get() missing error = %v, want ErrSessionNotFound", err)
+			}
+
+			record := dify.SessionRecord{ThreadId: "t1", App: "app", User: "user-1", CreatedAt: now, LastActiveAt: now}
+			if err := store.Put(ctx, record); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			record.ConversationId, record.Title = "c1", "标题"
+			if err := store.Put(ctx, record); err != nil {
+				t.Fatalf("Put() overwrite error = %v", err)
+			}
+			got, err := store.Get(ctx, "t1")
+			if err != nil || got.ConversationId != "c1" || got.Title != "标题" || got.User != "user-1" || !got.LastActiveAt.Equal(now) {
+				t.Errorf("Get() = %+v, %v", got, err)
+			}
+
+			// 超过 ttl 未活跃的记录视为不存在
+			stale := dify.SessionRecord{ThreadId: "t2", User: "user-1", CreatedAt: now.Add(-3 * time.Hour), LastActiveAt: now.Add(-2 * time.Hour)}
+			if err := store.Put(ctx, stale); err != nil {
+				t.Fatalf("Put() stale error = %v", err)
+			}
+			if _, err := store.Get(ctx, "t2"); !errors.Is(err, dify.ErrSessionNotFound) {
+				t.Errorf("Get() expired error = %v, want ErrSessionNotFound", err)
+			}
+
+			if err := store.Delete(ctx, "t1"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if _, err := store.Get(ctx, "t1"); !errors.Is(err, dify.ErrSessionNotFound) {
+				t.Errorf("Get() deleted error = %v, want ErrSessionNotFound", err)
+			}
+		})
+	}
+}
+
+func TestFileSessionStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	record := dify.SessionRecord{ThreadId: "t1", User: "user-1", ConversationId: "c1", LastActiveAt: time.Now()}
+	if err := dify.NewFileSessionStore(path, 0).Put(context.Background(), record); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := dify.NewFileSessionStore(path, 0).Get(context.Background(), "t1")
+	if err != nil || got.ConversationId != "c1" {
+		t.Errorf("Get() after reload = %+v, %v", got, err)
+	}
+}
+
+func TestStoredSession(t *testing.T) {
+	server, client := newTestClient(t)
+	store := dify.NewMemorySessionStore(0)
+	ctx := context.Background()
+	record := dify.SessionRecord{ThreadId: "thread-1", App: "support", User: "user-1"}
+
+	session, err := dify.NewStoredSession(ctx, client, store, "app-test", record)
+	if err != nil {
+		t.Fatalf("NewStoredSession() error = %v", err)
+	}
+	first, err := session.Send(ctx, "first", dify.SendOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Rename(ctx, "售后"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 在另一个节点上按线程 ID 恢复，继续同一会话
+	restored, err := dify.NewStoredSession(ctx, client, store, "app-test", record)
+	if err != nil {
+		t.Fatalf("NewStoredSession() restore error = %v", err)
+	}
+	if restored.ConversationId() != first.ConversationId || restored.Record().Title != "售后" || restored.Record().App != "support" {
+		t.Errorf("restored session = %s %+v", restored.ConversationId(), restored.Record())
+	}
+	if _, err := restored.Send(ctx, "second", dify.SendOption{}); err != nil {
+		t.Fatal(err)
+	}
+	if messages := server.Messages(first.ConversationId); len(messages) != 2 {
+		t.Errorf("messages = %d, want 2 in one conversation", len(messages))
+	}
+
+	// 线程属于其他用户或其他应用时不能复用其会话
+	tests := []struct {
+		name   string
+		record dify.SessionRecord
+	}{
+		{name: "another user", record: dify.SessionRecord{ThreadId: "thread-1", App: "support", User: "user-2"}},
+		{name: "another app", record: dify.SessionRecord{ThreadId: "thread-1", App: "sales", User: "user-1"}},
+	}
+	for _, tt := range tests {
+		if _, err := dify.NewStoredSession(ctx, client, store, "app-test", tt.record); err == nil {
+			t.Errorf("NewStoredSession() for %s error = nil", tt.name)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Package sqltest 使用纯 Go 的 SQLite 驱动测试核心包中基于 database/sql 的存储
+//
+// 独立成模块，避免核心包为测试引入数据库驱动和 cgo 依赖。
+package sqltest
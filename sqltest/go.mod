@@ -0,0 +1,35 @@
+module github.com/Davied-H/dify-go/sqltest
+
+go 1.24
+
+// 与核心包在同一仓库中开发
+replace github.com/Davied-H/dify-go => ../
+
+require (
+	github.com/Davied-H/dify-go v0.0.0-00010101000000-000000000000
+	modernc.org/sqlite v1.38.2
+)
+
+require (
+	github.com/duke-git/lancet/v2 v2.3.5 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/gabriel-vasile/mimetype v1.4.8 // indirect
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/go-playground/validator/v10 v10.26.0 // indirect
+	github.com/google/go-querystring v1.1.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/leodido/go-urn v1.4.0 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	github.com/tmaxmax/go-sse v0.10.0 // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
+	golang.org/x/net v0.34.0 // indirect
+	golang.org/x/sys v0.34.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	modernc.org/libc v1.66.3 // indirect
+	modernc.org/mathutil v1.7.1 // indirect
+	modernc.org/memory v1.11.0 // indirect
+)
@@ -0,0 +1,75 @@
+package sqltest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+func newSQLSessionStore(t *testing.T, ttl time.Duration) *dify.SQLSessionStore {
+	t.Helper()
+	store := dify.NewSQLSessionStore(openDB(t, "sessions.db"), dify.SQLSessionStoreOption{TTL: ttl})
+	if err := store.CreateTable(context.Background()); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	return store
+}
+
+func TestSQLSessionStore(t *testing.T) {
+	store := newSQLSessionStore(t, time.Hour)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	if _, err := store.Get(ctx, "t1"); !errors.Is(err, dify.ErrSessionNotFound) {
+		t.Fatalf("Get() missing error = %v, want ErrSessionNotFound", err)
+	}
+
+	record := dify.SessionRecord{ThreadId: "t1", App: "app", User: "user-1", CreatedAt: now, LastActiveAt: now}
+	if err := store.Put(ctx, record); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	record.ConversationId, record.Title = "c1", "标题"
+	if err := store.Put(ctx, record); err != nil {
+		t.Fatalf("Put() overwrite error = %v", err)
+	}
+	got, err := store.Get(ctx, "t1")
+	if err != nil || got.ConversationId != "c1" || got.Title != "标题" || got.App != "app" || got.User != "user-1" || !got.LastActiveAt.Equal(now) {
+		t.Errorf("Get() = %+v, %v", got, err)
+	}
+
+	// 超过 ttl 未活跃的记录视为不存在
+	stale := dify.SessionRecord{ThreadId: "t2", User: "user-1", CreatedAt: now.Add(-3 * time.Hour), LastActiveAt: now.Add(-2 * time.Hour)}
+	if err := store.Put(ctx, stale); err != nil {
+		t.Fatalf("Put() stale error = %v", err)
+	}
+	if _, err := store.Get(ctx, "t2"); !errors.Is(err, dify.ErrSessionNotFound) {
+		t.Errorf("Get() expired error = %v, want ErrSessionNotFound", err)
+	}
+
+	if err := store.Delete(ctx, "t1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "t1"); !errors.Is(err, dify.ErrSessionNotFound) {
+		t.Errorf("Get() deleted error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSQLSessionStoreDeleteExpired(t *testing.T) {
+	store := newSQLSessionStore(t, time.Hour)
+	ctx := context.Background()
+	for threadId, lastActiveAt := range map[string]time.Time{"fresh": time.Now(), "stale": time.Now().Add(-2 * time.Hour)} {
+		if err := store.Put(ctx, dify.SessionRecord{ThreadId: threadId, LastActiveAt: lastActiveAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := store.DeleteExpired(ctx)
+	if err != nil || deleted != 1 {
+		t.Errorf("DeleteExpired() = %d, %v, want 1", deleted, err)
+	}
+	if _, err := store.Get(ctx, "fresh"); err != nil {
+		t.Errorf("Get(fresh) error = %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package sqltest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+)
+
+func TestSQLUsageRecorder(t *testing.T) {
+	db := openDB(t, "usage.db")
+	ctx := context.Background()
+	recorder := dify.NewSQLUsageRecorder(db, dify.SQLUsageRecorderOption{})
+	if err := recorder.CreateTable(ctx); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := recorder.CreateTable(ctx); err != nil {
+		t.Fatalf("CreateTable() again error = %v", err)
+	}
+
+	now := time.Now()
+	for _, record := range []dify.UsageRecord{
+		{App: "support", User: "user-1", ConversationId: "c1", Usage: dify.Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4, TotalPrice: "0.25", Currency: "USD"}},
+		{App: "support", User: "user-1", ConversationId: "c2", Usage: dify.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7, TotalPrice: "1.5", Currency: "RMB"}},
+		{App: "support", User: "user-2", ConversationId: "c3", Usage: dify.Usage{TotalTokens: 9}},
+		{App: "sales", User: "user-1", ConversationId: "c4", Usage: dify.Usage{TotalTokens: 100}},
+	} {
+		record.CreatedAt = now
+		if err := recorder.RecordUsage(ctx, record); err != nil {
+			t.Fatalf("RecordUsage() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   dify.UsageKey
+		messages int
+		tokens   int
+		price    map[string]float64
+	}{
+		{name: "by app and user", filter: dify.UsageKey{App: "support", User: "user-1"}, messages: 2, tokens: 11, price: map[string]float64{"USD": 0.25, "RMB": 1.5}},
+		{name: "by conversation", filter: dify.UsageKey{ConversationId: "c3"}, messages: 1, tokens: 9},
+		{name: "by user across apps", filter: dify.UsageKey{User: "user-1"}, messages: 3, tokens: 111, price: map[string]float64{"USD": 0.25, "RMB": 1.5}},
+		{name: "everything", messages: 4, tokens: 120, price: map[string]float64{"USD": 0.25, "RMB": 1.5}},
+		{name: "no match", filter: dify.UsageKey{App: "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum, err := recorder.Sum(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("Sum() error = %v", err)
+			}
+			if sum.Messages != tt.messages || sum.TotalTokens != tt.tokens || len(sum.TotalPrice) != len(tt.price) {
+				t.Fatalf("Sum() = %+v", sum)
+			}
+			for currency, price := range tt.price {
+				if sum.TotalPrice[currency] != price {
+					t.Errorf("TotalPrice[%s] = %v, want %v", currency, sum.TotalPrice[currency], price)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ChatMessageStream 以拉取方式读取流式 ChatMessage 的事件
+//
+//	stream := dify.NewChatMessageStream(ctx, client, option)
+//	defer stream.Close()
+//	for {
+//		ev, err := stream.Recv()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+type ChatMessageStream struct {
+	client ClientI
+	option ChatMessageOption
+	events chan ChatMessageRespSSEData
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	mu     sync.Mutex
+	taskId string
+}
+
+// NewChatMessageStream 在后台发起流式 ChatMessage，ResponseMode 固定为 streaming
+//
+// option.OnEvent 不为空时，每个事件先交给 OnEvent 再交给 Recv。
+// 调用方不读取事件时后台会阻塞，从而对上游形成背压。
+func NewChatMessageStream(ctx context.Context, client ClientI, option ChatMessageOption) *ChatMessageStream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &ChatMessageStream{
+		client: client,
+		option: option,
+		events: make(chan ChatMessageRespSSEData),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	onEvent := option.OnEvent
+	option.RequestBody.ResponseMode = ResponseModeStreaming
+	option.OnEvent = func(ev ChatMessageRespSSEData) {
+		s.mu.Lock()
+		if s.taskId == "" {
+			s.taskId = ev.TaskId
+		}
+		s.mu.Unlock()
+
+		if onEvent != nil {
+			onEvent(ev)
+		}
+		select {
+		case s.events <- ev:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer close(s.done)
+		defer close(s.events)
+		_, chatMessageErr := client.ChatMessage(ctx, option)
+		if chatMessageErr == nil {
+			chatMessageErr = ctx.Err()
+		}
+		s.err = chatMessageErr
+	}()
+	return s
+}
+
+// Recv 返回下一个事件，流正常结束时返回 io.EOF
+func (s *ChatMessageStream) Recv() (ChatMessageRespSSEData, error) {
+	ev, ok := <-s.events
+	if ok {
+		return ev, nil
+	}
+	if s.err != nil {
+		return ChatMessageRespSSEData{}, s.err
+	}
+	return ChatMessageRespSSEData{}, io.EOF
+}
+
+// Done 在流结束后关闭
+func (s *ChatMessageStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 返回流结束的原因，正常结束或未结束时为 nil
+func (s *ChatMessageStream) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close 关闭与 Dify 的连接；option.AutoStop 为空时不会停止 Dify 端的生成，需要时调用 Stop
+func (s *ChatMessageStream) Close() {
+	s.cancel()
+	<-s.done
+}
+
+// TaskId 返回从事件中取得的任务 ID，尚未收到事件时为空
+func (s *ChatMessageStream) TaskId() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.taskId
+}
+
+// Option 返回发起流时的参数
+func (s *ChatMessageStream) Option() ChatMessageOption {
+	return s.option
+}
+
+// Stop 使用相同的用户标识调用 StopTask 停止 Dify 端的生成
+func (s *ChatMessageStream) Stop(ctx context.Context) (*StopTaskResp, error) {
+	taskId := s.TaskId()
+	if taskId == "" {
+		return nil, errors.New("task id has not been received yet")
+	}
+	return s.client.StopTask(ctx, StopTaskOption{
+		ApiKey: s.option.ApiKey,
+		TaskId: taskId,
+		RequestBody: StopTaskReq{
+			User: s.option.RequestBody.User,
+		},
+	})
+}
@@ -0,0 +1,215 @@
+package dify_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+func streamOption(query string) dify.ChatMessageOption {
+	return dify.ChatMessageOption{
+		ApiKey:      "app-test",
+		RequestBody: dify.ChatMessageReq{Query: query, User: "user-1"},
+	}
+}
+
+// recvAll 读取流的全部事件，返回事件名和结束时的错误
+func recvAll(stream *dify.ChatMessageStream) (string, error) {
+	var names []string
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			return strings.Join(names, ","), err
+		}
+		names = append(names, ev.Event+":"+ev.Answer)
+	}
+}
+
+func TestChatMessageStream(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Enqueue(difytest.Reply{Chunks: []string{"a", "b"}})
+
+	var seen int
+	option := streamOption("hi")
+	option.OnEvent = func(dify.ChatMessageRespSSEData) { seen++ }
+	stream := dify.NewChatMessageStream(context.Background(), client, option)
+	defer stream.Close()
+
+	names, err := recvAll(stream)
+	if err != io.EOF {
+		t.Fatalf("Recv() error = %v, want io.EOF", err)
+	}
+	if names != "message:a,message:b,message_end:" {
+		t.Errorf("events = %s", names)
+	}
+	if seen != 3 {
+		t.Errorf("OnEvent called %d times, want 3", seen)
+	}
+	if stream.TaskId() == "" || stream.Err() != nil {
+		t.Errorf("TaskId() = %q, Err() = %v", stream.TaskId(), stream.Err())
+	}
+}
+
+func TestChatMessageStreamError(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Fail(http.MethodPost, "/chat-messages", difytest.Error{Status: http.StatusTooManyRequests, Code: "too_many_requests"})
+
+	stream := dify.NewChatMessageStream(context.Background(), client, streamOption("hi"))
+	defer stream.Close()
+	_, err := recvAll(stream)
+	var apiErr *dify.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Recv() error = %v, want 429", err)
+	}
+	if !errors.As(stream.Err(), &apiErr) {
+		t.Errorf("Err() = %v, want the same APIError", stream.Err())
+	}
+}
+
+func TestChatMessageStreamStop(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Enqueue(difytest.Reply{Chunks: []string{"a", "b", "c"}, Delay: 50 * time.Millisecond})
+
+	stream := dify.NewChatMessageStream(context.Background(), client, streamOption("hi"))
+	defer stream.Close()
+	if _, err := stream.Stop(context.Background()); err == nil {
+		t.Error("Stop() before the first event error = nil")
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv() error = %v", err)
+	}
+	if _, err := stream.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	request := server.AssertRequested(t, http.MethodPost, "/chat-messages/"+stream.TaskId()+"/stop")
+	var body dify.StopTaskReq
+	if err := request.JSON(&body); err != nil || body.User != "user-1" {
+		t.Errorf("stop body = %+v, %v", body, err)
+	}
+}
+
+// publish 依次发布名为 e0、e1…的事件
+func publish(b *dify.Broadcaster, n int) {
+	for i := 0; i < n; i++ {
+		b.Publish(dify.ChatMessageRespSSEData{Event: fmt.Sprintf("e%d", i)})
+	}
+}
+
+func collect(sub *dify.Subscription) []string {
+	var names []string
+	for ev := range sub.C {
+		names = append(names, ev.Event)
+	}
+	return names
+}
+
+func TestBroadcasterDrop(t *testing.T) {
+	b := dify.NewBroadcaster()
+	sub := b.Subscribe(dify.SubscribeOption{Buffer: 2, Policy: dify.SlowConsumerDrop})
+	publish(b, 5)
+	b.Close(nil)
+
+	// 最多有一个事件在丢弃前已交给投递协程，其余只保留最新的 Buffer 个
+	names := collect(sub)
+	if len(names)+sub.Dropped() != 5 || sub.Dropped() < 2 {
+		t.Fatalf("received %v, dropped %d", names, sub.Dropped())
+	}
+	if got := strings.Join(names[len(names)-2:], ","); got != "e3,e4" {
+		t.Errorf("latest events = %s, want e3,e4", got)
+	}
+	if sub.Err() != nil {
+		t.Errorf("Err() = %v", sub.Err())
+	}
+}
+
+func TestBroadcasterDisconnect(t *testing.T) {
+	b := dify.NewBroadcaster()
+	slow := b.Subscribe(dify.SubscribeOption{Buffer: 1, Policy: dify.SlowConsumerDisconnect})
+	fast := b.Subscribe(dify.SubscribeOption{Buffer: 16, Policy: dify.SlowConsumerDisconnect})
+	publish(b, 3)
+	b.Close(nil)
+
+	collect(slow)
+	if !errors.Is(slow.Err(), dify.ErrSlowConsumer) {
+		t.Errorf("slow Err() = %v, want ErrSlowConsumer", slow.Err())
+	}
+	if names := collect(fast); len(names) != 3 || fast.Err() != nil {
+		t.Errorf("fast received %v, Err() = %v", names, fast.Err())
+	}
+}
+
+func TestBroadcasterBlock(t *testing.T) {
+	b := dify.NewBroadcaster()
+	sub := b.Subscribe(dify.SubscribeOption{Buffer: 1, Policy: dify.SlowConsumerBlock})
+
+	var published atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 4; i++ {
+			b.Publish(dify.ChatMessageRespSSEData{Event: fmt.Sprintf("e%d", i)})
+			published.Add(1)
+		}
+		b.Close(nil)
+	}()
+
+	// 订阅者不读取时发布方被阻塞
+	time.Sleep(50 * time.Millisecond)
+	if n := published.Load(); n >= 4 {
+		t.Fatalf("published %d events without a reader, want the publisher to block", n)
+	}
+	if got := strings.Join(collect(sub), ","); got != "e0,e1,e2,e3" {
+		t.Errorf("received %s, want every event in order", got)
+	}
+	<-done
+	if sub.Dropped() != 0 {
+		t.Errorf("Dropped() = %d", sub.Dropped())
+	}
+}
+
+func TestBroadcasterLateSubscriberReplays(t *testing.T) {
+	b := dify.NewBroadcaster()
+	publish(b, 5)
+
+	// 回放的历史事件不计入积压，不会被断开
+	late := b.Subscribe(dify.SubscribeOption{Buffer: 1, Policy: dify.SlowConsumerDisconnect})
+	b.Close(errors.New("upstream closed"))
+	if got := strings.Join(collect(late), ","); got != "e0,e1,e2,e3,e4" {
+		t.Errorf("late subscriber received %s", got)
+	}
+	if late.Err() == nil || late.Err().Error() != "upstream closed" {
+		t.Errorf("Err() = %v, want the upstream error", late.Err())
+	}
+}
+
+func TestBroadcasterRun(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Enqueue(difytest.Reply{Chunks: []string{"a", "b"}})
+
+	b := dify.NewBroadcaster()
+	first := b.Subscribe(dify.SubscribeOption{})
+	second := b.Subscribe(dify.SubscribeOption{Policy: dify.SlowConsumerDrop})
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- b.Run(dify.NewChatMessageStream(context.Background(), client, streamOption("hi")))
+	}()
+
+	for _, sub := range []*dify.Subscription{first, second} {
+		if got := strings.Join(collect(sub), ","); got != "message,message,message_end" {
+			t.Errorf("received %s", got)
+		}
+	}
+	if err := <-runErr; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
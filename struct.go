@@ -9,6 +9,8 @@ type ChatMessageOption struct {
 	ApiKey      string `validate:"required"`
 	OnEvent     func(ev ChatMessageRespSSEData)
 	RequestBody ChatMessageReq
+	AutoStop    *AutoStopOption // 可选，流式模式下 ctx 被取消时自动调用 StopTask
+	Resume      *ResumeOption   // 可选，流式连接中断后通过会话历史补齐回答
 }
 type ChatMessageReq struct {
 	Inputs         map[string]interface{} `json:"inputs"`                    // 允许传入 App 定义的各变量值
@@ -16,57 +18,81 @@ type ChatMessageReq struct {
 	ResponseMode   string                 `json:"response_mode"`             // streaming: 流式模式, blocking: 阻塞模式
 	ConversationId string                 `json:"conversation_id"`           // 会话 ID，需要基于之前的聊天记录继续对话
 	User           string                 `json:"user" validate:"required"`  // 用户标识，可用于终止请求等
-	Files          []struct {
-		Type           string `json:"type"`
-		TransferMethod string `json:"transfer_method"`
-		Url            string `json:"url"`
-	} `json:"files"`
+	Files          []ChatMessageFile      `json:"files"`
+}
+type ChatMessageFile struct {
+	Type           string `json:"type"`                     // image、document、audio、video 或 custom
+	TransferMethod string `json:"transfer_method"`          // remote_url: 使用 Url, local_file: 使用 UploadFileId
+	Url            string `json:"url"`                      // 文件地址，仅 remote_url
+	UploadFileId   string `json:"upload_file_id,omitempty"` // UploadFile 返回的文件 ID，仅 local_file
 }
 type ChatMessageResp struct {
-	Event          string `json:"event"`
-	TaskId         string `json:"task_id"`
-	Id             string `json:"id"`
-	MessageId      string `json:"message_id"`
-	ConversationId string `json:"conversation_id"`
-	Mode           string `json:"mode"`
-	Answer         string `json:"answer"`
-	Metadata       struct {
-		Usage struct {
-			PromptTokens        int     `json:"prompt_tokens"`
-			PromptUnitPrice     string  `json:"prompt_unit_price"`
-			PromptPriceUnit     string  `json:"prompt_price_unit"`
-			PromptPrice         string  `json:"prompt_price"`
-			CompletionTokens    int     `json:"completion_tokens"`
-			CompletionUnitPrice string  `json:"completion_unit_price"`
-			CompletionPriceUnit string  `json:"completion_price_unit"`
-			CompletionPrice     string  `json:"completion_price"`
-			TotalTokens         int     `json:"total_tokens"`
-			TotalPrice          string  `json:"total_price"`
-			Currency            string  `json:"currency"`
-			Latency             float64 `json:"latency"`
-		} `json:"usage"`
-		RetrieverResources []struct {
-			Position     int     `json:"position"`
-			DatasetId    string  `json:"dataset_id"`
-			DatasetName  string  `json:"dataset_name"`
-			DocumentId   string  `json:"document_id"`
-			DocumentName string  `json:"document_name"`
-			SegmentId    string  `json:"segment_id"`
-			Score        float64 `json:"score"`
-			Content      string  `json:"content"`
-		} `json:"retriever_resources"`
-	} `json:"metadata"`
-	CreatedAt int `json:"created_at"`
+	Event          string              `json:"event"`
+	TaskId         string              `json:"task_id"`
+	Id             string              `json:"id"`
+	MessageId      string              `json:"message_id"`
+	ConversationId string              `json:"conversation_id"`
+	Mode           string              `json:"mode"`
+	Answer         string              `json:"answer"`
+	Metadata       ChatMessageMetadata `json:"metadata"`
+	CreatedAt      int                 `json:"created_at"`
+}
+type ChatMessageMetadata struct {
+	Usage              Usage               `json:"usage"`
+	RetrieverResources []RetrieverResource `json:"retriever_resources"`
+}
+type Usage struct {
+	PromptTokens        int     `json:"prompt_tokens"`
+	PromptUnitPrice     string  `json:"prompt_unit_price"`
+	PromptPriceUnit     string  `json:"prompt_price_unit"`
+	PromptPrice         string  `json:"prompt_price"`
+	CompletionTokens    int     `json:"completion_tokens"`
+	CompletionUnitPrice string  `json:"completion_unit_price"`
+	CompletionPriceUnit string  `json:"completion_price_unit"`
+	CompletionPrice     string  `json:"completion_price"`
+	TotalTokens         int     `json:"total_tokens"`
+	TotalPrice          string  `json:"total_price"`
+	Currency            string  `json:"currency"`
+	Latency             float64 `json:"latency"`
+}
+type RetrieverResource struct {
+	Position     int     `json:"position"`
+	DatasetId    string  `json:"dataset_id"`
+	DatasetName  string  `json:"dataset_name"`
+	DocumentId   string  `json:"document_id"`
+	DocumentName string  `json:"document_name"`
+	SegmentId    string  `json:"segment_id"`
+	Score        float64 `json:"score"`
+	Content      string  `json:"content"`
 }
 type ChatMessageRespSSEData struct {
-	Event                string   `json:"event"`
-	ConversationId       string   `json:"conversation_id"`
-	MessageId            string   `json:"message_id"`
-	CreatedAt            int      `json:"created_at"`
-	TaskId               string   `json:"task_id"`
-	Id                   string   `json:"id"`
-	Answer               string   `json:"answer"`
-	FromVariableSelector []string `json:"from_variable_selector"`
+	Event                string              `json:"event"`
+	ConversationId       string              `json:"conversation_id"`
+	MessageId            string              `json:"message_id"`
+	CreatedAt            int                 `json:"created_at"`
+	TaskId               string              `json:"task_id"`
+	Id                   string              `json:"id"`
+	Answer               string              `json:"answer"`
+	FromVariableSelector []string            `json:"from_variable_selector"`
+	Metadata             ChatMessageMetadata `json:"metadata"` // message_end 事件携带用量与引用资源
+	Data                 WorkflowEventData   `json:"data"`     // workflow_started、node_started 等工作流事件的详细信息
+	Synthetic            bool                `json:"-"`        // 是否为断流后由客户端补发的事件，见 ResumeOption
+}
+type WorkflowEventData struct {
+	Id          string                 `json:"id"`           // 工作流执行 ID 或节点执行 ID
+	WorkflowId  string                 `json:"workflow_id"`  // 工作流 ID
+	NodeId      string                 `json:"node_id"`      // 节点 ID，仅节点事件
+	NodeType    string                 `json:"node_type"`    // 节点类型，仅节点事件
+	Title       string                 `json:"title"`        // 节点名称，仅节点事件
+	Index       int                    `json:"index"`        // 节点执行序号，仅节点事件
+	Status      string                 `json:"status"`       // running / succeeded / failed / stopped
+	Outputs     map[string]interface{} `json:"outputs"`      // 输出内容
+	Error       string                 `json:"error"`        // 错误原因
+	ElapsedTime float64                `json:"elapsed_time"` // 耗时（秒）
+	TotalTokens int                    `json:"total_tokens"` // 消耗的 token 数，仅 workflow_finished 事件
+	TotalSteps  int                    `json:"total_steps"`  // 总步数，仅 workflow_finished 事件
+	CreatedAt   int                    `json:"created_at"`
+	FinishedAt  int                    `json:"finished_at"`
 }
 
 type UploadFileOption struct {
@@ -132,30 +158,74 @@ type GetMessagesReq struct {
 	Limit          int    `url:"limit"`                               // 一次请求返回多少条聊天记录，默认 20 条
 }
 type GetMessagesResp struct {
-	Limit   int  `json:"limit"`
-	HasMore bool `json:"has_more"`
-	Data    []struct {
-		Id             string `json:"id"`
-		ConversationId string `json:"conversation_id"`
-		Inputs         struct {
-			Name string `json:"name"`
-		} `json:"inputs"`
-		Query              string        `json:"query"`
-		Answer             string        `json:"answer"`
-		MessageFiles       []interface{} `json:"message_files"`
-		Feedback           interface{}   `json:"feedback"`
-		RetrieverResources []struct {
-			Position     int     `json:"position"`
-			DatasetId    string  `json:"dataset_id"`
-			DatasetName  string  `json:"dataset_name"`
-			DocumentId   string  `json:"document_id"`
-			DocumentName string  `json:"document_name"`
-			SegmentId    string  `json:"segment_id"`
-			Score        float64 `json:"score"`
-			Content      string  `json:"content"`
-		} `json:"retriever_resources"`
-		CreatedAt int `json:"created_at"`
-	} `json:"data"`
+	Limit   int       `json:"limit"`
+	HasMore bool      `json:"has_more"`
+	Data    []Message `json:"data"`
+}
+type Message struct {
+	Id             string `json:"id"`
+	ConversationId string `json:"conversation_id"`
+	Inputs         struct {
+		Name string `json:"name"`
+	} `json:"inputs"`
+	Query              string              `json:"query"`
+	Answer             string              `json:"answer"`
+	MessageFiles       []MessageFile       `json:"message_files"`
+	Feedback           *MessageFeedback    `json:"feedback"` // 未反馈时为 nil
+	RetrieverResources []RetrieverResource `json:"retriever_resources"`
+	CreatedAt          int                 `json:"created_at"`
+}
+type MessageFile struct {
+	Id             string `json:"id"`
+	Filename       string `json:"filename"`
+	Type           string `json:"type"` // 文件类型，如 image
+	Url            string `json:"url"`  // 预览地址
+	MimeType       string `json:"mime_type"`
+	Size           int    `json:"size"`            // 文件大小，单位字节
+	TransferMethod string `json:"transfer_method"` // remote_url / local_file / tool_file
+	BelongsTo      string `json:"belongs_to"`      // user / assistant
+	UploadFileId   string `json:"upload_file_id"`  // 上传文件的 ID，remote_url 时为空
+}
+type MessageFeedback struct {
+	Rating  string `json:"rating"`            // like / dislike
+	Content string `json:"content,omitempty"` // 反馈内容，较新版本的 Dify 返回
+}
+
+type GetConversationsOption struct {
+	ApiKey        string `validate:"required"`
+	RequestParams GetConversationsReq
+}
+type GetConversationsReq struct {
+	User   string `url:"user" validate:"required"` // 用户标识
+	LastId string `url:"last_id,omitempty"`        // 当前页最后一条记录的 ID
+	Limit  int    `url:"limit,omitempty"`          // 一次请求返回多少条记录，默认 20 条
+	SortBy string `url:"sort_by,omitempty"`        // 排序字段：created_at、updated_at，前缀 - 表示倒序，默认 -updated_at
+}
+type GetConversationsResp struct {
+	Limit   int            `json:"limit"`
+	HasMore bool           `json:"has_more"`
+	Data    []Conversation `json:"data"`
+}
+type Conversation struct {
+	Id           string                 `json:"id"`
+	Name         string                 `json:"name"`
+	Inputs       map[string]interface{} `json:"inputs"`
+	Status       string                 `json:"status"`
+	Introduction string                 `json:"introduction"`
+	CreatedAt    int                    `json:"created_at"`
+	UpdatedAt    int                    `json:"updated_at"`
+}
+
+type DeleteConversationOption struct {
+	ConversationId string `validate:"required"`
+	ApiKey         string `validate:"required"`
+	RequestBody    DeleteConversationReq
+}
+type DeleteConversationReq struct {
+	User string `json:"user" validate:"required"` // 用户标识
+}
+type DeleteConversationResp struct {
+	Result string `json:"result"`
 }
 
 type ConversationRenameOption struct {
@@ -0,0 +1,210 @@
+package dify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	UsageSourceBlocking         = "blocking"          // 阻塞模式的响应
+	UsageSourceMessageEnd       = "message_end"       // 流式 message_end 事件
+	UsageSourceWorkflowFinished = "workflow_finished" // 流式 workflow_finished 事件，只有 token 总数，没有费用
+	UsageSourceResumed          = "resumed"           // 断流后从会话历史找回的回答，历史消息不含用量，Usage 为空
+)
+
+// UsageRecord 一条消息的用量
+type UsageRecord struct {
+	App            string // 应用名，见 ClientConfig.AppNames
+	User           string
+	ConversationId string
+	MessageId      string
+	TaskId         string
+	Source         string // 用量来源，见 UsageSource 常量
+	Usage          Usage
+	CreatedAt      time.Time
+}
+
+// UsageRecorder 记录用量，在每次阻塞响应以及流式 message_end 事件后调用；
+// 工作流应用没有 message_end 事件时，在 workflow_finished 事件后调用；
+// 断流后通过 ResumeOption 找回的回答以 UsageSourceResumed 记录
+type UsageRecorder interface {
+	RecordUsage(ctx context.Context, record UsageRecord) error
+}
+
+// UsageKey 用量汇总的维度，查询时空字段表示不限
+type UsageKey struct {
+	App            string
+	User           string
+	ConversationId string
+}
+
+// UsageTotals 用量汇总
+type UsageTotals struct {
+	Messages         int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	TotalPrice       map[string]float64 // 按币种汇总的费用
+}
+
+func (t *UsageTotals) add(usage Usage) {
+	t.Messages++
+	t.PromptTokens += usage.PromptTokens
+	t.CompletionTokens += usage.CompletionTokens
+	t.TotalTokens += usage.TotalTokens
+	totalPrice, parseErr := strconv.ParseFloat(usage.TotalPrice, 64)
+	if parseErr != nil || usage.Currency == "" {
+		return
+	}
+	if t.TotalPrice == nil {
+		t.TotalPrice = make(map[string]float64)
+	}
+	t.TotalPrice[usage.Currency] += totalPrice
+}
+
+func (t *UsageTotals) merge(other UsageTotals) {
+	t.Messages += other.Messages
+	t.PromptTokens += other.PromptTokens
+	t.CompletionTokens += other.CompletionTokens
+	t.TotalTokens += other.TotalTokens
+	for currency, price := range other.TotalPrice {
+		if t.TotalPrice == nil {
+			t.TotalPrice = make(map[string]float64)
+		}
+		t.TotalPrice[currency] += price
+	}
+}
+
+// UsageAggregator 在内存中按应用、用户和会话汇总用量
+type UsageAggregator struct {
+	mu     sync.RWMutex
+	totals map[UsageKey]*UsageTotals
+}
+
+var _ UsageRecorder = (*UsageAggregator)(nil)
+
+func NewUsageAggregator() *UsageAggregator {
+	return &UsageAggregator{
+		totals: make(map[UsageKey]*UsageTotals),
+	}
+}
+
+func (a *UsageAggregator) RecordUsage(_ context.Context, record UsageRecord) error {
+	key := UsageKey{App: record.App, User: record.User, ConversationId: record.ConversationId}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	totals, ok := a.totals[key]
+	if !ok {
+		totals = &UsageTotals{}
+		a.totals[key] = totals
+	}
+	totals.add(record.Usage)
+	return nil
+}
+
+// Sum 汇总匹配 filter 的用量，如只填 User 即为该用户在所有应用和会话中的用量
+func (a *UsageAggregator) Sum(filter UsageKey) (sum UsageTotals) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for key, totals := range a.totals {
+		if filter.App != "" && filter.App != key.App ||
+			filter.User != "" && filter.User != key.User ||
+			filter.ConversationId != "" && filter.ConversationId != key.ConversationId {
+			continue
+		}
+		sum.merge(*totals)
+	}
+	return
+}
+
+// Snapshot 返回所有维度的用量副本
+func (a *UsageAggregator) Snapshot() map[UsageKey]UsageTotals {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	snapshot := make(map[UsageKey]UsageTotals, len(a.totals))
+	for key, totals := range a.totals {
+		var copied UsageTotals
+		copied.merge(*totals)
+		snapshot[key] = copied
+	}
+	return snapshot
+}
+
+// usageTracker 跟踪一次流式调用的用量
+//
+// 对话流应用会先后发送 workflow_finished 和 message_end，只有 message_end 带费用，
+// 因此 workflow_finished 的用量先暂存，流结束时仍没有 message_end 才记录。
+type usageTracker struct {
+	messageEnd       bool
+	workflowFinished *UsageRecord
+}
+
+// recordUsage 调用 UsageRecorder 并扣减预算，失败不影响调用结果
+func (c *Client) recordUsage(ctx context.Context, record UsageRecord) {
+	if c.config.UsageRecorder == nil && c.config.BudgetPolicy == nil {
+		return
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	// 调用方取消 ctx 时用量仍需入账
+	ctx = context.WithoutCancel(ctx)
+	if c.config.UsageRecorder != nil {
+		recordErr := c.config.UsageRecorder.RecordUsage(ctx, record)
+		if recordErr != nil {
+			fmt.Printf("recordUsageErr: %s\n", recordErr.Error())
+		}
+	}
+	if c.config.BudgetPolicy != nil {
+		debitErr := c.config.BudgetPolicy.debit(ctx, record)
+		if debitErr != nil {
+			fmt.Printf("budgetDebitErr: %s\n", debitErr.Error())
+		}
+	}
+}
+
+// streamEvent 处理流式事件中的用量
+func (t *usageTracker) streamEvent(ctx context.Context, c *Client, option *ChatMessageOption, ev ChatMessageRespSSEData) {
+	if ev.Event != "message_end" && ev.Event != "workflow_finished" {
+		return
+	}
+	record := UsageRecord{
+		App:            c.appName(option.ApiKey),
+		User:           option.RequestBody.User,
+		ConversationId: ev.ConversationId,
+		MessageId:      ev.MessageId,
+		TaskId:         ev.TaskId,
+	}
+	if ev.Event == "workflow_finished" {
+		record.Source = UsageSourceWorkflowFinished
+		record.Usage = Usage{TotalTokens: ev.Data.TotalTokens}
+		t.workflowFinished = &record
+		return
+	}
+	if t.messageEnd {
+		return
+	}
+	if ev.Synthetic && t.workflowFinished != nil {
+		// 断流前已收到工作流的 token 数，比找回的回答更准确，由 finish 记录
+		return
+	}
+	t.messageEnd = true
+	record.Source = UsageSourceMessageEnd
+	if ev.Synthetic {
+		record.Source = UsageSourceResumed
+	}
+	record.Usage = ev.Metadata.Usage
+	c.recordUsage(ctx, record)
+}
+
+// finish 在流结束时记录没有 message_end 的工作流用量
+func (t *usageTracker) finish(ctx context.Context, c *Client) {
+	if t.messageEnd || t.workflowFinished == nil {
+		return
+	}
+	c.recordUsage(ctx, *t.workflowFinished)
+}
@@ -0,0 +1,133 @@
+package dify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SQLUsageRecorderOption SQLUsageRecorder 配置
+type SQLUsageRecorderOption struct {
+	Table       string           // 表名，默认 dify_usage，需为可信的常量
+	Placeholder func(int) string // 第 n 个参数的占位符（从 1 开始），默认 ?，PostgreSQL 使用 PostgresPlaceholder
+}
+
+// PostgresPlaceholder PostgreSQL 风格的参数占位符
+func PostgresPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// SQLUsageRecorder 将每条用量写入 database/sql 数据库，可按应用、用户和会话汇总
+type SQLUsageRecorder struct {
+	db          *sql.DB
+	table       string
+	placeholder func(int) string
+}
+
+var _ UsageRecorder = (*SQLUsageRecorder)(nil)
+
+func NewSQLUsageRecorder(db *sql.DB, option SQLUsageRecorderOption) *SQLUsageRecorder {
+	recorder := &SQLUsageRecorder{
+		db:          db,
+		table:       option.Table,
+		placeholder: option.Placeholder,
+	}
+	if recorder.table == "" {
+		recorder.table = "dify_usage"
+	}
+	if recorder.placeholder == nil {
+		recorder.placeholder = func(int) string { return "?" }
+	}
+	return recorder
+}
+
+// CreateTable 创建用量表，已存在时不做处理
+func (r *SQLUsageRecorder) CreateTable(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	app VARCHAR(255) NOT NULL,
+	user_id VARCHAR(255) NOT NULL,
+	conversation_id VARCHAR(64) NOT NULL,
+	message_id VARCHAR(64) NOT NULL,
+	task_id VARCHAR(64) NOT NULL,
+	source VARCHAR(32) NOT NULL,
+	prompt_tokens INTEGER NOT NULL,
+	completion_tokens INTEGER NOT NULL,
+	total_tokens INTEGER NOT NULL,
+	total_price DECIMAL(20, 7) NOT NULL,
+	currency VARCHAR(16) NOT NULL,
+	created_at TIMESTAMP NOT NULL
+)`, r.table))
+	return err
+}
+
+func (r *SQLUsageRecorder) RecordUsage(ctx context.Context, record UsageRecord) error {
+	totalPrice, _ := strconv.ParseFloat(record.Usage.TotalPrice, 64)
+	columns := []string{"app", "user_id", "conversation_id", "message_id", "task_id", "source",
+		"prompt_tokens", "completion_tokens", "total_tokens", "total_price", "currency", "created_at"}
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		placeholders[i] = r.placeholder(i + 1)
+	}
+
+	_, err := r.db.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", r.table, strings.Join(columns, ", "), strings.Join(placeholders, ", ")),
+		record.App, record.User, record.ConversationId, record.MessageId, record.TaskId, record.Source,
+		record.Usage.PromptTokens, record.Usage.CompletionTokens, record.Usage.TotalTokens, totalPrice, record.Usage.Currency,
+		record.CreatedAt,
+	)
+	return err
+}
+
+// Sum 汇总匹配 filter 的用量，空字段表示不限
+func (r *SQLUsageRecorder) Sum(ctx context.Context, filter UsageKey) (sum UsageTotals, err error) {
+	var conditions []string
+	var args []any
+	for _, condition := range []struct {
+		column string
+		value  string
+	}{
+		{"app", filter.App},
+		{"user_id", filter.User},
+		{"conversation_id", filter.ConversationId},
+	} {
+		if condition.value == "" {
+			continue
+		}
+		args = append(args, condition.value)
+		conditions = append(conditions, condition.column+" = "+r.placeholder(len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, queryErr := r.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT currency, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), SUM(total_price) FROM %s%s GROUP BY currency",
+		r.table, where), args...)
+	if queryErr != nil {
+		err = fmt.Errorf("queryErr: %w", queryErr)
+		return
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		var currency string
+		var group UsageTotals
+		var totalPrice sql.NullFloat64
+		scanErr := rows.Scan(&currency, &group.Messages, &group.PromptTokens, &group.CompletionTokens, &group.TotalTokens, &totalPrice)
+		if scanErr != nil {
+			err = fmt.Errorf("scanErr: %w", scanErr)
+			return
+		}
+		if currency != "" && totalPrice.Valid {
+			group.TotalPrice = map[string]float64{currency: totalPrice.Float64}
+		}
+		sum.merge(group)
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,76 @@
+package dify_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+)
+
+func TestUsageRecorder(t *testing.T) {
+	server := difytest.NewServer()
+	defer server.Close()
+	aggregator := dify.NewUsageAggregator()
+	client := dify.NewClient(server.URL, dify.WithUsageRecorder(aggregator), dify.WithAppName("app-test", "support"))
+
+	server.Enqueue(
+		difytest.Reply{Answer: "a", Usage: dify.Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4, TotalPrice: "0.25", Currency: "USD"}},
+		difytest.Reply{Chunks: []string{"b", "c"}, Usage: dify.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7, TotalPrice: "0.5", Currency: "USD"}},
+	)
+	conversationId := chat(t, client, "", "hi").ConversationId
+	_, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+		ApiKey:  "app-test",
+		OnEvent: func(dify.ChatMessageRespSSEData) {},
+		RequestBody: dify.ChatMessageReq{
+			Query:          "again",
+			ResponseMode:   dify.ResponseModeStreaming,
+			ConversationId: conversationId,
+			User:           "user-1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("ChatMessage() error = %v", err)
+	}
+
+	sum := aggregator.Sum(dify.UsageKey{App: "support", User: "user-1"})
+	if sum.Messages != 2 || sum.PromptTokens != 8 || sum.CompletionTokens != 3 || sum.TotalTokens != 11 || sum.TotalPrice["USD"] != 0.75 {
+		t.Errorf("Sum() = %+v", sum)
+	}
+	if sum := aggregator.Sum(dify.UsageKey{User: "user-2"}); sum.Messages != 0 {
+		t.Errorf("Sum() for another user = %+v, want empty", sum)
+	}
+}
+
+func TestUsageRecorderUnnamedApps(t *testing.T) {
+	server := difytest.NewServer()
+	defer server.Close()
+	aggregator := dify.NewUsageAggregator()
+	client := dify.NewClient(server.URL, dify.WithUsageRecorder(aggregator))
+
+	// 首尾相同的两个密钥属于不同应用，用量不能合并到一起
+	for _, apiKey := range []string{"app-abcd1111wxyz", "app-abcd2222wxyz"} {
+		server.Enqueue(difytest.Reply{Answer: "ok", Usage: dify.Usage{TotalTokens: 1}})
+		_, err := client.ChatMessage(context.Background(), dify.ChatMessageOption{
+			ApiKey:      apiKey,
+			RequestBody: dify.ChatMessageReq{Query: "hi", ResponseMode: dify.ResponseModeBlocking, User: "user-1"},
+		})
+		if err != nil {
+			t.Fatalf("ChatMessage() error = %v", err)
+		}
+	}
+
+	apps := make(map[string]int)
+	for key, totals := range aggregator.Snapshot() {
+		apps[key.App] += totals.Messages
+	}
+	if len(apps) != 2 {
+		t.Fatalf("apps = %v, want two separate apps", apps)
+	}
+	for app := range apps {
+		if !strings.HasPrefix(app, "key-") {
+			t.Errorf("app = %q, want a key- hash", app)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+module github.com/Davied-H/dify-go/ws
+
+go 1.24
+
+// 与核心包在同一仓库中开发
+replace github.com/Davied-H/dify-go => ../
+
+require (
+	github.com/Davied-H/dify-go v0.0.0-00010101000000-000000000000
+	github.com/coder/websocket v1.8.14
+)
+
+require (
+	github.com/duke-git/lancet/v2 v2.3.5 // indirect
+	github.com/gabriel-vasile/mimetype v1.4.8 // indirect
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/go-playground/validator/v10 v10.26.0 // indirect
+	github.com/google/go-querystring v1.1.0 // indirect
+	github.com/leodido/go-urn v1.4.0 // indirect
+	github.com/tmaxmax/go-sse v0.10.0 // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/exp v0.0.0-20221208152030-732eee02a75a // indirect
+	golang.org/x/net v0.34.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
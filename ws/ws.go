@@ -0,0 +1,315 @@
+// Package ws 通过 WebSocket 为前端提供流式对话
+//
+// 每个连接是一个双向会话：前端发送 chat 帧发起对话、stop 帧停止回答，
+// 服务端以 event 帧推送流式事件，以 done 或 error 帧结束一次对话。
+//
+//	http.Handle("/ws", ws.NewHandler(ws.HandlerOption{
+//		Client: client,
+//		Prepare: func(r *http.Request, frame ws.ChatFrame) (dify.ChatMessageOption, error) {
+//			return dify.ChatMessageOption{
+//				ApiKey:      os.Getenv("DIFY_API_KEY"),
+//				RequestBody: frame.ChatMessageReq(userFromRequest(r)),
+//			}, nil
+//		},
+//	}))
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+const (
+	FrameTypeChat  = "chat"  // 前端发起对话
+	FrameTypeStop  = "stop"  // 前端停止对话
+	FrameTypeEvent = "event" // 服务端推送的流式事件
+	FrameTypeDone  = "done"  // 一次对话正常结束
+	FrameTypeError = "error" // 帧无效或对话出错
+)
+
+// 错误帧的错误码，Dify 返回的错误使用 Dify 的错误码
+const (
+	ErrorCodeBadFrame        = "bad_frame"
+	ErrorCodeDuplicateId     = "duplicate_id"
+	ErrorCodeTooManyRequests = "too_many_requests"
+	ErrorCodeNotFound        = "not_found"
+	ErrorCodeRejected        = "rejected"
+	ErrorCodeUpstream        = "upstream_error"
+)
+
+// ChatFrame 前端发送的帧
+type ChatFrame struct {
+	Type           string                 `json:"type"`            // chat / stop
+	Id             string                 `json:"id"`              // 前端生成的对话 ID，同一连接内唯一，stop 帧使用相同的 ID
+	Query          string                 `json:"query"`           // 仅 chat 帧
+	ConversationId string                 `json:"conversation_id"` // 仅 chat 帧，继续已有会话时传入
+	Inputs         map[string]interface{} `json:"inputs"`          // 仅 chat 帧
+}
+
+// ChatMessageReq 以帧内容构造请求参数，user 由服务端根据登录态决定
+func (f ChatFrame) ChatMessageReq(user string) dify.ChatMessageReq {
+	return dify.ChatMessageReq{
+		Inputs:         f.Inputs,
+		Query:          f.Query,
+		ConversationId: f.ConversationId,
+		User:           user,
+	}
+}
+
+// ServerFrame 服务端发送的帧
+type ServerFrame struct {
+	Type    string                       `json:"type"` // event / done / error
+	Id      string                       `json:"id,omitempty"`
+	Event   *dify.ChatMessageRespSSEData `json:"event,omitempty"`   // 仅 event 帧
+	Code    string                       `json:"code,omitempty"`    // 仅 error 帧
+	Message string                       `json:"message,omitempty"` // 仅 error 帧
+}
+
+// HandlerOption WebSocket 会话配置
+type HandlerOption struct {
+	Client dify.ClientI
+	// Prepare 根据握手请求和 chat 帧构造 ChatMessageOption，必填；
+	// 在这里完成鉴权并决定 ApiKey 和 User，返回错误时向前端发送 rejected 错误帧
+	Prepare func(r *http.Request, frame ChatFrame) (dify.ChatMessageOption, error)
+	// Filter 可选，返回 false 的事件不推送
+	Filter func(ev dify.ChatMessageRespSSEData) bool
+
+	MaxConcurrent int                      // 每个连接同时进行的对话数，默认 1
+	PingInterval  time.Duration            // 心跳间隔，默认 30 秒
+	PingTimeout   time.Duration            // 等待 pong 的超时，默认 10 秒，超时后关闭连接
+	WriteTimeout  time.Duration            // 单帧写入超时，默认 10 秒
+	StopTimeout   time.Duration            // 连接断开后停止进行中任务的超时，默认 5 秒
+	AcceptOptions *websocket.AcceptOptions // 可选，握手配置，如允许的 Origin
+}
+
+// NewHandler 返回处理 WebSocket 握手并运行会话的 http.Handler
+func NewHandler(option HandlerOption) http.Handler {
+	if option.MaxConcurrent <= 0 {
+		option.MaxConcurrent = 1
+	}
+	if option.PingInterval <= 0 {
+		option.PingInterval = 30 * time.Second
+	}
+	if option.PingTimeout <= 0 {
+		option.PingTimeout = 10 * time.Second
+	}
+	if option.WriteTimeout <= 0 {
+		option.WriteTimeout = 10 * time.Second
+	}
+	if option.StopTimeout <= 0 {
+		option.StopTimeout = 5 * time.Second
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, acceptErr := websocket.Accept(w, r, option.AcceptOptions)
+		if acceptErr != nil {
+			fmt.Printf("acceptErr: %s\n", acceptErr.Error())
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+		s := &session{
+			option:  option,
+			request: r,
+			conn:    conn,
+			ctx:     ctx,
+			streams: make(map[string]*dify.ChatMessageStream),
+		}
+		go s.keepalive(cancel)
+		s.run()
+		cancel()
+		s.wait.Wait()
+		_ = conn.CloseNow()
+	})
+}
+
+// session 一个 WebSocket 连接上的会话
+type session struct {
+	option  HandlerOption
+	request *http.Request
+	conn    *websocket.Conn
+	ctx     context.Context
+	wait    sync.WaitGroup
+
+	mu      sync.Mutex
+	streams map[string]*dify.ChatMessageStream // 进行中的对话
+}
+
+// run 读取前端的帧直到连接断开
+func (s *session) run() {
+	defer s.stopAll()
+	for {
+		_, data, readErr := s.conn.Read(s.ctx)
+		if readErr != nil {
+			return
+		}
+		var frame ChatFrame
+		unmarshalErr := json.Unmarshal(data, &frame)
+		if unmarshalErr != nil {
+			s.writeError("", ErrorCodeBadFrame, unmarshalErr.Error())
+			continue
+		}
+
+		switch frame.Type {
+		case FrameTypeChat:
+			s.chat(frame)
+		case FrameTypeStop:
+			s.stop(frame)
+		default:
+			s.writeError(frame.Id, ErrorCodeBadFrame, fmt.Sprintf("unknown frame type %q", frame.Type))
+		}
+	}
+}
+
+// chat 发起一次对话，并在后台推送事件
+func (s *session) chat(frame ChatFrame) {
+	if frame.Id == "" {
+		s.writeError("", ErrorCodeBadFrame, "id is required")
+		return
+	}
+	option, prepareErr := s.option.Prepare(s.request, frame)
+	if prepareErr != nil {
+		s.writeError(frame.Id, ErrorCodeRejected, prepareErr.Error())
+		return
+	}
+
+	s.mu.Lock()
+	if _, ok := s.streams[frame.Id]; ok {
+		s.mu.Unlock()
+		s.writeError(frame.Id, ErrorCodeDuplicateId, "a chat with this id is in progress")
+		return
+	}
+	if len(s.streams) >= s.option.MaxConcurrent {
+		s.mu.Unlock()
+		s.writeError(frame.Id, ErrorCodeTooManyRequests, fmt.Sprintf("at most %d chats can run concurrently on one connection", s.option.MaxConcurrent))
+		return
+	}
+	stream := dify.NewChatMessageStream(s.ctx, s.option.Client, option)
+	s.streams[frame.Id] = stream
+	s.wait.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wait.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.streams, frame.Id)
+			s.mu.Unlock()
+		}()
+		defer stream.Close()
+
+		for {
+			ev, recvErr := stream.Recv()
+			if recvErr == io.EOF {
+				s.write(ServerFrame{Type: FrameTypeDone, Id: frame.Id})
+				return
+			}
+			if recvErr != nil {
+				if s.ctx.Err() == nil {
+					s.writeUpstreamError(frame.Id, recvErr)
+				}
+				return
+			}
+			if s.option.Filter != nil && !s.option.Filter(ev) {
+				continue
+			}
+			s.write(ServerFrame{Type: FrameTypeEvent, Id: frame.Id, Event: &ev})
+		}
+	}()
+}
+
+// stop 停止一次进行中的对话，对话随后以 done 帧结束
+func (s *session) stop(frame ChatFrame) {
+	s.mu.Lock()
+	stream, ok := s.streams[frame.Id]
+	s.mu.Unlock()
+	if !ok {
+		s.writeError(frame.Id, ErrorCodeNotFound, "no chat with this id is in progress")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.option.StopTimeout)
+	defer cancel()
+	if _, stopErr := stream.Stop(ctx); stopErr != nil {
+		s.writeUpstreamError(frame.Id, stopErr)
+	}
+}
+
+// stopAll 连接断开后停止所有进行中的对话
+func (s *session) stopAll() {
+	s.mu.Lock()
+	streams := make([]*dify.ChatMessageStream, 0, len(s.streams))
+	for _, stream := range s.streams {
+		streams = append(streams, stream)
+	}
+	s.mu.Unlock()
+
+	for _, stream := range streams {
+		if stream.TaskId() == "" {
+			continue
+		}
+		select {
+		case <-stream.Done():
+			continue
+		default:
+		}
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(s.ctx), s.option.StopTimeout)
+		_, _ = stream.Stop(ctx)
+		cancel()
+	}
+}
+
+// keepalive 定期发送 ping，超时未收到 pong 时关闭连接
+func (s *session) keepalive(cancel context.CancelFunc) {
+	ticker := time.NewTicker(s.option.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ctx, pingCancel := context.WithTimeout(s.ctx, s.option.PingTimeout)
+		pingErr := s.conn.Ping(ctx)
+		pingCancel()
+		if pingErr != nil {
+			_ = s.conn.Close(websocket.StatusPolicyViolation, "ping timeout")
+			cancel()
+			return
+		}
+	}
+}
+
+func (s *session) write(frame ServerFrame) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.option.WriteTimeout)
+	defer cancel()
+	_ = wsjson.Write(ctx, s.conn, frame)
+}
+
+func (s *session) writeError(id string, code string, message string) {
+	s.write(ServerFrame{Type: FrameTypeError, Id: id, Code: code, Message: message})
+}
+
+// writeUpstreamError 发送 Dify 返回的错误，保留 Dify 的错误码
+func (s *session) writeUpstreamError(id string, err error) {
+	var apiErr *dify.APIError
+	if errors.As(err, &apiErr) && apiErr.Code != "" {
+		message := apiErr.Message
+		if message == "" {
+			message = apiErr.Error()
+		}
+		s.writeError(id, apiErr.Code, message)
+		return
+	}
+	s.writeError(id, ErrorCodeUpstream, err.Error())
+}
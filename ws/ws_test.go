@@ -0,0 +1,220 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dify "github.com/Davied-H/dify-go"
+	"github.com/Davied-H/dify-go/difytest"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+type testConn struct {
+	t      *testing.T
+	server *difytest.Server
+	conn   *websocket.Conn
+}
+
+// dial 启动 WebSocket 服务并建立连接，Prepare 以 query 参数 user 作为用户标识
+func dial(t *testing.T, option HandlerOption) *testConn {
+	t.Helper()
+	server := difytest.NewServer()
+	t.Cleanup(server.Close)
+	option.Client = dify.NewClient(server.URL)
+	option.Prepare = func(r *http.Request, frame ChatFrame) (dify.ChatMessageOption, error) {
+		if frame.Query == "forbidden" {
+			return dify.ChatMessageOption{}, errors.New("query is not allowed")
+		}
+		return dify.ChatMessageOption{
+			ApiKey:      "app-test",
+			RequestBody: frame.ChatMessageReq(r.URL.Query().Get("user")),
+		}, nil
+	}
+	handler := httptest.NewServer(NewHandler(option))
+	t.Cleanup(handler.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(handler.URL, "http")+"?user=user-1", nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.CloseNow()
+	})
+	return &testConn{t: t, server: server, conn: conn}
+}
+
+func (c *testConn) send(frame any) {
+	c.t.Helper()
+	if err := wsjson.Write(context.Background(), c.conn, frame); err != nil {
+		c.t.Fatalf("Write() error = %v", err)
+	}
+}
+
+func (c *testConn) recv() ServerFrame {
+	c.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var frame ServerFrame
+	if err := wsjson.Read(ctx, c.conn, &frame); err != nil {
+		c.t.Fatalf("Read() error = %v", err)
+	}
+	return frame
+}
+
+// recvUntilEnd 读取 id 对应对话的帧直到 done 或 error，返回帧摘要
+func (c *testConn) recvUntilEnd(id string) []string {
+	c.t.Helper()
+	var frames []string
+	for {
+		frame := c.recv()
+		if frame.Id != id {
+			continue
+		}
+		switch frame.Type {
+		case FrameTypeEvent:
+			frames = append(frames, frame.Event.Event+":"+frame.Event.Answer)
+		case FrameTypeError:
+			return append(frames, "error:"+frame.Code)
+		default:
+			return append(frames, frame.Type)
+		}
+	}
+}
+
+func TestChat(t *testing.T) {
+	c := dial(t, HandlerOption{})
+	c.server.Enqueue(difytest.Reply{Chunks: []string{"a", "b"}})
+
+	c.send(ChatFrame{Type: FrameTypeChat, Id: "1", Query: "hi", Inputs: map[string]interface{}{"k": "v"}})
+	if got := strings.Join(c.recvUntilEnd("1"), ","); got != "message:a,message:b,message_end:,done" {
+		t.Errorf("frames = %s", got)
+	}
+
+	var body dify.ChatMessageReq
+	if err := c.server.AssertRequested(t, http.MethodPost, "/chat-messages").JSON(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.User != "user-1" || body.Query != "hi" || body.Inputs["k"] != "v" || body.ResponseMode != dify.ResponseModeStreaming {
+		t.Errorf("request body = %+v", body)
+	}
+}
+
+func TestBadFrames(t *testing.T) {
+	c := dial(t, HandlerOption{})
+	tests := []struct {
+		name  string
+		frame any
+		id    string
+		code  string
+	}{
+		{name: "not json", frame: "hello", code: ErrorCodeBadFrame},
+		{name: "unknown type", frame: ChatFrame{Type: "pause", Id: "1"}, id: "1", code: ErrorCodeBadFrame},
+		{name: "missing id", frame: ChatFrame{Type: FrameTypeChat, Query: "hi"}, code: ErrorCodeBadFrame},
+		{name: "rejected by prepare", frame: ChatFrame{Type: FrameTypeChat, Id: "2", Query: "forbidden"}, id: "2", code: ErrorCodeRejected},
+		{name: "stop unknown chat", frame: ChatFrame{Type: FrameTypeStop, Id: "3"}, id: "3", code: ErrorCodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.send(tt.frame)
+			frame := c.recv()
+			if frame.Type != FrameTypeError || frame.Id != tt.id || frame.Code != tt.code {
+				t.Errorf("frame = %+v, want error %s for %q", frame, tt.code, tt.id)
+			}
+		})
+	}
+	c.server.AssertNotRequested(t, http.MethodPost, "/chat-messages")
+}
+
+func TestConcurrentChats(t *testing.T) {
+	c := dial(t, HandlerOption{MaxConcurrent: 2})
+	c.server.Enqueue(
+		difytest.Reply{Chunks: []string{"a", "b"}, Delay: 50 * time.Millisecond},
+		difytest.Reply{Chunks: []string{"c", "d"}, Delay: 50 * time.Millisecond},
+	)
+
+	c.send(ChatFrame{Type: FrameTypeChat, Id: "1", Query: "first"})
+	c.send(ChatFrame{Type: FrameTypeChat, Id: "1", Query: "duplicate"})
+	c.send(ChatFrame{Type: FrameTypeChat, Id: "2", Query: "second"})
+	c.send(ChatFrame{Type: FrameTypeChat, Id: "3", Query: "third"})
+
+	// 重复 ID 和超出并发数的请求立即返回错误，进行中的对话各自以 done 结束
+	ends := make(map[string]string)
+	for len(ends) < 4 {
+		frame := c.recv()
+		switch frame.Type {
+		case FrameTypeError:
+			ends[frame.Id+"/"+frame.Code] = frame.Code
+		case FrameTypeDone:
+			ends[frame.Id] = frame.Type
+		}
+	}
+	for _, want := range []string{"1/" + ErrorCodeDuplicateId, "3/" + ErrorCodeTooManyRequests, "1", "2"} {
+		if _, ok := ends[want]; !ok {
+			t.Errorf("frames = %v, missing %s", ends, want)
+		}
+	}
+}
+
+func TestStopFrame(t *testing.T) {
+	c := dial(t, HandlerOption{})
+	c.server.Enqueue(difytest.Reply{Chunks: []string{"a", "b", "c", "d"}, Delay: 50 * time.Millisecond})
+
+	c.send(ChatFrame{Type: FrameTypeChat, Id: "1", Query: "hi"})
+	if frame := c.recv(); frame.Type != FrameTypeEvent {
+		t.Fatalf("first frame = %+v", frame)
+	}
+	c.send(ChatFrame{Type: FrameTypeStop, Id: "1"})
+
+	frames := c.recvUntilEnd("1")
+	if frames[len(frames)-1] != "done" || len(frames) > 4 {
+		t.Errorf("frames after stop = %v, want a short answer ending with done", frames)
+	}
+	var body dify.StopTaskReq
+	for _, request := range c.server.Requests() {
+		if strings.HasSuffix(request.Path, "/stop") {
+			_ = request.JSON(&body)
+		}
+	}
+	if body.User != "user-1" {
+		t.Errorf("stop body = %+v, want user-1", body)
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	c := dial(t, HandlerOption{})
+	c.server.Enqueue(difytest.Reply{Error: &difytest.Error{Status: http.StatusBadRequest, Code: "provider_quota_exceeded", Message: "quota"}})
+
+	c.send(ChatFrame{Type: FrameTypeChat, Id: "1", Query: "hi"})
+	frame := c.recv()
+	if frame.Type != FrameTypeError || frame.Code != "provider_quota_exceeded" || frame.Message != "quota" {
+		t.Errorf("frame = %+v", frame)
+	}
+}
+
+func TestDisconnectStopsChats(t *testing.T) {
+	c := dial(t, HandlerOption{})
+	c.server.Enqueue(difytest.Reply{Chunks: []string{"a", "b", "c"}, Delay: 100 * time.Millisecond})
+
+	c.send(ChatFrame{Type: FrameTypeChat, Id: "1", Query: "hi"})
+	c.recv()
+	_ = c.conn.Close(websocket.StatusNormalClosure, "")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, request := range c.server.Requests() {
+			if strings.HasSuffix(request.Path, "/stop") {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("task was not stopped after the connection closed")
+}